@@ -16,21 +16,20 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/admin/addRole": {
+        "/admin/authors/merge": {
             "post": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "add role",
-                "operationId": "addRole",
+                "summary": "merge authors, series or genres",
                 "parameters": [
                     {
-                        "description": "Creditionals's credentials",
+                        "description": "Entry to keep and entries merged into it",
                         "name": "params",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.AddRole"
+                            "$ref": "#/definitions/model.MergeCatalogCommand"
                         }
                     }
                 ],
@@ -62,27 +61,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/admin/role/list": {
-            "get": {
+        "/admin/authors/rename": {
+            "put": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get roles",
-                "operationId": "getRole",
+                "summary": "rename an author, series or genre",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Role id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
+                        "description": "Entry and its new name",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.RenameCatalogCommand"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Data",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Role"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -106,33 +106,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/admin/user/delete": {
-            "delete": {
+        "/admin/book/duplicates": {
+            "get": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "delete user",
-                "operationId": "deleteUser",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
-                    }
-                ],
+                "summary": "get likely duplicate books",
+                "operationId": "getDuplicates",
                 "responses": {
                     "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
+                        "description": "Groups of books with the same title and author",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "type": "array",
+                            "items": {
+                                "type": "array",
+                                "items": {
+                                    "$ref": "#/definitions/model.Book"
+                                }
+                            }
                         }
                     },
                     "401": {
@@ -150,27 +141,29 @@ const docTemplate = `{
                 }
             }
         },
-        "/admin/user/list": {
-            "get": {
+        "/admin/book/merge": {
+            "post": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get users",
-                "operationId": "getUser",
+                "summary": "merge books",
+                "operationId": "mergeBooks",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
+                        "description": "Book to keep and books merged into it",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.MergeBooksCommand"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Data",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -194,33 +187,18 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/delete": {
-            "delete": {
+        "/admin/book/reprocess": {
+            "post": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "delete book",
-                "operationId": "deleteBook",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Book id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
-                    }
-                ],
+                "summary": "reprocess books",
+                "operationId": "reprocessBooks",
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
+                    "202": {
+                        "description": "Reprocess job, its status is read from /book/import/status",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "$ref": "#/definitions/model.ImportJob"
                         }
                     },
                     "401": {
@@ -238,27 +216,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/list": {
-            "get": {
+        "/admin/genres/merge": {
+            "post": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get books",
-                "operationId": "getBook",
+                "summary": "merge authors, series or genres",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
+                        "description": "Entry to keep and entries merged into it",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.MergeCatalogCommand"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Data",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.Book"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -282,27 +261,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/progress/get": {
-            "get": {
+        "/admin/genres/rename": {
+            "put": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get book progress",
-                "operationId": "getProgress",
+                "summary": "rename an author, series or genre",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
+                        "description": "Entry and its new name",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.RenameCatalogCommand"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.ReadingProgress"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -326,29 +306,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/progress/set": {
-            "post": {
+        "/admin/role/list": {
+            "get": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get book progress",
-                "operationId": "saveProgress",
+                "summary": "get roles",
+                "operationId": "getRole",
                 "parameters": [
                     {
-                        "description": "Save progress command",
-                        "name": "params",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/model.UploadBookCommand"
-                        }
+                        "type": "integer",
+                        "description": "Role id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Data",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "$ref": "#/definitions/model.Role"
                         }
                     },
                     "400": {
@@ -372,27 +350,22 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/read": {
-            "get": {
+        "/admin/role/set": {
+            "put": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "get book page",
-                "operationId": "getBookPage",
+                "summary": "update role",
+                "operationId": "updateRole",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Book id",
-                        "name": "id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Page number",
-                        "name": "page",
-                        "in": "query",
-                        "required": true
+                        "description": "Creditionals's credentials",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.SetRole"
+                        }
                     }
                 ],
                 "responses": {
@@ -423,21 +396,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/book/upload": {
+        "/admin/series/merge": {
             "post": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "upload book",
-                "operationId": "uploadBook",
+                "summary": "merge authors, series or genres",
                 "parameters": [
                     {
-                        "description": "Upload command",
+                        "description": "Entry to keep and entries merged into it",
                         "name": "params",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.UploadBookCommand"
+                            "$ref": "#/definitions/model.MergeCatalogCommand"
                         }
                     }
                 ],
@@ -469,21 +441,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/login": {
-            "post": {
+        "/admin/series/rename": {
+            "put": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "login",
-                "operationId": "login",
+                "summary": "rename an author, series or genre",
                 "parameters": [
                     {
-                        "description": "Creditionals's credentials",
+                        "description": "Entry and its new name",
                         "name": "params",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.Creditionals"
+                            "$ref": "#/definitions/model.RenameCatalogCommand"
                         }
                     }
                 ],
@@ -515,13 +486,22 @@ const docTemplate = `{
                 }
             }
         },
-        "/logout": {
-            "post": {
+        "/admin/user/delete": {
+            "delete": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "logout",
-                "operationId": "logout",
+                "summary": "delete user",
+                "operationId": "deleteUser",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -550,13 +530,22 @@ const docTemplate = `{
                 }
             }
         },
-        "/profile": {
+        "/admin/user/list": {
             "get": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "profile",
-                "operationId": "profile",
+                "summary": "get users",
+                "operationId": "getUser",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "Data",
@@ -585,30 +574,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/refresh": {
+        "/authors": {
             "get": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "refresh",
-                "operationId": "refresh",
+                "summary": "get authors, series or genres",
                 "responses": {
                     "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/model.Response"
-                        }
-                    },
-                    "401": {
-                        "description": "Unauthorized",
+                        "description": "Entries with the number of their books",
                         "schema": {
-                            "$ref": "#/definitions/model.Response"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.CatalogEntry"
+                            }
                         }
                     },
                     "500": {
@@ -620,29 +599,29 @@ const docTemplate = `{
                 }
             }
         },
-        "/registration": {
-            "post": {
+        "/authors/books": {
+            "get": {
                 "consumes": [
                     "application/json"
                 ],
-                "summary": "create user",
-                "operationId": "createUser",
+                "summary": "get books of an author, series or genre",
                 "parameters": [
                     {
-                        "description": "Creditionals's credentials",
-                        "name": "params",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/model.Creditionals"
-                        }
+                        "type": "integer",
+                        "description": "Author, series or genre id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Books",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Book"
+                            }
                         }
                     },
                     "400": {
@@ -651,12 +630,6 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.Response"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "$ref": "#/definitions/model.Response"
-                        }
-                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -665,48 +638,1496 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "model.AddRole": {
-            "type": "object",
-            "properties": {
-                "role_id": {
-                    "type": "integer"
-                },
+        },
+        "/book/chapter": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book chapter",
+                "operationId": "getChapter",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chapter number",
+                        "name": "n",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pagination profile, e.g. phone, tablet or desktop",
+                        "name": "profile",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.ChapterText"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/cover": {
+            "get": {
+                "produces": [
+                    "image/jpeg"
+                ],
+                "summary": "get book cover",
+                "operationId": "getCover",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cover size: small, medium or full",
+                        "name": "size",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/delete": {
+            "delete": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "delete book",
+                "operationId": "deleteBook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/download": {
+            "get": {
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "download book",
+                "operationId": "downloadBook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Format to download in: the format of the book, epub, fb2 or txt",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Book file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Requested range of the book file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/history": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book history",
+                "operationId": "getBookHistory",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Edits of the book, the last first",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.BookEdit"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/image": {
+            "get": {
+                "produces": [
+                    "image/jpeg"
+                ],
+                "summary": "get book image",
+                "operationId": "getImage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Image name as referenced by an image block src",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/import/retry": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "retry failed book import",
+                "operationId": "retryImport",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import job id",
+                        "name": "job",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.ImportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/import/status": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book import status",
+                "operationId": "getImportStatus",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Import job id",
+                        "name": "job",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.ImportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/list": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get books",
+                "operationId": "getBook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/note": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book note",
+                "operationId": "getNote",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Note ref, the href of a note reference inline",
+                        "name": "ref",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.Note"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/progress/get": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book progress",
+                "operationId": "getProgress",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pagination profile the current page is given in",
+                        "name": "profile",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.ReadingProgress"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/progress/set": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book progress",
+                "operationId": "saveProgress",
+                "parameters": [
+                    {
+                        "description": "Save progress command",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.SaveProgress"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/read": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book page",
+                "operationId": "getBookPage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chapter number",
+                        "name": "chapter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Page format: text (default) or blocks",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pagination profile, e.g. phone, tablet or desktop",
+                        "name": "profile",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/toc": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get book table of contents",
+                "operationId": "getToc",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Book id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pagination profile, e.g. phone, tablet or desktop",
+                        "name": "profile",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/BookStore_internal_control_model.Chapter"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/update": {
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "update book",
+                "operationId": "updateBook",
+                "parameters": [
+                    {
+                        "description": "Book and the metadata to change",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.UpdateBookCommand"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated book",
+                        "schema": {
+                            "$ref": "#/definitions/model.Book"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/book/upload": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "upload book",
+                "operationId": "uploadBook",
+                "parameters": [
+                    {
+                        "description": "Upload command",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.UploadBookCommand"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.ImportJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request, details hold the validation error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "413": {
+                        "description": "File too large",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/genres": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get authors, series or genres",
+                "responses": {
+                    "200": {
+                        "description": "Entries with the number of their books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.CatalogEntry"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/genres/books": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get books of an author, series or genre",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Author, series or genre id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "login",
+                "operationId": "login",
+                "parameters": [
+                    {
+                        "description": "Creditionals's credentials",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.Creditionals"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/logout": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "logout",
+                "operationId": "logout",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/profile": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "profile",
+                "operationId": "profile",
+                "responses": {
+                    "200": {
+                        "description": "Data",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/refresh": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "refresh",
+                "operationId": "refresh",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/registration": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "create user",
+                "operationId": "createUser",
+                "parameters": [
+                    {
+                        "description": "Creditionals's credentials",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/model.Creditionals"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/series": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get authors, series or genres",
+                "responses": {
+                    "200": {
+                        "description": "Entries with the number of their books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.CatalogEntry"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/series/books": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "summary": "get books of an author, series or genre",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Author, series or genre id",
+                        "name": "id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Books",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Book"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.Response"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "BookStore_internal_control_model.Chapter": {
+            "type": "object",
+            "properties": {
+                "level": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "BookStore_internal_control_model.Identifier": {
+            "type": "object",
+            "properties": {
+                "scheme": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "BookStore_internal_database_model.Identifier": {
+            "type": "object",
+            "properties": {
+                "scheme": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Author": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Block": {
+            "type": "object",
+            "properties": {
+                "children": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Block"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "inlines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Inline"
+                    }
+                },
+                "level": {
+                    "type": "integer"
+                },
+                "ordered": {
+                    "type": "boolean"
+                },
+                "src": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Book": {
+            "type": "object",
+            "properties": {
+                "annotation": {
+                    "type": "string"
+                },
+                "author": {
+                    "type": "string"
+                },
+                "authors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BookAuthor"
+                    }
+                },
+                "chapters": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "integer"
+                },
+                "filepath": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "genres": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Genre"
+                    }
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "identifiers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/BookStore_internal_database_model.Identifier"
+                    }
+                },
+                "language": {
+                    "type": "string"
+                },
+                "pages": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "publish_date": {
+                    "type": "string"
+                },
+                "publisher": {
+                    "type": "string"
+                },
+                "series": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.BookSeries"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                },
+                "translators": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "user_id": {
                     "type": "integer"
                 }
             }
         },
-        "model.Book": {
+        "model.BookAuthor": {
             "type": "object",
             "properties": {
-                "annotation": {
+                "author": {
+                    "$ref": "#/definitions/model.Author"
+                },
+                "role": {
                     "type": "string"
+                }
+            }
+        },
+        "model.BookEdit": {
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "type": "integer"
                 },
-                "author": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.FieldChange"
+                    }
+                },
+                "created_at": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.BookSeries": {
+            "type": "object",
+            "properties": {
+                "number": {
+                    "type": "number"
+                },
+                "series": {
+                    "$ref": "#/definitions/model.Series"
+                }
+            }
+        },
+        "model.CatalogEntry": {
+            "type": "object",
+            "properties": {
+                "books": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
                     "type": "string"
+                }
+            }
+        },
+        "model.ChapterText": {
+            "type": "object",
+            "properties": {
+                "level": {
+                    "type": "integer"
                 },
-                "chapters": {
+                "number": {
+                    "type": "integer"
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "truncated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "model.Contributor": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Creditionals": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "login": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.FieldChange": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "new": {},
+                "old": {}
+            }
+        },
+        "model.Genre": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.ImportJob": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "book_id": {
                     "type": "integer"
                 },
                 "created_at": {
                     "type": "integer"
                 },
-                "filepath": {
+                "duplicate": {
+                    "type": "boolean"
+                },
+                "error": {
                     "type": "string"
                 },
-                "format": {
+                "error_code": {
+                    "type": "string"
+                },
+                "file_name": {
                     "type": "string"
                 },
                 "id": {
                     "type": "integer"
                 },
-                "pages": {
+                "kind": {
+                    "type": "string"
+                },
+                "processed": {
                     "type": "integer"
                 },
-                "title": {
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "integer"
+                },
+                "url": {
                     "type": "string"
                 },
                 "user_id": {
@@ -714,16 +2135,81 @@ const docTemplate = `{
                 }
             }
         },
-        "model.Creditionals": {
+        "model.Inline": {
             "type": "object",
             "properties": {
-                "email": {
+                "emphasis": {
+                    "type": "boolean"
+                },
+                "href": {
                     "type": "string"
                 },
-                "login": {
+                "note": {
+                    "type": "boolean"
+                },
+                "strong": {
+                    "type": "boolean"
+                },
+                "text": {
                     "type": "string"
+                }
+            }
+        },
+        "model.Locator": {
+            "type": "object",
+            "properties": {
+                "chapter": {
+                    "type": "integer"
                 },
-                "password": {
+                "offset": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.MergeBooksCommand": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "into": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.MergeCatalogCommand": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "into": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.Note": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Block"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "title": {
                     "type": "string"
                 }
             }
@@ -737,6 +2223,9 @@ const docTemplate = `{
                 "book_id": {
                     "type": "integer"
                 },
+                "chapter": {
+                    "type": "integer"
+                },
                 "current_page": {
                     "type": "integer"
                 },
@@ -746,6 +2235,9 @@ const docTemplate = `{
                 "last_read_at": {
                     "type": "integer"
                 },
+                "offset": {
+                    "type": "integer"
+                },
                 "user": {
                     "$ref": "#/definitions/model.User"
                 },
@@ -754,12 +2246,24 @@ const docTemplate = `{
                 }
             }
         },
+        "model.RenameCatalogCommand": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
         "model.Response": {
             "type": "object",
             "properties": {
                 "code": {
                     "type": "integer"
                 },
+                "details": {},
                 "message": {
                     "type": "string"
                 }
@@ -776,6 +2280,98 @@ const docTemplate = `{
                 }
             }
         },
+        "model.SaveProgress": {
+            "type": "object",
+            "properties": {
+                "book_id": {
+                    "type": "integer"
+                },
+                "locator": {
+                    "$ref": "#/definitions/model.Locator"
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "profile": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Series": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.SetRole": {
+            "type": "object",
+            "properties": {
+                "role_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "model.UpdateBookCommand": {
+            "type": "object",
+            "properties": {
+                "annotation": {
+                    "type": "string"
+                },
+                "authors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Contributor"
+                    }
+                },
+                "book_id": {
+                    "type": "integer"
+                },
+                "genres": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "identifiers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/BookStore_internal_control_model.Identifier"
+                    }
+                },
+                "language": {
+                    "type": "string"
+                },
+                "publish_date": {
+                    "type": "string"
+                },
+                "publisher": {
+                    "type": "string"
+                },
+                "series": {
+                    "type": "string"
+                },
+                "series_index": {
+                    "type": "number"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "translators": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "model.UploadBookCommand": {
             "type": "object",
             "properties": {
@@ -1,8 +1,10 @@
 const API_BASE = window.location.origin + '/api/v1';
 const API = {
     BOOK_LIST: `${API_BASE}/book/list`,
+    BOOK_COVER: `${API_BASE}/book/cover`,
     BOOK_READ: `${API_BASE}/book/read`,
     BOOK_UPLOAD: `${API_BASE}/book/upload`,
+    IMPORT_STATUS: `${API_BASE}/book/import/status`,
     BOOK_DELETE: `${API_BASE}/book/delete`,
     BOOK_PROGRESS_GET: `${API_BASE}/book/progress/get`,
     BOOK_PROGRESS_SAVE: `${API_BASE}/book/progress/set`,
@@ -62,6 +64,7 @@ let state = {
     currentBook: null,
     currentPage: 1,
     totalPages: 1,
+    profile: '',
     users: [],
     roles: [],
     readerSettings: {
@@ -227,11 +230,14 @@ function renderBooks() {
         bookCard.innerHTML = `
                     ${canDeleteBook(book) ?
                     `<button class="delete-book-btn" data-id="${book.id}" title="Удалить книгу"></button>` : ''}
+                    <img class="book-cover" src="${API.BOOK_COVER}?id=${book.id}&size=small" alt="" onerror="this.remove()">
                     <h3 class="book-title">${book.title}</h3>
                     <p class="book-author">${book.author}</p>
+                    ${book.series && book.series.length ?
+                    `<p class="book-series">${book.series[0].series.name}${book.series[0].number ? ` #${book.series[0].number}` : ''}</p>` : ''}
                     <p class="book-annotation">${book.annotation}</p>
                     <div class="book-meta">
-                        <span>${book.pages} стр.</span>
+                        <span>${bookPages(book, readingProfile(book))} стр.</span>
                         <span>${new Date(book.created_at * 1000).toLocaleDateString()}</span>
                     </div>
                     <button class="read-btn" data-id="${book.id}">Читать</button>
@@ -255,12 +261,24 @@ function renderBooks() {
     });
 }
 
+async function fetchBook(bookId) {
+    try {
+        const response = await fetch(`${API.BOOK_LIST}?id=${bookId}`);
+        if (response.ok) {
+            return await response.json();
+        }
+    } catch (error) {
+        console.error('Error loading book:', error);
+    }
+    return null;
+}
+
 async function loadBookProgress(bookId) {
     try {
         const token = localStorage.getItem('token');
         if (!token) return 1;
 
-        const response = await fetch(`${API.BOOK_PROGRESS_GET}?id=${bookId}`, {
+        const response = await fetch(`${API.BOOK_PROGRESS_GET}?id=${bookId}&profile=${state.profile}`, {
             headers: {
                 'Authorization': `Bearer ${token}`
             }
@@ -289,7 +307,8 @@ async function saveBookProgress(bookId, page) {
             },
             body: JSON.stringify({
                 book_id: bookId,
-                page: page
+                page: page,
+                profile: state.profile
             })
         });
     } catch (error) {
@@ -311,19 +330,24 @@ async function openBook(bookId) {
         return;
     }
 
-    const book = state.books.find(b => b.id == bookId);
+    let book = state.books.find(b => b.id == bookId);
     if (!book) return;
 
+    if (!bookPages(book, readingProfile(book))) {
+        book = await fetchBook(bookId) || book;
+    }
+
     state.currentBook = book;
     state.currentPage = 1;
+    state.profile = readingProfile(book);
 
     state.currentPage = await loadBookProgress(bookId);
 
     if (state.currentUser) {
         if (state.currentUser.role_name === 'user') {
-            state.totalPages = Math.min(15, book.pages);
+            state.totalPages = Math.min(15, bookPages(book, state.profile));
         } else {
-            state.totalPages = book.pages;
+            state.totalPages = bookPages(book, state.profile);
         }
     } else {
         return;
@@ -335,6 +359,21 @@ async function openBook(bookId) {
     loadBookPage();
 }
 
+function readingProfile(book) {
+    const width = window.innerWidth;
+    const profile = width < 768 ? 'phone' : width < 1280 ? 'tablet' : 'desktop';
+    const profiles = Object.keys(book.pages || {});
+
+    if (profiles.includes(profile) || profiles.length === 0) {
+        return profile;
+    }
+    return profiles[0];
+}
+
+function bookPages(book, profile) {
+    return (book.pages && book.pages[profile]) || 0;
+}
+
 function toggleReaderMode(isReading) {
     if (isReading) {
         document.querySelectorAll('#bookListSection, #uploadSection, #adminSection').forEach(el => {
@@ -367,7 +406,7 @@ async function loadBookPage() {
     }
 
     try {
-        const response = await fetch(`${API.BOOK_READ}?id=${state.currentBook.id}&page=${state.currentPage}`,
+        const response = await fetch(`${API.BOOK_READ}?id=${state.currentBook.id}&page=${state.currentPage}&profile=${state.profile}`,
             {
                 headers: {
                     'Authorization': `Bearer ${token}`
@@ -572,11 +611,11 @@ async function handleUpload(e) {
 
     if (fileInput.files.length) {
         const file = fileInput.files[0];
-        const allowedExtensions = ['.fb2', '.epub'];
+        const allowedExtensions = ['.fb2', '.epub', '.mobi', '.azw', '.azw3', '.pdf', '.txt', '.md', '.markdown', '.html', '.htm', '.zip', '.fbz'];
         const extension = file.name.slice(file.name.lastIndexOf('.')).toLowerCase();
 
         if (!allowedExtensions.includes(extension)) {
-            alert('Поддерживаются только файлы .fb2 и .epub');
+            alert('Поддерживаются только файлы .fb2, .epub, .mobi, .azw, .azw3, .pdf, .txt, .md, .html и архивы .zip');
             return;
         }
         formData.append('file', file);
@@ -621,15 +660,46 @@ async function handleUpload(e) {
         }
 
         elements.uploadForm.reset();
+        submitBtn.textContent = 'Обработка...';
+
+        const job = await waitForImport(await response.json(), token);
+        submitBtn.disabled = false;
+        submitBtn.textContent = originalBtnText;
+
+        if (job.status === 'failed') {
+            throw new Error(`Ошибка обработки книги: ${job.error}`);
+        }
+
         fetchBooks();
 
-        alert('Книга успешно загружена!')
+        alert(job.duplicate ? 'Такая книга уже есть в библиотеке' : 'Книга успешно загружена!')
     } catch (error) {
         console.error('Upload error:', error);
         alert(error.message || 'Ошибка загрузки книги');
     }
 }
 
+async function waitForImport(job, token) {
+    while (job.status === 'queued' || job.status === 'processing') {
+        await new Promise(resolve => setTimeout(resolve, 2000));
+
+        const response = await fetch(`${API.IMPORT_STATUS}?job=${job.id}`, {
+            headers: {
+                'Authorization': `Bearer ${token}`
+            }
+        });
+
+        if (!response.ok) {
+            const errorData = await response.json();
+            throw new Error(errorData.message || 'Ошибка проверки загрузки');
+        }
+
+        job = await response.json();
+    }
+
+    return job;
+}
+
 async function fetchUsers() {
     try {
         const token = localStorage.getItem('token');
@@ -3,4 +3,5 @@ package model
 type Response struct {
 	Code    int    `json:"code"`
 	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
 }
@@ -15,3 +15,10 @@ func Responsef(ctx *fiber.Ctx, code int, message string, params ...any) error {
 	r := &model.Response{Code: code, Message: fmt.Sprintf(message, params...)}
 	return ctx.Status(code).JSON(r)
 }
+
+// ResponseDetails responds with a message and what the client needs to know
+// to act on it, such as why its request was not valid.
+func ResponseDetails(ctx *fiber.Ctx, code int, message string, details any) error {
+	r := &model.Response{Code: code, Message: message, Details: details}
+	return ctx.Status(code).JSON(r)
+}
@@ -4,6 +4,7 @@ import (
 	"BookStore/internal/common/config"
 	"BookStore/internal/common/utils"
 	"BookStore/internal/control/service"
+	dbmodel "BookStore/internal/database/model"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -47,6 +48,13 @@ func NewApiHandler(
 
 	b := ah.router.Group("/book")
 	b.Get("/list", ah.getBook)
+	b.Get("/cover", ah.getCover)
+	ah.router.Get("/authors", ah.getCatalog(dbmodel.CatalogAuthors))
+	ah.router.Get("/authors/books", ah.getCatalogBooks(dbmodel.CatalogAuthors))
+	ah.router.Get("/series", ah.getCatalog(dbmodel.CatalogSeries))
+	ah.router.Get("/series/books", ah.getCatalogBooks(dbmodel.CatalogSeries))
+	ah.router.Get("/genres", ah.getCatalog(dbmodel.CatalogGenres))
+	ah.router.Get("/genres/books", ah.getCatalogBooks(dbmodel.CatalogGenres))
 	ah.router.Post("/registration", ah.registration)
 	ah.router.Post("/login", ah.login)
 
@@ -74,10 +82,28 @@ func NewApiHandler(
 	admin.Put("/role/set", ah.updateRole)
 	admin.Get("/role/list", ah.roles)
 	admin.Delete("/user/delete", ah.deleteUser)
+	admin.Post("/book/reprocess", ah.reprocessBooks)
+	admin.Get("/book/duplicates", ah.getDuplicates)
+	admin.Post("/book/merge", ah.mergeBooks)
+	admin.Put("/authors/rename", ah.renameCatalogEntry(dbmodel.CatalogAuthors))
+	admin.Post("/authors/merge", ah.mergeCatalogEntries(dbmodel.CatalogAuthors))
+	admin.Put("/series/rename", ah.renameCatalogEntry(dbmodel.CatalogSeries))
+	admin.Post("/series/merge", ah.mergeCatalogEntries(dbmodel.CatalogSeries))
+	admin.Put("/genres/rename", ah.renameCatalogEntry(dbmodel.CatalogGenres))
+	admin.Post("/genres/merge", ah.mergeCatalogEntries(dbmodel.CatalogGenres))
 
 	b.Post("/upload", ah.uploadBook)
+	b.Get("/import/status", ah.getImportStatus)
+	b.Post("/import/retry", ah.retryImport)
 	b.Delete("/delete", ah.deleteBook)
+	b.Put("/update", ah.updateBook)
+	b.Get("/history", ah.getBookHistory)
 	b.Get("/read", ah.getBookPage)
+	b.Get("/toc", ah.getToc)
+	b.Get("/chapter", ah.getChapter)
+	b.Get("/image", ah.getImage)
+	b.Get("/note", ah.getNote)
+	b.Get("/download", ah.downloadBook)
 	b.Post("/progress/set", ah.saveProgress)
 	b.Get("/progress/get", ah.getProgress)
 
@@ -3,22 +3,51 @@ package api
 import (
 	"BookStore/internal/common/utils"
 	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/reader"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
+	"net/url"
 	"strconv"
 	"strings"
 )
 
+// freePages is how many pages of a book the user role can read, counted in
+// the default pagination profile whatever profile the book is read in.
+const freePages = 15
+
+// rasterTypes are the image types served inline. Other images, SVG above
+// all, may run scripts in the page of the site and are only served as
+// attachments in a sandbox.
+var rasterTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// setImageHeaders sets the headers of an image taken from a book.
+func setImageHeaders(ctx *fiber.Ctx, contentType string) {
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if !rasterTypes[contentType] {
+		ctx.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+		ctx.Set(fiber.HeaderContentDisposition, "attachment")
+	}
+}
+
 // @Summary	upload book
 // @ID			uploadBook
 // @Accept		json
 // @Param		params	body		model.UploadBookCommand	true	"Upload command"	request
 // @Failure	500		{object}	model.Response			"Internal Server Error"
-// @Failure	400		{object}	model.Response			"Bad Request"
+// @Failure	400		{object}	model.Response			"Bad Request, details hold the validation error"
 // @Failure	401		{object}	model.Response			"Unauthorized"
-// @Success	200		{object}	string					"OK"
+// @Failure	413		{object}	model.Response			"File too large"
+// @Success	200		{object}	model.ImportJob			"Data"
 // @Router		/book/upload [post]
 func (ah *ApiHandler) uploadBook(ctx *fiber.Ctx) error {
 	user, err := ah.getUserFromContext(ctx)
@@ -43,13 +72,12 @@ func (ah *ApiHandler) uploadBook(ctx *fiber.Ctx) error {
 			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
 		}
 
-		if err := ah.srv.Books.UploadBookLocal(ctx, file, user); err != nil {
-			log.Errorf("failed to upload book: %v", err)
-			wrapErr := fmt.Errorf("failed to upload book: %v", err)
-			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		job, err := ah.srv.Books.UploadBookLocal(ctx, file, user)
+		if err != nil {
+			return uploadError(ctx, err)
 		}
 
-		return utils.Response(ctx, fiber.StatusOK, "OK")
+		return ctx.JSON(job)
 	}
 
 	if strings.Contains(contentType, "application/json") {
@@ -61,18 +89,105 @@ func (ah *ApiHandler) uploadBook(ctx *fiber.Ctx) error {
 			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
 		}
 
-		if err := ah.srv.Books.UploadBookUrl(url, user); err != nil {
-			log.Errorf("failed to upload book: %v", err)
-			wrapErr := fmt.Errorf("failed to upload book: %v", err)
-			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		job, err := ah.srv.Books.UploadBookUrl(url, user)
+		if err != nil {
+			return uploadError(ctx, err)
 		}
 
-		return utils.Response(ctx, fiber.StatusOK, "OK")
+		return ctx.JSON(job)
 	}
 
 	return utils.Response(ctx, fiber.StatusBadRequest, "invalid content-type")
 }
 
+// uploadError responds to a failed upload, with the reason in details when
+// the file was not valid.
+func uploadError(ctx *fiber.Ctx, err error) error {
+	wrapErr := fmt.Errorf("failed to upload book: %v", err)
+
+	var invalid *reader.ValidationError
+	if errors.As(err, &invalid) {
+		log.Debugf("invalid upload: %v", err)
+		code := fiber.StatusBadRequest
+		if invalid.Code == reader.CodeFileTooLarge {
+			code = fiber.StatusRequestEntityTooLarge
+		}
+		return utils.ResponseDetails(ctx, code, wrapErr.Error(), invalid)
+	}
+
+	log.Errorf("failed to upload book: %v", err)
+	return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+}
+
+// @Summary	get book import status
+// @ID			getImportStatus
+// @Accept		json
+// @Param		job	query		int				true	"Import job id"	request
+// @Failure	500	{object}	model.Response	"Internal Server Error"
+// @Failure	400	{object}	model.Response	"Bad Request"
+// @Failure	401	{object}	model.Response	"Unauthorized"
+// @Failure	404	{object}	model.Response	"Not Found"
+// @Success	200	{object}	model.ImportJob	"Data"
+// @Router		/book/import/status [get]
+func (ah *ApiHandler) getImportStatus(ctx *fiber.Ctx) error {
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	id, err := strconv.Atoi(ctx.Query("job"))
+	if err != nil {
+		log.Errorf("failed to get job id: %v", err)
+		wrapErr := fmt.Errorf("failed to get job id: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	job, err := ah.srv.Books.GetImportJob(id, user)
+	if err != nil {
+		log.Errorf("failed to get import job: %v", err)
+		wrapErr := fmt.Errorf("failed to get import job: %v", err)
+		return utils.Response(ctx, fiber.StatusNotFound, wrapErr.Error())
+	}
+
+	return ctx.JSON(job)
+}
+
+// @Summary	retry failed book import
+// @ID			retryImport
+// @Accept		json
+// @Param		job	query		int				true	"Import job id"	request
+// @Failure	500	{object}	model.Response	"Internal Server Error"
+// @Failure	400	{object}	model.Response	"Bad Request"
+// @Failure	401	{object}	model.Response	"Unauthorized"
+// @Success	200	{object}	model.ImportJob	"Data"
+// @Router		/book/import/retry [post]
+func (ah *ApiHandler) retryImport(ctx *fiber.Ctx) error {
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	id, err := strconv.Atoi(ctx.Query("job"))
+	if err != nil {
+		log.Errorf("failed to get job id: %v", err)
+		wrapErr := fmt.Errorf("failed to get job id: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	job, err := ah.srv.Books.RetryImport(id, user)
+	if err != nil {
+		log.Errorf("failed to retry import: %v", err)
+		wrapErr := fmt.Errorf("failed to retry import: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	return ctx.JSON(job)
+}
+
 // @Summary	get books
 // @ID			getBook
 // @Accept		json
@@ -154,11 +269,151 @@ func (ah *ApiHandler) deleteBook(ctx *fiber.Ctx) error {
 	return utils.Response(ctx, fiber.StatusOK, "OK")
 }
 
+// @Summary	update book
+// @ID			updateBook
+// @Accept		json
+// @Param		params	body		model.UpdateBookCommand	true	"Book and the metadata to change"	request
+// @Failure	500		{object}	model.Response			"Internal Server Error"
+// @Failure	400		{object}	model.Response			"Bad Request"
+// @Failure	401		{object}	model.Response			"Unauthorized"
+// @Success	200		{object}	model.Book				"Updated book"
+// @Router		/book/update [put]
+func (ah *ApiHandler) updateBook(ctx *fiber.Ctx) error {
+	var cmd model.UpdateBookCommand
+	if err := ctx.BodyParser(&cmd); err != nil {
+		log.Errorf("failed to unmarshal json: %v", err)
+		wrapErr := fmt.Errorf("failed to unmarshal json: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	book, err := ah.srv.Books.UpdateBook(&cmd, user)
+	if err != nil {
+		log.Errorf("failed to update book: %v", err)
+		wrapErr := fmt.Errorf("failed to update book: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	return ctx.JSON(book)
+}
+
+// @Summary	get book history
+// @ID			getBookHistory
+// @Accept		json
+// @Param		id	query		int					true	"Book id"	request
+// @Failure	500	{object}	model.Response		"Internal Server Error"
+// @Failure	400	{object}	model.Response		"Bad Request"
+// @Failure	401	{object}	model.Response		"Unauthorized"
+// @Success	200	{array}		model.BookEdit		"Edits of the book, the last first"
+// @Router		/book/history [get]
+func (ah *ApiHandler) getBookHistory(ctx *fiber.Ctx) error {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to get book id: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	edits, err := ah.srv.Books.GetBookHistory(id, user)
+	if err != nil {
+		log.Errorf("failed to get book history: %v", err)
+		wrapErr := fmt.Errorf("failed to get book history: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	return ctx.JSON(edits)
+}
+
+// @Summary	reprocess books
+// @ID			reprocessBooks
+// @Accept		json
+// @Failure	500	{object}	model.Response		"Internal Server Error"
+// @Failure	401	{object}	model.Response		"Unauthorized"
+// @Success	202	{object}	model.ImportJob		"Reprocess job, its status is read from /book/import/status"
+// @Router		/admin/book/reprocess [post]
+func (ah *ApiHandler) reprocessBooks(ctx *fiber.Ctx) error {
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	job, err := ah.srv.Books.ReprocessBooks(user)
+	if err != nil {
+		log.Errorf("failed to reprocess books: %v", err)
+		wrapErr := fmt.Errorf("failed to reprocess books: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// @Summary	get likely duplicate books
+// @ID			getDuplicates
+// @Accept		json
+// @Failure	500	{object}	model.Response	"Internal Server Error"
+// @Failure	401	{object}	model.Response	"Unauthorized"
+// @Success	200	{array}		[]model.Book	"Groups of books with the same title and author"
+// @Router		/admin/book/duplicates [get]
+func (ah *ApiHandler) getDuplicates(ctx *fiber.Ctx) error {
+	duplicates, err := ah.srv.Books.GetDuplicates()
+	if err != nil {
+		log.Errorf("failed to get duplicates: %v", err)
+		wrapErr := fmt.Errorf("failed to get duplicates: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return ctx.JSON(duplicates)
+}
+
+// @Summary	merge books
+// @ID			mergeBooks
+// @Accept		json
+// @Param		params	body		model.MergeBooksCommand	true	"Book to keep and books merged into it"	request
+// @Failure	500		{object}	model.Response			"Internal Server Error"
+// @Failure	400		{object}	model.Response			"Bad Request"
+// @Failure	401		{object}	model.Response			"Unauthorized"
+// @Success	200		{object}	string					"OK"
+// @Router		/admin/book/merge [post]
+func (ah *ApiHandler) mergeBooks(ctx *fiber.Ctx) error {
+	var cmd model.MergeBooksCommand
+	if err := ctx.BodyParser(&cmd); err != nil {
+		log.Errorf("failed to unmarshal json: %v", err)
+		wrapErr := fmt.Errorf("failed to unmarshal json: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	if err := ah.srv.Books.MergeBooks(cmd.Into, cmd.Ids); err != nil {
+		log.Errorf("failed to merge books: %v", err)
+		wrapErr := fmt.Errorf("failed to merge books: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return utils.Response(ctx, fiber.StatusOK, "OK")
+}
+
 // @Summary	get book page
 // @ID			getBookPage
 // @Accept		json
-// @Param		id		query		int				true	"Book id"		request
-// @Param		page	query		int				true	"Page number"	request
+// @Param		id		query		int				true	"Book id"			request
+// @Param		page	query		int				false	"Page number"		request
+// @Param		chapter	query		int				false	"Chapter number"	request
+// @Param		format	query		string			false	"Page format: text (default) or blocks"	request
+// @Param		profile	query		string			false	"Pagination profile, e.g. phone, tablet or desktop"	request
 // @Failure	500		{object}	model.Response	"Internal Server Error"
 // @Failure	400		{object}	model.Response	"Bad Request"
 // @Failure	401		{object}	model.Response	"Unauthorized"
@@ -167,7 +422,9 @@ func (ah *ApiHandler) deleteBook(ctx *fiber.Ctx) error {
 func (ah *ApiHandler) getBookPage(ctx *fiber.Ctx) error {
 	id := ctx.Query("id")
 	page := ctx.Query("page")
-	if id == "" || page == "" {
+	chapter := ctx.Query("chapter")
+	profile := ctx.Query("profile")
+	if id == "" || (page == "" && chapter == "") {
 		log.Errorf("failed to get book page")
 		wrapErr := fmt.Errorf("failed to get book page")
 		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
@@ -180,13 +437,261 @@ func (ah *ApiHandler) getBookPage(ctx *fiber.Ctx) error {
 		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
 	}
 
-	pageInt, err := strconv.Atoi(page)
+	var pageInt int
+	if page != "" {
+		pageInt, err = strconv.Atoi(page)
+		if err != nil {
+			log.Errorf("failed to convert page to int: %v", err)
+			wrapErr := fmt.Errorf("failed to convert page to int: %v", err)
+			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		}
+	} else {
+		chapterInt, err := strconv.Atoi(chapter)
+		if err != nil {
+			log.Errorf("failed to convert chapter to int: %v", err)
+			wrapErr := fmt.Errorf("failed to convert chapter to int: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		chapterPage, err := ah.srv.Books.GetChapterPage(idInt, chapterInt, profile)
+		if err != nil {
+			log.Errorf("failed to get chapter page: %v", err)
+			wrapErr := fmt.Errorf("failed to get chapter page: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+		pageInt = int(chapterPage)
+	}
+
+	user, err := ah.getUserFromContext(ctx)
 	if err != nil {
-		log.Errorf("failed to convert page to int: %v", err)
-		wrapErr := fmt.Errorf("failed to convert page to int: %v", err)
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
 		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
 	}
 
+	if user == nil {
+		log.Errorf("unauthorized")
+		wrapErr := fmt.Errorf("unauthorized")
+		return utils.Response(ctx, fiber.StatusUnauthorized, wrapErr.Error())
+	}
+
+	if user.Role != "super" && user.Role != "admin" {
+		free, err := ah.srv.Books.GetFreePages(idInt, freePages, profile)
+		if err != nil {
+			log.Errorf("failed to get free pages: %v", err)
+			wrapErr := fmt.Errorf("failed to get free pages: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		if pageInt > int(free) {
+			log.Errorf("not allowed")
+			wrapErr := fmt.Errorf("not allowed")
+			return utils.Response(ctx, fiber.StatusForbidden, wrapErr.Error())
+		}
+	}
+
+	if ctx.Query("format") == "blocks" {
+		blocks, err := ah.srv.Books.GetBookPageBlocks(idInt, uint(pageInt), profile)
+		if err != nil {
+			log.Errorf("failed to get book page: %v", err)
+			wrapErr := fmt.Errorf("failed to get book page: %v", err)
+			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		}
+
+		return ctx.JSON(blocks)
+	}
+
+	bookPage, err := ah.srv.Books.GetBookPage(idInt, uint(pageInt), profile)
+	if err != nil {
+		log.Errorf("failed to get book page: %v", err)
+		wrapErr := fmt.Errorf("failed to get book page: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return ctx.JSON(bookPage)
+}
+
+// @Summary	get book chapter
+// @ID			getChapter
+// @Accept		json
+// @Param		id		query		int					true	"Book id"											request
+// @Param		n		query		int					true	"Chapter number"									request
+// @Param		profile	query		string				false	"Pagination profile, e.g. phone, tablet or desktop"	request
+// @Failure	500	{object}	model.Response		"Internal Server Error"
+// @Failure	400	{object}	model.Response		"Bad Request"
+// @Failure	401	{object}	model.Response		"Unauthorized"
+// @Failure	403	{object}	model.Response		"Forbidden"
+// @Success	200	{object}	model.ChapterText	"Data"
+// @Router		/book/chapter [get]
+func (ah *ApiHandler) getChapter(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	n := ctx.Query("n")
+	profile := ctx.Query("profile")
+	if id == "" || n == "" {
+		log.Errorf("failed to get book chapter")
+		wrapErr := fmt.Errorf("failed to get book chapter")
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert id to int: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	nInt, err := strconv.Atoi(n)
+	if err != nil {
+		log.Errorf("failed to convert chapter to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert chapter to int: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	user, err := ah.getUserFromContext(ctx)
+	if err != nil {
+		log.Errorf("failed to get user: %v", err)
+		wrapErr := fmt.Errorf("failed to get user: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	if user == nil {
+		log.Errorf("unauthorized")
+		wrapErr := fmt.Errorf("unauthorized")
+		return utils.Response(ctx, fiber.StatusUnauthorized, wrapErr.Error())
+	}
+
+	var maxPage uint
+	if user.Role != "super" && user.Role != "admin" {
+		page, err := ah.srv.Books.GetChapterPage(idInt, nInt, profile)
+		if err != nil {
+			log.Errorf("failed to get chapter page: %v", err)
+			wrapErr := fmt.Errorf("failed to get chapter page: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		free, err := ah.srv.Books.GetFreePages(idInt, freePages, profile)
+		if err != nil {
+			log.Errorf("failed to get free pages: %v", err)
+			wrapErr := fmt.Errorf("failed to get free pages: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		if page > free {
+			log.Errorf("not allowed")
+			wrapErr := fmt.Errorf("not allowed")
+			return utils.Response(ctx, fiber.StatusForbidden, wrapErr.Error())
+		}
+		maxPage = free
+	}
+
+	chapter, err := ah.srv.Books.GetChapter(idInt, nInt, maxPage, profile)
+	if err != nil {
+		log.Errorf("failed to get book chapter: %v", err)
+		wrapErr := fmt.Errorf("failed to get book chapter: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return ctx.JSON(chapter)
+}
+
+// @Summary	get book cover
+// @ID			getCover
+// @Produce	image/jpeg
+// @Param		id		query		int				true	"Book id"						request
+// @Param		size	query		string			false	"Cover size: small, medium or full"	request
+// @Failure	500		{object}	model.Response	"Internal Server Error"
+// @Failure	400		{object}	model.Response	"Bad Request"
+// @Failure	404		{object}	model.Response	"Not Found"
+// @Success	200		{file}		file			"Image"
+// @Router		/book/cover [get]
+func (ah *ApiHandler) getCover(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	if id == "" {
+		log.Errorf("failed to get book id")
+		wrapErr := fmt.Errorf("failed to get book id")
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert id to int: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	cover, err := ah.srv.Books.GetCover(idInt, ctx.Query("size"))
+	if err != nil {
+		log.Errorf("failed to get cover: %v", err)
+		wrapErr := fmt.Errorf("failed to get cover: %v", err)
+		return utils.Response(ctx, fiber.StatusNotFound, wrapErr.Error())
+	}
+
+	setImageHeaders(ctx, cover.ContentType)
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+
+	return ctx.Send(cover.Data)
+}
+
+// @Summary	get book image
+// @ID			getImage
+// @Produce	image/jpeg
+// @Param		id		query		int				true	"Book id"											request
+// @Param		name	query		string			true	"Image name as referenced by an image block src"	request
+// @Failure	500		{object}	model.Response	"Internal Server Error"
+// @Failure	400		{object}	model.Response	"Bad Request"
+// @Failure	401		{object}	model.Response	"Unauthorized"
+// @Failure	404		{object}	model.Response	"Not Found"
+// @Success	200		{file}		file			"Image"
+// @Router		/book/image [get]
+func (ah *ApiHandler) getImage(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	name := ctx.Query("name")
+	if id == "" || name == "" {
+		log.Errorf("failed to get book image")
+		wrapErr := fmt.Errorf("failed to get book image")
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert id to int: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	img, err := ah.srv.Books.GetImage(idInt, name)
+	if err != nil {
+		log.Errorf("failed to get image: %v", err)
+		wrapErr := fmt.Errorf("failed to get image: %v", err)
+		return utils.Response(ctx, fiber.StatusNotFound, wrapErr.Error())
+	}
+
+	setImageHeaders(ctx, img.ContentType)
+	ctx.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+
+	return ctx.Send(img.Data)
+}
+
+// @Summary	download book
+// @ID			downloadBook
+// @Produce	octet-stream
+// @Param		id		query		int				true	"Book id"																request
+// @Param		format	query		string			false	"Format to download in: the format of the book, epub, fb2 or txt"	request
+// @Failure	500		{object}	model.Response	"Internal Server Error"
+// @Failure	400		{object}	model.Response	"Bad Request"
+// @Failure	401		{object}	model.Response	"Unauthorized"
+// @Failure	403		{object}	model.Response	"Forbidden"
+// @Success	200		{file}		file			"Book file"
+// @Success	206		{file}		file			"Requested range of the book file"
+// @Router		/book/download [get]
+func (ah *ApiHandler) downloadBook(ctx *fiber.Ctx) error {
+	id, err := strconv.Atoi(ctx.Query("id"))
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to get book id: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
 	user, err := ah.getUserFromContext(ctx)
 	if err != nil {
 		log.Errorf("failed to get user: %v", err)
@@ -200,26 +705,125 @@ func (ah *ApiHandler) getBookPage(ctx *fiber.Ctx) error {
 		return utils.Response(ctx, fiber.StatusUnauthorized, wrapErr.Error())
 	}
 
-	if (user.Role != "super" && user.Role != "admin") && pageInt > 15 {
+	// the user role reads only the first pages, so it can not have the file
+	if user.Role != "super" && user.Role != "admin" {
 		log.Errorf("not allowed")
 		wrapErr := fmt.Errorf("not allowed")
 		return utils.Response(ctx, fiber.StatusForbidden, wrapErr.Error())
 	}
 
-	bookPage, err := ah.srv.Books.GetBookPage(idInt, uint(pageInt))
+	file, err := ah.srv.Books.DownloadBook(id, ctx.Query("format"))
 	if err != nil {
-		log.Errorf("failed to get book page: %v", err)
-		wrapErr := fmt.Errorf("failed to get book page: %v", err)
+		log.Errorf("failed to download book: %v", err)
+		wrapErr := fmt.Errorf("failed to download book: %v", err)
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	ctx.Set(fiber.HeaderContentDisposition, contentDisposition(file.Name))
+	if err := ctx.SendFile(file.Path); err != nil {
+		log.Errorf("failed to send book: %v", err)
+		wrapErr := fmt.Errorf("failed to send book: %v", err)
 		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
 	}
 
-	return ctx.JSON(bookPage)
+	// SendFile sets the content type by the extension, which it does not
+	// know for every format
+	if ctx.Response().StatusCode() < fiber.StatusMultipleChoices {
+		ctx.Set(fiber.HeaderContentType, file.ContentType)
+	}
+
+	return nil
+}
+
+// contentDisposition makes an attachment header for the file name, with a
+// plain ASCII name for clients that do not read the encoded one.
+func contentDisposition(name string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, ascii, strings.ReplaceAll(url.QueryEscape(name), "+", "%20"))
+}
+
+// @Summary	get book note
+// @ID			getNote
+// @Accept		json
+// @Param		id	query		int				true	"Book id"										request
+// @Param		ref	query		string			true	"Note ref, the href of a note reference inline"	request
+// @Failure	500	{object}	model.Response	"Internal Server Error"
+// @Failure	400	{object}	model.Response	"Bad Request"
+// @Failure	401	{object}	model.Response	"Unauthorized"
+// @Failure	404	{object}	model.Response	"Not Found"
+// @Success	200	{object}	model.Note		"Data"
+// @Router		/book/note [get]
+func (ah *ApiHandler) getNote(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	ref := ctx.Query("ref")
+	if id == "" || ref == "" {
+		log.Errorf("failed to get book note")
+		wrapErr := fmt.Errorf("failed to get book note")
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert id to int: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	note, err := ah.srv.Books.GetNote(idInt, ref)
+	if err != nil {
+		log.Errorf("failed to get note: %v", err)
+		wrapErr := fmt.Errorf("failed to get note: %v", err)
+		return utils.Response(ctx, fiber.StatusNotFound, wrapErr.Error())
+	}
+
+	return ctx.JSON(note)
+}
+
+// @Summary	get book table of contents
+// @ID			getToc
+// @Accept		json
+// @Param		id		query		int				true	"Book id"											request
+// @Param		profile	query		string			false	"Pagination profile, e.g. phone, tablet or desktop"	request
+// @Failure	500		{object}	model.Response	"Internal Server Error"
+// @Failure	400		{object}	model.Response	"Bad Request"
+// @Failure	401		{object}	model.Response	"Unauthorized"
+// @Success	200		{array}		model.Chapter	"Data"
+// @Router		/book/toc [get]
+func (ah *ApiHandler) getToc(ctx *fiber.Ctx) error {
+	id := ctx.Query("id")
+	if id == "" {
+		log.Errorf("failed to get book id")
+		wrapErr := fmt.Errorf("failed to get book id")
+		return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+	}
+
+	idInt, err := strconv.Atoi(id)
+	if err != nil {
+		log.Errorf("failed to convert id to int: %v", err)
+		wrapErr := fmt.Errorf("failed to convert id to int: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	toc, err := ah.srv.Books.GetToc(idInt, ctx.Query("profile"))
+	if err != nil {
+		log.Errorf("failed to get table of contents: %v", err)
+		wrapErr := fmt.Errorf("failed to get table of contents: %v", err)
+		return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+	}
+
+	return ctx.JSON(toc)
 }
 
 // @Summary	get book progress
 // @ID			saveProgress
 // @Accept		json
-// @Param		params	body		model.UploadBookCommand	true	"Save progress command"	request
+// @Param		params	body		model.SaveProgress	true	"Save progress command"	request
 // @Failure	500		{object}	model.Response	"Internal Server Error"
 // @Failure	400		{object}	model.Response	"Bad Request"
 // @Failure	401		{object}	model.Response	"Unauthorized"
@@ -261,6 +865,7 @@ func (ah *ApiHandler) saveProgress(ctx *fiber.Ctx) error {
 // @ID			getProgress
 // @Accept		json
 // @Param		id		query		int				true	"Book id"		request
+// @Param		profile	query		string			false	"Pagination profile the current page is given in"	request
 // @Failure	500		{object}	model.Response	"Internal Server Error"
 // @Failure	400		{object}	model.Response	"Bad Request"
 // @Failure	401		{object}	model.Response	"Unauthorized"
@@ -289,7 +894,7 @@ func (ah *ApiHandler) getProgress(ctx *fiber.Ctx) error {
 		return utils.Response(ctx, fiber.StatusUnauthorized, wrapErr.Error())
 	}
 
-	progress, err := ah.srv.Books.GetProgress(user.ID, idInt)
+	progress, err := ah.srv.Books.GetProgress(user.ID, idInt, ctx.Query("profile"))
 	if err != nil {
 		log.Errorf("failed to get progress: %v", err)
 		wrapErr := fmt.Errorf("failed to get progress: %v", err)
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"BookStore/internal/common/utils"
+	"BookStore/internal/control/model"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"strconv"
+)
+
+// @Summary	get authors, series or genres
+// @Accept		json
+// @Failure	500	{object}	model.Response			"Internal Server Error"
+// @Success	200	{array}		model.CatalogEntry		"Entries with the number of their books"
+// @Router		/authors [get]
+// @Router		/series [get]
+// @Router		/genres [get]
+func (ah *ApiHandler) getCatalog(kind string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		entries, err := ah.srv.Books.GetCatalog(kind)
+		if err != nil {
+			log.Errorf("failed to get %s: %v", kind, err)
+			wrapErr := fmt.Errorf("failed to get %s: %v", kind, err)
+			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		}
+
+		return ctx.JSON(entries)
+	}
+}
+
+// @Summary	get books of an author, series or genre
+// @Accept		json
+// @Param		id	query		int				true	"Author, series or genre id"	request
+// @Failure	500	{object}	model.Response	"Internal Server Error"
+// @Failure	400	{object}	model.Response	"Bad Request"
+// @Success	200	{array}		model.Book		"Books"
+// @Router		/authors/books [get]
+// @Router		/series/books [get]
+// @Router		/genres/books [get]
+func (ah *ApiHandler) getCatalogBooks(kind string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id, err := strconv.Atoi(ctx.Query("id"))
+		if err != nil {
+			log.Errorf("failed to convert id to int: %v", err)
+			wrapErr := fmt.Errorf("failed to get id: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		books, err := ah.srv.Books.GetCatalogBooks(kind, id)
+		if err != nil {
+			log.Errorf("failed to get books: %v", err)
+			wrapErr := fmt.Errorf("failed to get books: %v", err)
+			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		}
+
+		return ctx.JSON(books)
+	}
+}
+
+// @Summary	rename an author, series or genre
+// @Accept		json
+// @Param		params	body		model.RenameCatalogCommand	true	"Entry and its new name"	request
+// @Failure	500		{object}	model.Response				"Internal Server Error"
+// @Failure	400		{object}	model.Response				"Bad Request"
+// @Failure	401		{object}	model.Response				"Unauthorized"
+// @Success	200		{object}	string						"OK"
+// @Router		/admin/authors/rename [put]
+// @Router		/admin/series/rename [put]
+// @Router		/admin/genres/rename [put]
+func (ah *ApiHandler) renameCatalogEntry(kind string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var cmd model.RenameCatalogCommand
+		if err := ctx.BodyParser(&cmd); err != nil {
+			log.Errorf("failed to unmarshal json: %v", err)
+			wrapErr := fmt.Errorf("failed to unmarshal json: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		if err := ah.srv.Books.RenameCatalogEntry(kind, cmd.Id, cmd.Name); err != nil {
+			log.Errorf("failed to rename entry: %v", err)
+			wrapErr := fmt.Errorf("failed to rename entry: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		return utils.Response(ctx, fiber.StatusOK, "OK")
+	}
+}
+
+// @Summary	merge authors, series or genres
+// @Accept		json
+// @Param		params	body		model.MergeCatalogCommand	true	"Entry to keep and entries merged into it"	request
+// @Failure	500		{object}	model.Response				"Internal Server Error"
+// @Failure	400		{object}	model.Response				"Bad Request"
+// @Failure	401		{object}	model.Response				"Unauthorized"
+// @Success	200		{object}	string						"OK"
+// @Router		/admin/authors/merge [post]
+// @Router		/admin/series/merge [post]
+// @Router		/admin/genres/merge [post]
+func (ah *ApiHandler) mergeCatalogEntries(kind string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var cmd model.MergeCatalogCommand
+		if err := ctx.BodyParser(&cmd); err != nil {
+			log.Errorf("failed to unmarshal json: %v", err)
+			wrapErr := fmt.Errorf("failed to unmarshal json: %v", err)
+			return utils.Response(ctx, fiber.StatusBadRequest, wrapErr.Error())
+		}
+
+		if err := ah.srv.Books.MergeCatalogEntries(kind, cmd.Into, cmd.Ids); err != nil {
+			log.Errorf("failed to merge entries: %v", err)
+			wrapErr := fmt.Errorf("failed to merge entries: %v", err)
+			return utils.Response(ctx, fiber.StatusInternalServerError, wrapErr.Error())
+		}
+
+		return utils.Response(ctx, fiber.StatusOK, "OK")
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"BookStore/internal/control/service/auth"
 	"BookStore/internal/control/service/books"
 	"BookStore/internal/control/service/cache"
+	"BookStore/internal/control/service/fetcher"
 	"BookStore/internal/control/service/reader"
+	"BookStore/internal/control/service/storage"
 	"BookStore/internal/control/service/users"
 	"BookStore/internal/database"
 	"context"
@@ -19,7 +21,9 @@ import (
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 type app struct {
@@ -27,9 +31,10 @@ type app struct {
 	cancel   context.CancelFunc
 	stopChan chan struct{}
 
-	fApp *fiber.App
-	api  *api.ApiHandler
-	srv  service.Services
+	fApp   *fiber.App
+	api    *api.ApiHandler
+	srv    service.Services
+	limits reader.Limits
 }
 
 //	@title			Swagger Book API
@@ -45,7 +50,6 @@ func Run(cfg *config.BaseConfig) (err error) {
 	a := &app{
 		ctx:      ctx,
 		cancel:   cancel,
-		fApp:     newFiberApp(cfg),
 		stopChan: make(chan struct{}),
 	}
 
@@ -60,6 +64,16 @@ func Run(cfg *config.BaseConfig) (err error) {
 	if err := a.initServices(); err != nil {
 		return fmt.Errorf("init services: %w", err)
 	}
+	a.fApp = newFiberApp(cfg, a.limits)
+
+	// progress in books that can not be read now is converted on next start
+	if err := a.srv.Books.MigrateProgress(); err != nil {
+		log.Errorf("migrate progress: %v", err)
+	}
+
+	if err := a.runImports(); err != nil {
+		return fmt.Errorf("run imports: %w", err)
+	}
 
 	a.api, err = api.NewApiHandler(cfg, a.fApp.Group("/api/v1"), a.srv)
 	if err != nil {
@@ -114,8 +128,12 @@ func (a *app) listen() {
 	}()
 }
 
-func newFiberApp(cfg *config.BaseConfig) *fiber.App {
-	app := fiber.New()
+func newFiberApp(cfg *config.BaseConfig, limits reader.Limits) *fiber.App {
+	app := fiber.New(fiber.Config{
+		// room for the rest of a multipart upload, the file itself is
+		// checked against the limit by the upload
+		BodyLimit: int(limits.MaxFileSize) + 1<<20,
+	})
 	if cfg.Swagger {
 		docs.SwaggerInfo.Title = "Swagger BookStore API"
 		docs.SwaggerInfo.Version = "1.0"
@@ -127,18 +145,126 @@ func newFiberApp(cfg *config.BaseConfig) *fiber.App {
 }
 
 func (a *app) initServices() (err error) {
+	profiles, err := reader.ParseProfiles(os.Getenv("PAGE_PROFILES"))
+	if err != nil {
+		return fmt.Errorf("page profiles: %w", err)
+	}
+
+	a.limits, err = uploadLimits()
+	if err != nil {
+		return fmt.Errorf("upload limits: %w", err)
+	}
+
 	var srv service.Services
+	srv.Storage, err = newStorage()
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	fetch, err := newFetcher()
+	if err != nil {
+		return fmt.Errorf("url import: %w", err)
+	}
+
 	srv.Auth = auth.NewService()
 	srv.User = users.NewService()
 	srv.Cache = cache.NewService()
 	srv.Reader = reader.NewService(
 		reader.WithCache(srv.Cache),
+		reader.WithStorage(srv.Storage),
+		reader.WithLimits(a.limits),
 	)
 	srv.Books = books.NewService(
 		books.WithCache(srv.Cache),
 		books.WithReader(srv.Reader),
+		books.WithStorage(srv.Storage),
+		books.WithUploadDir(os.Getenv("UPLOAD_DIR")),
+		books.WithFetcher(fetch),
+		books.WithLimits(a.limits),
+		books.WithProfiles(profiles),
 	)
 
 	a.srv = srv
 	return err
 }
+
+// defaultImportWorkers is how many books are ingested at once unless
+// IMPORT_WORKERS says otherwise.
+const defaultImportWorkers = 2
+
+func (a *app) runImports() error {
+	workers := defaultImportWorkers
+	if s := os.Getenv("IMPORT_WORKERS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid import workers %q", s)
+		}
+		workers = n
+	}
+
+	return a.srv.Books.RunImports(a.ctx, workers)
+}
+
+// defaultStorageRoot is where books are kept unless STORAGE_ROOT says
+// otherwise. With S3 storage it holds the local copies.
+const defaultStorageRoot = "/var/tmp/books"
+
+func newStorage() (storage.Storage, error) {
+	root := os.Getenv("STORAGE_ROOT")
+	if root == "" {
+		root = defaultStorageRoot
+	}
+
+	switch kind := os.Getenv("STORAGE"); kind {
+	case "", "local":
+		return storage.NewLocal(root)
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}, root)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
+
+// newFetcher makes the fetcher of url imports, which takes a timeout like
+// "5m" from URL_IMPORT_TIMEOUT and a size in bytes from URL_IMPORT_MAX_SIZE.
+func newFetcher() (*fetcher.Fetcher, error) {
+	var opts []fetcher.Option
+	if s := os.Getenv("URL_IMPORT_TIMEOUT"); s != "" {
+		timeout, err := time.ParseDuration(s)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", s)
+		}
+		opts = append(opts, fetcher.WithTimeout(timeout))
+	}
+
+	if s := os.Getenv("URL_IMPORT_MAX_SIZE"); s != "" {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid max size %q", s)
+		}
+		opts = append(opts, fetcher.WithMaxSize(size))
+	}
+
+	return fetcher.New(opts...), nil
+}
+
+// uploadLimits returns the default upload limits with the size of a file
+// taken from UPLOAD_MAX_SIZE in bytes.
+func uploadLimits() (reader.Limits, error) {
+	limits := reader.DefaultLimits
+	if s := os.Getenv("UPLOAD_MAX_SIZE"); s != "" {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size <= 0 {
+			return limits, fmt.Errorf("invalid max size %q", s)
+		}
+		limits.MaxFileSize = size
+	}
+
+	return limits, nil
+}
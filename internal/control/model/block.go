@@ -0,0 +1,54 @@
+package model
+
+const (
+	BlockHeading     = "heading"
+	BlockParagraph   = "paragraph"
+	BlockPoem        = "poem"
+	BlockStanza      = "stanza"
+	BlockVerse       = "verse"
+	BlockQuote       = "blockquote"
+	BlockEpigraph    = "epigraph"
+	BlockList        = "list"
+	BlockItem        = "item"
+	BlockImage       = "image"
+	BlockAttribution = "attribution"
+)
+
+// Block is a format-neutral piece of book content. Text blocks hold inlines,
+// container blocks (poem, stanza, blockquote, epigraph, list) hold children.
+// Footnotes are not blocks: they are kept apart as notes that inlines link to.
+type Block struct {
+	Type     string   `json:"type"`
+	Level    int      `json:"level,omitempty"`
+	ID       string   `json:"id,omitempty"`
+	Src      string   `json:"src,omitempty"`
+	Ordered  bool     `json:"ordered,omitempty"`
+	Inlines  []Inline `json:"inlines,omitempty"`
+	Children []*Block `json:"children,omitempty"`
+}
+
+type Inline struct {
+	Text     string `json:"text"`
+	Emphasis bool   `json:"emphasis,omitempty"`
+	Strong   bool   `json:"strong,omitempty"`
+	Href     string `json:"href,omitempty"`
+	Note     bool   `json:"note,omitempty"`
+}
+
+// Note is a footnote or endnote. Ref is what the Href of the inlines linking
+// to the note is set to.
+type Note struct {
+	Ref    string   `json:"ref"`
+	Title  string   `json:"title,omitempty"`
+	Text   string   `json:"text"`
+	Blocks []*Block `json:"blocks"`
+}
+
+func (b *Block) IsContainer() bool {
+	switch b.Type {
+	case BlockPoem, BlockStanza, BlockQuote, BlockEpigraph, BlockList:
+		return true
+	}
+
+	return b.Type == BlockItem && len(b.Children) > 0
+}
@@ -4,15 +4,110 @@ type UploadBookCommand struct {
 	Url string `json:"url"`
 }
 
+type MergeBooksCommand struct {
+	Into int   `json:"into"`
+	Ids  []int `json:"ids"`
+}
+
+type MergeCatalogCommand struct {
+	Into int   `json:"into"`
+	Ids  []int `json:"ids"`
+}
+
+type RenameCatalogCommand struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// UpdateBookCommand changes the metadata of the book BookId. Fields left
+// out are not changed; Series set to an empty string removes the book from
+// its series.
+type UpdateBookCommand struct {
+	BookId      int            `json:"book_id"`
+	Title       *string        `json:"title"`
+	Annotation  *string        `json:"annotation"`
+	Authors     *[]Contributor `json:"authors"`
+	Translators *[]string      `json:"translators"`
+	Series      *string        `json:"series"`
+	SeriesIndex *float64       `json:"series_index"`
+	Genres      *[]string      `json:"genres"`
+	Language    *string        `json:"language"`
+	Publisher   *string        `json:"publisher"`
+	PublishDate *string        `json:"publish_date"`
+	Identifiers *[]Identifier  `json:"identifiers"`
+}
+
+// BookInfo is the metadata read from a book file. Author is the names of
+// the authors joined for display. SeriesIndex is the number of the book in
+// the series, 0 if it has none; calibre numbers books like 1.5. PublishDate
+// is kept as the book gives it, which is often only a year.
 type BookInfo struct {
-	Title      string
-	Author     string
-	Annotation string
+	Title       string
+	Author      string
+	Annotation  string
+	Authors     []Contributor
+	Translators []string
+	Series      string
+	SeriesIndex float64
+	Genres      []string
+	Language    string
+	Publisher   string
+	PublishDate string
+	Identifiers []Identifier
+}
+
+// Contributor is a person who made the book. Role is author, editor,
+// illustrator or another MARC relator code the book gives.
+type Contributor struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Identifier is a book identifier like an ISBN or a UUID. Scheme is upper
+// case, ISBN values have no dashes.
+type Identifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+type Chapter struct {
+	Title  string `json:"title"`
+	Level  int    `json:"level"`
+	Offset uint   `json:"offset"`
+}
+
+type ChapterText struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	Level     int    `json:"level"`
+	Page      uint   `json:"page"`
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated"`
+}
+
+// BookFile is a file of a book to download: where it is, the name to save it
+// under and its content type.
+type BookFile struct {
+	Path        string
+	Name        string
+	ContentType string
+}
+
+// Locator is a reading position that does not depend on pagination: the number
+// of a table of contents entry and the offset in characters from its start.
+// Chapter 0 counts from the start of the book.
+type Locator struct {
+	Chapter int  `json:"chapter"`
+	Offset  uint `json:"offset"`
 }
 
+// SaveProgress stores the position given by Locator, or by Page of the
+// pagination profile when Locator is not set.
 type SaveProgress struct {
-	BookId int `json:"book_id"`
-	Page   int `json:"page"`
+	BookId  int      `json:"book_id"`
+	Page    int      `json:"page"`
+	Profile string   `json:"profile"`
+	Locator *Locator `json:"locator"`
 
 	userId int
 }
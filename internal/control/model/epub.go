@@ -17,23 +17,84 @@ type Container struct {
 }
 
 type Package struct {
-	Manifest struct {
+	Version          string       `xml:"version,attr"`
+	UniqueIdentifier string       `xml:"unique-identifier,attr"`
+	Metadata         EpubMetadata `xml:"metadata"`
+	Manifest         struct {
 		Items []Item `xml:"item"`
 	} `xml:"manifest"`
 	Spine struct {
+		Toc      string    `xml:"toc,attr"`
 		Itemrefs []Itemref `xml:"itemref"`
 	} `xml:"spine"`
 }
 
-type Item struct {
+// EpubMetadata holds the Dublin Core elements of the package and its meta
+// elements, which carry the EPUB 3 refinements and the calibre series.
+type EpubMetadata struct {
+	Titles       []string         `xml:"title"`
+	Creators     []EpubCreator    `xml:"creator"`
+	Contributors []EpubCreator    `xml:"contributor"`
+	Descriptions []string         `xml:"description"`
+	Subjects     []string         `xml:"subject"`
+	Languages    []string         `xml:"language"`
+	Publishers   []string         `xml:"publisher"`
+	Dates        []EpubDate       `xml:"date"`
+	Identifiers  []EpubIdentifier `xml:"identifier"`
+	Metas        []EpubMeta       `xml:"meta"`
+}
+
+type EpubCreator struct {
 	ID   string `xml:"id,attr"`
-	Href string `xml:"href,attr"`
+	Role string `xml:"role,attr"`
+	Name string `xml:",chardata"`
+}
+
+type EpubDate struct {
+	Event string `xml:"event,attr"`
+	Value string `xml:",chardata"`
+}
+
+type EpubIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type EpubMeta struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type Item struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
 }
 
 type Itemref struct {
 	IDRef string `xml:"idref,attr"`
 }
 
+type Ncx struct {
+	NavMap struct {
+		NavPoints []NavPoint `xml:"navPoint"`
+	} `xml:"navMap"`
+}
+
+type NavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	NavPoints []NavPoint `xml:"navPoint"`
+}
+
 type TextExtractor struct {
 	Tag     bool
 	Data    []string
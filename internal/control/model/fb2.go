@@ -1,18 +1,47 @@
 package model
 
+type Fb2Author struct {
+	FirstName  string `xml:"first-name"`
+	MiddleName string `xml:"middle-name"`
+	LastName   string `xml:"last-name"`
+	Nickname   string `xml:"nickname"`
+}
+
+type Fb2Sequence struct {
+	Name   string `xml:"name,attr"`
+	Number string `xml:"number,attr"`
+}
+
 type Fb2TitleInfo struct {
-	BookTitle string `xml:"book-title"`
-	Author    struct {
-		FirstName string `xml:"first-name"`
-		LastName  string `xml:"last-name"`
-	} `xml:"author"`
+	Genres     []string    `xml:"genre"`
+	Authors    []Fb2Author `xml:"author"`
+	BookTitle  string      `xml:"book-title"`
 	Annotation struct {
-		Paragraph string `xml:"p"`
+		Content string `xml:",innerxml"`
 	} `xml:"annotation"`
+	Date struct {
+		Value string `xml:"value,attr"`
+		Text  string `xml:",chardata"`
+	} `xml:"date"`
+	Lang        string        `xml:"lang"`
+	Translators []Fb2Author   `xml:"translator"`
+	Sequences   []Fb2Sequence `xml:"sequence"`
+}
+
+type Fb2PublishInfo struct {
+	BookName  string        `xml:"book-name"`
+	Publisher string        `xml:"publisher"`
+	Year      string        `xml:"year"`
+	Isbn      string        `xml:"isbn"`
+	Sequences []Fb2Sequence `xml:"sequence"`
 }
 
 type Fb2Description struct {
-	TitleInfo Fb2TitleInfo `xml:"title-info"`
+	TitleInfo    Fb2TitleInfo `xml:"title-info"`
+	DocumentInfo struct {
+		ID string `xml:"id"`
+	} `xml:"document-info"`
+	PublishInfo Fb2PublishInfo `xml:"publish-info"`
 }
 
 type Fb2Root struct {
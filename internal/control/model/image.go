@@ -0,0 +1,7 @@
+package model
+
+type Image struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
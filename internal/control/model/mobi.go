@@ -0,0 +1,49 @@
+package model
+
+const (
+	MobiCompressionNone    uint16 = 1
+	MobiCompressionPalmDoc uint16 = 2
+	MobiCompressionHuff    uint16 = 17480
+
+	MobiExthAuthor      uint32 = 100
+	MobiExthPublisher   uint32 = 101
+	MobiExthDescription uint32 = 103
+	MobiExthIsbn        uint32 = 104
+	MobiExthSubject     uint32 = 105
+	MobiExthPublishDate uint32 = 106
+	MobiExthAsin        uint32 = 113
+	MobiExthCoverOffset uint32 = 201
+	MobiExthUpdatedName uint32 = 503
+	MobiExthLanguage    uint32 = 524
+)
+
+type PalmDocHeader struct {
+	Compression    uint16
+	TextLength     uint32
+	RecordCount    uint16
+	RecordSize     uint16
+	EncryptionType uint16
+}
+
+type MobiHeader struct {
+	HeaderLength       uint32
+	MobiType           uint32
+	TextEncoding       uint32
+	Version            uint32
+	FullNameOffset     uint32
+	FullNameLength     uint32
+	HuffRecordOffset   uint32
+	HuffRecordCount    uint32
+	ExthFlags          uint32
+	ExtraRecordFlags   uint16
+	FirstNonBookRecord uint32
+	FirstImageRecord   uint32
+}
+
+type MobiBook struct {
+	PalmDoc  PalmDocHeader
+	Mobi     MobiHeader
+	FullName string
+	Exth     map[uint32][]string
+	Cover    int
+}
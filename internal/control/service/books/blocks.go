@@ -0,0 +1,142 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/reader"
+	dbmodel "BookStore/internal/database/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// bookBlocks are the blocks and notes of a book as the reader parses them.
+type bookBlocks struct {
+	Blocks []*model.Block `json:"blocks"`
+	Notes  []*model.Note  `json:"notes"`
+}
+
+// blocksPath is where the blocks and notes of a book are kept, so that pages
+// in blocks and notes are served without parsing the book file again.
+func blocksPath(bookPath string) string {
+	return bookPath + ".blocks"
+}
+
+// blockPagesPath is where the page index of the blocks is kept. The text of
+// the blocks is not the stored content, so its pages are not either.
+func blockPagesPath(bookPath, profile string) string {
+	return fmt.Sprintf("%s.%s.blockpages", bookPath, profile)
+}
+
+// removeBlocks removes the stored blocks of the book along with their page
+// indexes, which are made again from the book file on next use.
+func (b *bookService) removeBlocks(key string) {
+	path := b.storage.Path(key)
+	os.Remove(blocksPath(path))
+	b.cache.Delete(fmt.Sprintf("blocks:%s", key))
+	for _, profile := range b.profiles {
+		os.Remove(blockPagesPath(path, profile.Name))
+		b.cache.Delete(fmt.Sprintf("blockPages:%s:%s", key, profile.Name))
+	}
+}
+
+// blocks returns the stored blocks and notes of the book. Books read in
+// blocks for the first time are parsed and their blocks stored.
+func (b *bookService) blocks(book *dbmodel.Book) (*bookBlocks, error) {
+	key := fmt.Sprintf("blocks:%s", book.Filepath)
+	if val, ok := b.cache.Get(key); ok {
+		return val.(*bookBlocks), nil
+	}
+
+	path := blocksPath(b.storage.Path(book.Filepath))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = b.saveBlocks(book.Filepath, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocks: %v", err)
+	}
+
+	var stored bookBlocks
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to read blocks: %v", err)
+	}
+	b.cache.Set(key, &stored)
+
+	return &stored, nil
+}
+
+func (b *bookService) saveBlocks(key, path string) ([]byte, error) {
+	blocks, err := b.reader.ParseBlocks(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse book: %v", err)
+	}
+
+	notes, err := b.reader.GetNotes(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notes: %v", err)
+	}
+
+	data, err := json.Marshal(&bookBlocks{Blocks: blocks, Notes: notes})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// blockPages returns the page index of the blocks of the book in the
+// profile, building it if it is not stored yet.
+func (b *bookService) blockPages(book *dbmodel.Book, blocks *bookBlocks, profile reader.Profile) (*reader.PageIndex, error) {
+	key := fmt.Sprintf("blockPages:%s:%s", book.Filepath, profile.Name)
+	if val, ok := b.cache.Get(key); ok {
+		return val.(*reader.PageIndex), nil
+	}
+
+	path := blockPagesPath(b.storage.Path(book.Filepath), profile.Name)
+	index, err := reader.ReadPageIndex(path, profile)
+	if err != nil {
+		index = reader.BlockPages(blocks.Blocks, profile)
+		if err := reader.WritePageIndex(path, index); err != nil {
+			return nil, err
+		}
+	}
+	b.cache.Set(key, index)
+
+	return index, nil
+}
+
+// writeFileAtomic replaces the file at path at once, so that readers never
+// see it partly written. The data is written to a file of its own first,
+// which concurrent writers of the same path do not share.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	return nil
+}
@@ -3,49 +3,84 @@ package books
 import (
 	"BookStore/internal/control/model"
 	"BookStore/internal/control/service/cache"
+	"BookStore/internal/control/service/fetcher"
 	"BookStore/internal/control/service/reader"
+	"BookStore/internal/control/service/storage"
 	dbmodel "BookStore/internal/database/model"
 	"BookStore/internal/database/table"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 	"io"
 	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
-	"unicode"
 )
 
 type BookService interface {
-	UploadBookLocal(ctx *fiber.Ctx, file *multipart.FileHeader, user *model.UserContext) error
-	UploadBookUrl(book model.UploadBookCommand, user *model.UserContext) error
+	UploadBookLocal(ctx *fiber.Ctx, file *multipart.FileHeader, user *model.UserContext) (*dbmodel.ImportJob, error)
+	UploadBookUrl(book model.UploadBookCommand, user *model.UserContext) (*dbmodel.ImportJob, error)
+	GetImportJob(id int, user *model.UserContext) (*dbmodel.ImportJob, error)
+	RetryImport(id int, user *model.UserContext) (*dbmodel.ImportJob, error)
+	RunImports(ctx context.Context, workers int) error
 	GetBook(id int) (*dbmodel.Book, error)
 	GetBooks() ([]*dbmodel.Book, error)
 	DeleteBook(id int, user *model.UserContext) error
+	UpdateBook(cmd *model.UpdateBookCommand, user *model.UserContext) (*dbmodel.Book, error)
+	GetBookHistory(id int, user *model.UserContext) ([]*dbmodel.BookEdit, error)
+	DownloadBook(id int, format string) (*model.BookFile, error)
 	SaveProgress(command *model.SaveProgress) error
-	GetProgress(userId, bookId int) (*dbmodel.ReadingProgress, error)
-	GetBookPage(id int, pageNum uint) (string, error)
+	GetProgress(userId, bookId int, profile string) (*dbmodel.ReadingProgress, error)
+	MigrateProgress() error
+	GetBookPage(id int, pageNum uint, profile string) (string, error)
+	GetBookPageBlocks(id int, pageNum uint, profile string) ([]*model.Block, error)
+	GetToc(id int, profile string) ([]*dbmodel.Chapter, error)
+	GetChapterPage(id int, chapter int, profile string) (uint, error)
+	GetFreePages(id int, pages uint, profile string) (uint, error)
+	GetChapter(id int, chapter int, maxPage uint, profile string) (*model.ChapterText, error)
+	GetCover(id int, size string) (*model.Image, error)
+	GetImage(id int, name string) (*model.Image, error)
+	GetNote(id int, ref string) (*model.Note, error)
+	ReprocessBooks(user *model.UserContext) (*dbmodel.ImportJob, error)
+	GetDuplicates() ([][]*dbmodel.Book, error)
+	MergeBooks(into int, ids []int) error
+	GetCatalog(kind string) ([]*dbmodel.CatalogEntry, error)
+	GetCatalogBooks(kind string, id int) ([]*dbmodel.Book, error)
+	RenameCatalogEntry(kind string, id int, name string) error
+	MergeCatalogEntries(kind string, into int, ids []int) error
 }
 type Option func(*bookService)
 
 type bookService struct {
-	reader reader.BookReader
-	cache  cache.MemoryCacheService
+	reader    reader.BookIngester
+	cache     cache.MemoryCacheService
+	storage   storage.Storage
+	fetcher   *fetcher.Fetcher
+	limits    reader.Limits
+	profiles  []reader.Profile
+	uploadDir string
+	imports   chan int
 }
 
 func NewService(opts ...Option) BookService {
-	s := bookService{}
+	s := bookService{
+		profiles:  reader.DefaultProfiles,
+		uploadDir: "/var/tmp/uploads",
+		fetcher:   fetcher.New(),
+		limits:    reader.DefaultLimits,
+		imports:   make(chan int, importQueueSize),
+	}
 	for _, opt := range opts {
 		opt(&s)
 	}
 	return &s
 }
 
-func WithReader(r reader.BookReader) Option {
+func WithReader(r reader.BookIngester) Option {
 	return func(s *bookService) {
 		s.reader = r
 	}
@@ -57,138 +92,142 @@ func WithCache(c cache.MemoryCacheService) Option {
 	}
 }
 
-func (b *bookService) UploadBookLocal(ctx *fiber.Ctx, file *multipart.FileHeader, user *model.UserContext) error {
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext == ".fb2" || ext == ".epub" {
-		createTime := time.Now().Unix()
-		dir := fmt.Sprintf("/var/tmp/%s", user.Login)
-
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create dir: %v", err)
-		}
+func WithStorage(storage storage.Storage) Option {
+	return func(s *bookService) {
+		s.storage = storage
+	}
+}
 
-		dest := filepath.Join(dir, fmt.Sprintf("%d_%s", createTime, file.Filename))
-		if err := ctx.SaveFile(file, dest); err != nil {
-			return fmt.Errorf("failed to upload file: %v", err)
-		}
+func WithFetcher(f *fetcher.Fetcher) Option {
+	return func(s *bookService) {
+		s.fetcher = f
+	}
+}
 
-		count, err := b.reader.GetChaptersCount(dest)
-		if err != nil {
-			return fmt.Errorf("failed to get chapter count: %v", err)
-		}
+// WithLimits sets what an uploaded file may contain.
+func WithLimits(limits reader.Limits) Option {
+	return func(s *bookService) {
+		s.limits = limits
+	}
+}
 
-		bookInfo, err := b.reader.GetBookInfo(dest)
-		if err != nil {
-			return fmt.Errorf("failed to get book info: %v", err)
+// WithUploadDir sets where uploaded books wait for their import.
+func WithUploadDir(dir string) Option {
+	return func(s *bookService) {
+		if dir != "" {
+			s.uploadDir = dir
 		}
+	}
+}
 
-		text, err := b.reader.Parse(dest)
-		if err != nil {
-			return fmt.Errorf("failed to parse book: %v", err)
+func WithProfiles(profiles []reader.Profile) Option {
+	return func(s *bookService) {
+		if len(profiles) > 0 {
+			s.profiles = profiles
 		}
+	}
+}
 
-		runes := []rune(text)
-		pages := reader.CountPages(runes)
-
-		bookDb := &dbmodel.Book{
-			Title:      bookInfo.Title,
-			Format:     ext,
-			Author:     bookInfo.Author,
-			Annotation: bookInfo.Annotation,
-			Filepath:   dest,
-			Chapters:   count,
-			Pages:      pages,
-			CreatedAt:  createTime,
-			UserId:     user.ID,
+// UploadBookLocal saves an uploaded file and queues its import. Files that
+// break the limits are turned down with a *reader.ValidationError.
+func (b *bookService) UploadBookLocal(ctx *fiber.Ctx, file *multipart.FileHeader, user *model.UserContext) (*dbmodel.ImportJob, error) {
+	if file.Size > b.limits.MaxFileSize {
+		return nil, &reader.ValidationError{
+			Code:    reader.CodeFileTooLarge,
+			Message: fmt.Sprintf("file is larger than %d bytes", b.limits.MaxFileSize),
 		}
+	}
 
-		if err := table.Upsert(bookDb); err != nil {
-			return fmt.Errorf("failed to upsert book: %v", err)
-		}
+	dest, err := b.stagingPath(file.Filename)
+	if err != nil {
+		return nil, err
+	}
 
-		b.cache.Delete("allBooks")
+	if err := ctx.SaveFile(file, dest); err != nil {
+		os.Remove(dest)
+		return nil, fmt.Errorf("failed to upload file: %v", err)
+	}
 
-		return nil
+	if err := reader.ValidateUpload(dest, b.limits); err != nil {
+		os.Remove(dest)
+		return nil, err
 	}
 
-	return fmt.Errorf("unsupported file extension")
+	return b.newImportJob(user, "", dest, file.Filename, time.Now().Unix())
 }
 
-func (b *bookService) UploadBookUrl(book model.UploadBookCommand, user *model.UserContext) error {
+// UploadBookUrl queues the import of a book from a url, which is fetched by
+// the import worker. Urls that can never be fetched are turned down at once
+// with a *reader.ValidationError.
+func (b *bookService) UploadBookUrl(book model.UploadBookCommand, user *model.UserContext) (*dbmodel.ImportJob, error) {
 	if book.Url == "" {
-		return fmt.Errorf("empty url")
+		return nil, &reader.ValidationError{Code: reader.CodeInvalidUrl, Message: "empty url"}
 	}
 
-	resp, err := http.Get(book.Url)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to upload book: %v", err)
+	if err := b.fetcher.Check(book.Url); err != nil {
+		return nil, &reader.ValidationError{Code: reader.CodeInvalidUrl, Message: err.Error()}
 	}
-	defer resp.Body.Close()
-
-	sp := strings.Split(book.Url, "/")
-	fileName := sp[len(sp)-1]
-
-	ext := strings.ToLower(filepath.Ext(fileName))
-	if ext == ".fb2" || ext == ".epub" {
-		createTime := time.Now().Unix()
-		dir := fmt.Sprintf("/var/tmp/%s", user.Login)
 
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create dir: %v", err)
-		}
-
-		dest := filepath.Join(dir, fmt.Sprintf("%d_%s", createTime, fileName))
-		out, err := os.Create(dest)
-		if err != nil {
-			return fmt.Errorf("failed to upload file: %v", err)
-		}
-		defer out.Close()
+	return b.newImportJob(user, book.Url, "", fetcher.FileName(book.Url), time.Now().Unix())
+}
 
-		_, err = io.Copy(out, resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to upload file: %v", err)
-		}
+// stagingPath reserves a file in the upload directory for an uploaded book
+// until it is moved to the storage. The name of the file is kept at the end
+// as its extension helps to detect the format.
+func (b *bookService) stagingPath(fileName string) (string, error) {
+	if err := os.MkdirAll(b.uploadDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create dir: %v", err)
+	}
 
-		count, err := b.reader.GetChaptersCount(dest)
-		if err != nil {
-			return fmt.Errorf("failed to get chapter count: %v", err)
-		}
+	f, err := os.CreateTemp(b.uploadDir, "*_"+filepath.Base(fileName))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %v", err)
+	}
+	f.Close()
 
-		bookInfo, err := b.reader.GetBookInfo(dest)
-		if err != nil {
-			return fmt.Errorf("failed to get book info: %v", err)
-		}
+	return f.Name(), nil
+}
 
-		text, err := b.reader.Parse(dest)
-		if err != nil {
-			return fmt.Errorf("failed to parse book: %v", err)
-		}
+// addBook reads a stored book in a single pass and adds it along with its
+// content, page indexes, cover and table of contents. It returns the id of
+// the new book.
+func (b *bookService) addBook(key, hash, format string, createTime int64, userId int) (int, error) {
+	ingestion, pages, err := b.ingest(key)
+	if err != nil {
+		return 0, err
+	}
 
-		runes := []rune(text)
-		pages := reader.CountPages(runes)
-
-		bookDb := &dbmodel.Book{
-			Title:      bookInfo.Title,
-			Format:     ext,
-			Author:     bookInfo.Author,
-			Annotation: bookInfo.Annotation,
-			Filepath:   dest,
-			Chapters:   count,
-			Pages:      pages,
-			CreatedAt:  createTime,
-			UserId:     user.ID,
-		}
+	cover, err := b.saveCover(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save cover: %v", err)
+	}
 
-		if err := table.Upsert(bookDb); err != nil {
-			return fmt.Errorf("failed to upsert book: %v", err)
-		}
+	bookDb := &dbmodel.Book{
+		Title:      ingestion.Info.Title,
+		Format:     "." + format,
+		Author:     ingestion.Info.Author,
+		Annotation: ingestion.Info.Annotation,
+		Filepath:   key,
+		Hash:       hash,
+		Cover:      cover,
+		Chapters:   ingestion.ChaptersCount,
+		Pages:      pages,
+		CreatedAt:  createTime,
+		UserId:     userId,
+	}
+	setMetadata(bookDb, ingestion.Info)
 
-		b.cache.Delete("allBooks")
+	if err := table.AddBook(bookDb); err != nil {
+		return 0, fmt.Errorf("failed to upsert book: %v", err)
+	}
 
-		return nil
+	if _, err := b.saveToc(bookDb); err != nil {
+		return 0, fmt.Errorf("failed to save table of contents: %v", err)
 	}
 
-	return fmt.Errorf("invalid file extension")
+	b.cache.Delete("allBooks")
+
+	return bookDb.ID, nil
 }
 
 func (b *bookService) GetBook(id int) (*dbmodel.Book, error) {
@@ -202,6 +241,19 @@ func (b *bookService) GetBook(id int) (*dbmodel.Book, error) {
 		return nil, fmt.Errorf("failed to get book: %v", err)
 	}
 
+	// books uploaded before a profile was configured get its pages counted
+	// on first request
+	for _, profile := range b.profiles {
+		if _, ok := book.Pages[profile.Name]; ok {
+			continue
+		}
+
+		if err := b.countPages(book); err != nil {
+			return nil, err
+		}
+		break
+	}
+
 	b.cache.Set(key, book)
 
 	return book, nil
@@ -223,23 +275,34 @@ func (b *bookService) GetBooks() ([]*dbmodel.Book, error) {
 	return books, nil
 }
 
-func (b *bookService) GetBookPage(id int, pageNum uint) (string, error) {
+func (b *bookService) GetBookPage(id int, pageNum uint, profileName string) (string, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return "", err
+	}
+
 	book, err := b.GetBook(id)
 	if err != nil {
 		return "", fmt.Errorf("failed to get book: %v", err)
 	}
 
-	key := fmt.Sprintf("%s:%d", book.Filepath, pageNum)
+	key := fmt.Sprintf("%s:%s:%d", book.Filepath, profile.Name, pageNum)
 	if val, ok := b.cache.Get(key); ok {
 		return val.(string), nil
 	}
 
-	data, err := b.reader.Parse(book.Filepath)
+	index, err := b.pageIndex(book, profile)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := b.content(book)
 	if err != nil {
 		return "", err
 	}
+	defer content.Close()
 
-	page, err := b.getBookPage(data, pageNum)
+	page, err := index.Page(content, pageNum)
 	if err != nil {
 		return "", err
 	}
@@ -249,42 +312,360 @@ func (b *bookService) GetBookPage(id int, pageNum uint) (string, error) {
 	return page, nil
 }
 
-func (b *bookService) getBookPage(data string, pageNum uint) (string, error) {
-	runes := []rune(data)
-	length := uint(len(runes))
-	var start uint
-	var end uint
+func (b *bookService) GetBookPageBlocks(id int, pageNum uint, profileName string) ([]*model.Block, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
 
-	if length == 0 {
-		return "", nil
+	key := fmt.Sprintf("%s:blocks:%s:%d", book.Filepath, profile.Name, pageNum)
+	if val, ok := b.cache.Get(key); ok {
+		return val.([]*model.Block), nil
 	}
 
-	for i := uint(1); i < pageNum; i++ {
-		tmpEnd := start + reader.PageSize
-		if tmpEnd >= length {
-			tmpEnd = length
-		} else {
-			for tmpEnd < length && !unicode.IsSpace(runes[tmpEnd]) {
-				tmpEnd++
-			}
+	blocks, err := b.blocks(book)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := b.blockPages(book, blocks, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	page, ok := reader.PageBlocks(blocks.Blocks, index, pageNum)
+	if !ok {
+		return nil, fmt.Errorf("start out of bounds")
+	}
+
+	b.cache.Set(key, page)
+
+	return page, nil
+}
+
+// GetToc returns the table of contents with the page every entry starts on
+// in the given profile.
+func (b *bookService) GetToc(id int, profileName string) ([]*dbmodel.Chapter, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("bookToc:%d:%s", id, profile.Name)
+	if val, ok := b.cache.Get(key); ok {
+		return val.([]*dbmodel.Chapter), nil
+	}
+
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	chapters, err := table.GetChapters(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chapters: %v", err)
+	}
+
+	// books uploaded before chapters were stored get their table of contents
+	// built on first request
+	if len(chapters) == 0 {
+		chapters, err = b.saveToc(book)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save table of contents: %v", err)
 		}
-		start = tmpEnd
 	}
 
-	end = start + reader.PageSize
-	if end >= length {
-		end = length
-	} else {
-		for end < length && !unicode.IsSpace(runes[end]) {
-			end++
+	index, err := b.pageIndex(book, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range chapters {
+		c.Page = index.PageForOffset(c.Offset)
+	}
+
+	b.cache.Set(key, chapters)
+
+	return chapters, nil
+}
+
+// GetFreePages returns how many pages of the profile lie within the given
+// number of pages of the default profile. The part of a book free to read
+// is counted in the default profile so that it is the same whatever profile
+// the book is read in. The first page is always free.
+func (b *bookService) GetFreePages(id int, pages uint, profileName string) (uint, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return 0, err
+	}
+
+	book, err := b.GetBook(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	free, err := b.pageIndex(book, b.profiles[0])
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := b.pageIndex(book, profile)
+	if err != nil {
+		return 0, err
+	}
+
+	end := free.PageEnd(pages)
+	page := index.PageForOffset(end)
+	if index.PageEnd(page) > end {
+		page--
+	}
+
+	return max(page, 1), nil
+}
+
+func (b *bookService) GetChapterPage(id int, chapter int, profile string) (uint, error) {
+	chapters, err := b.GetToc(id, profile)
+	if err != nil {
+		return 0, err
+	}
+
+	if chapter < 1 || chapter > len(chapters) {
+		return 0, fmt.Errorf("chapter %d not found", chapter)
+	}
+
+	return chapters[chapter-1].Page, nil
+}
+
+// GetChapter returns the text of a table of contents entry up to the start of
+// the next entry. With maxPage set the text is cut at the end of that page.
+func (b *bookService) GetChapter(id int, chapter int, maxPage uint, profileName string) (*model.ChapterText, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	key := fmt.Sprintf("%s:chapter:%s:%d:%d", book.Filepath, profile.Name, chapter, maxPage)
+	if val, ok := b.cache.Get(key); ok {
+		return val.(*model.ChapterText), nil
+	}
+
+	chapters, err := b.GetToc(id, profile.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if chapter < 1 || chapter > len(chapters) {
+		return nil, fmt.Errorf("chapter %d not found", chapter)
+	}
+
+	index, err := b.pageIndex(book, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := b.content(book)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	start := min(chapters[chapter-1].Offset, index.RuneCount)
+	end := index.RuneCount
+	for _, c := range chapters[chapter:] {
+		if c.Offset > start {
+			end = min(c.Offset, end)
+			break
+		}
+	}
+
+	var truncated bool
+	if maxPage > 0 {
+		if limit := index.PageEnd(maxPage); limit < end {
+			end = max(limit, start)
+			truncated = true
+		}
+	}
+
+	data, err := index.Text(content, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	text := &model.ChapterText{
+		Number:    chapter,
+		Title:     chapters[chapter-1].Title,
+		Level:     chapters[chapter-1].Level,
+		Page:      chapters[chapter-1].Page,
+		Text:      strings.TrimSpace(data),
+		Truncated: truncated,
+	}
+
+	b.cache.Set(key, text)
+
+	return text, nil
+}
+
+func (b *bookService) GetNote(id int, ref string) (*model.Note, error) {
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	blocks, err := b.blocks(book)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notes: %v", err)
+	}
+
+	ref = strings.TrimPrefix(ref, "#")
+	for _, note := range blocks.Notes {
+		if note.Ref == ref {
+			return note, nil
+		}
+	}
+
+	return nil, fmt.Errorf("note %s not found", ref)
+}
+
+func (b *bookService) saveToc(book *dbmodel.Book) ([]*dbmodel.Chapter, error) {
+	toc, err := b.reader.GetToc(book.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]*dbmodel.Chapter, 0, len(toc))
+	for i, c := range toc {
+		chapters = append(chapters, &dbmodel.Chapter{
+			BookID: book.ID,
+			Number: i + 1,
+			Title:  c.Title,
+			Level:  c.Level,
+			Offset: c.Offset,
+		})
+	}
+
+	if err := table.SaveChapters(book.ID, chapters); err != nil {
+		return nil, err
+	}
+
+	b.forgetToc(book.ID)
+
+	return chapters, nil
+}
+
+func (b *bookService) forgetToc(id int) {
+	for _, profile := range b.profiles {
+		b.cache.Delete(fmt.Sprintf("bookToc:%d:%s", id, profile.Name))
+	}
+}
+
+// profile returns the pagination profile with the given name, or the default
+// one for an empty name.
+func (b *bookService) profile(name string) (reader.Profile, error) {
+	if name == "" {
+		return b.profiles[0], nil
+	}
+
+	for _, profile := range b.profiles {
+		if profile.Name == name {
+			return profile, nil
 		}
 	}
 
-	if start >= length {
-		return "", fmt.Errorf("start out of bounds")
+	return reader.Profile{}, fmt.Errorf("unknown profile: %s", name)
+}
+
+// paginate returns the page counts of the book by profile name, building
+// the page indexes that are missing.
+func (b *bookService) paginate(book *dbmodel.Book) (map[string]uint, error) {
+	pages := make(map[string]uint, len(b.profiles))
+	for _, profile := range b.profiles {
+		index, err := b.pageIndex(book, profile)
+		if err != nil {
+			return nil, err
+		}
+		pages[profile.Name] = index.Count()
+	}
+
+	return pages, nil
+}
+
+func (b *bookService) countPages(book *dbmodel.Book) error {
+	pages, err := b.paginate(book)
+	if err != nil {
+		return fmt.Errorf("failed to paginate book: %v", err)
+	}
+
+	if err := table.UpdateBookPages(book.ID, pages); err != nil {
+		return fmt.Errorf("failed to update book pages: %v", err)
+	}
+
+	book.Pages = pages
+	b.cache.Delete("allBooks")
+
+	return nil
+}
+
+// pageIndex returns the page boundaries of the book in a profile, rebuilding
+// the index file from the stored content when it is missing or does not
+// match the content.
+func (b *bookService) pageIndex(book *dbmodel.Book, profile reader.Profile) (*reader.PageIndex, error) {
+	key := fmt.Sprintf("pageIndex:%s:%s", book.Filepath, profile.Name)
+	if val, ok := b.cache.Get(key); ok {
+		return val.(*reader.PageIndex), nil
 	}
 
-	return strings.TrimSpace(string(runes[start:end])), nil
+	content, err := b.content(book)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	info, err := content.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %v", err)
+	}
+
+	path := pageIndexPath(b.storage.Path(book.Filepath), profile.Name)
+	index, err := reader.ReadPageIndex(path, profile)
+	if err != nil || index.Size != uint(info.Size()) {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content: %v", err)
+		}
+
+		toc, err := table.GetChapters(book.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chapters: %v", err)
+		}
+
+		chapters := make([]uint, 0, len(toc))
+		for _, c := range toc {
+			chapters = append(chapters, c.Offset)
+		}
+
+		index = reader.NewPageIndex(string(data), chapters, profile)
+		if err := reader.WritePageIndex(path, index); err != nil {
+			return nil, err
+		}
+	}
+
+	b.cache.Set(key, index)
+
+	return index, nil
+}
+
+func pageIndexPath(bookPath, profile string) string {
+	return fmt.Sprintf("%s.%s.pages", bookPath, profile)
 }
 
 func (b *bookService) DeleteBook(id int, user *model.UserContext) (err error) {
@@ -313,21 +694,73 @@ func (b *bookService) DeleteBook(id int, user *model.UserContext) (err error) {
 
 	b.cache.Delete(key)
 	b.cache.Delete("allBooks")
+	b.forgetToc(id)
 
-	if err := os.Remove(book.Filepath); err != nil {
+	if err := b.removeFiles(book); err != nil {
 		return fmt.Errorf("failed to delete book: %v", err)
 	}
 
 	return nil
 }
 
+// removeFiles removes the file of a deleted book along with the files made
+// from it, unless another book has the same file. The files made for its
+// downloads are its own and always removed.
+func (b *bookService) removeFiles(book *dbmodel.Book) error {
+	path := b.storage.Path(book.Filepath)
+	removeDownloads(path, book.ID, "")
+
+	count, err := table.CountBooksWithFile(book.Filepath)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	removeCover(b.coverPath(book))
+	os.Remove(contentPath(path))
+	b.removeBlocks(book.Filepath)
+	for _, profile := range b.profiles {
+		os.Remove(pageIndexPath(path, profile.Name))
+	}
+
+	return b.storage.Delete(book.Filepath)
+}
+
 func (b *bookService) SaveProgress(command *model.SaveProgress) error {
+	book, err := b.GetBook(command.BookId)
+	if err != nil {
+		return fmt.Errorf("failed to get book: %v", err)
+	}
+
+	index, chapters, err := b.pagination(book, command.Profile)
+	if err != nil {
+		return err
+	}
+
+	var loc model.Locator
+	var page uint
+	if command.Locator != nil {
+		offset, ok := locatorOffset(chapters, *command.Locator)
+		if !ok {
+			return fmt.Errorf("chapter %d not found", command.Locator.Chapter)
+		}
+		loc, page = *command.Locator, index.PageForOffset(offset)
+	} else {
+		page = min(uint(max(command.Page, 1)), max(index.Count(), 1))
+		loc = offsetLocator(chapters, index.PageEnd(page-1))
+	}
+
 	existProgress, err := table.GetProgress(command.GetUserId(), command.BookId)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		progress := &dbmodel.ReadingProgress{
 			UserID:      command.GetUserId(),
 			BookID:      command.BookId,
-			CurrentPage: command.Page,
+			CurrentPage: int(page),
+			Chapter:     &loc.Chapter,
+			Offset:      loc.Offset,
 			LastReadAt:  time.Now().Unix(),
 		}
 
@@ -335,12 +768,136 @@ func (b *bookService) SaveProgress(command *model.SaveProgress) error {
 	}
 
 	if existProgress != nil {
-		return table.UpdateProgress(existProgress, command.Page)
+		return table.UpdateProgress(existProgress, int(page), loc.Chapter, loc.Offset)
 	}
 
 	return nil
 }
 
-func (b *bookService) GetProgress(userId, bookId int) (*dbmodel.ReadingProgress, error) {
-	return table.GetProgress(userId, bookId)
+// GetProgress returns the reading position with the page it falls on in the
+// given profile.
+func (b *bookService) GetProgress(userId, bookId int, profile string) (*dbmodel.ReadingProgress, error) {
+	progress, err := table.GetProgress(userId, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := b.GetBook(bookId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	index, chapters, err := b.pagination(book, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// a chapter that is gone after the book was parsed again falls back to
+	// the last one, and a page number left unconverted to the start
+	loc := model.Locator{Offset: progress.Offset}
+	if progress.Chapter != nil {
+		loc.Chapter = min(*progress.Chapter, len(chapters))
+	}
+	offset, _ := locatorOffset(chapters, loc)
+	progress.CurrentPage = int(index.PageForOffset(offset))
+
+	return progress, nil
+}
+
+// MigrateProgress converts the progress saved as page numbers of the fixed
+// size pagination, before positions were stored, to positions. Progress in
+// books that can not be read now is left for the next start.
+func (b *bookService) MigrateProgress() error {
+	progress, err := table.GetPageProgress()
+	if err != nil {
+		return fmt.Errorf("failed to get progress: %v", err)
+	}
+
+	var errs []error
+	for start := 0; start < len(progress); {
+		end := start + 1
+		for end < len(progress) && progress[end].BookID == progress[start].BookID {
+			end++
+		}
+
+		if err := b.migrateProgress(progress[start].BookID, progress[start:end]); err != nil {
+			errs = append(errs, fmt.Errorf("book %d: %v", progress[start].BookID, err))
+		}
+		start = end
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *bookService) migrateProgress(bookId int, progress []*dbmodel.ReadingProgress) error {
+	book, err := b.GetBook(bookId)
+	if err != nil {
+		return err
+	}
+
+	chapters, err := b.GetToc(book.ID, "")
+	if err != nil {
+		return err
+	}
+
+	data, err := b.text(book)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range progress {
+		loc := offsetLocator(chapters, reader.LegacyPageOffset(data, uint(max(p.CurrentPage, 1))))
+		if err := table.SetProgressLocator(p, loc.Chapter, loc.Offset); err != nil {
+			return fmt.Errorf("failed to update progress: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// pagination returns the page index and table of contents of the book in a
+// profile.
+func (b *bookService) pagination(book *dbmodel.Book, profileName string) (*reader.PageIndex, []*dbmodel.Chapter, error) {
+	profile, err := b.profile(profileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chapters, err := b.GetToc(book.ID, profile.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index, err := b.pageIndex(book, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return index, chapters, nil
+}
+
+// offsetLocator returns the locator of a rune offset of the book text, which
+// is counted from the closest table of contents entry before it.
+func offsetLocator(chapters []*dbmodel.Chapter, offset uint) model.Locator {
+	loc := model.Locator{Offset: offset}
+	for _, c := range chapters {
+		if c.Offset <= offset && offset-c.Offset <= loc.Offset {
+			loc = model.Locator{Chapter: c.Number, Offset: offset - c.Offset}
+		}
+	}
+
+	return loc
+}
+
+// locatorOffset returns the rune offset of the book text a locator points at.
+func locatorOffset(chapters []*dbmodel.Chapter, loc model.Locator) (uint, bool) {
+	if loc.Chapter == 0 {
+		return loc.Offset, true
+	}
+
+	if loc.Chapter < 0 || loc.Chapter > len(chapters) {
+		return 0, false
+	}
+
+	return chapters[loc.Chapter-1].Offset + loc.Offset, true
 }
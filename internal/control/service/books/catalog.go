@@ -0,0 +1,122 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	dbmodel "BookStore/internal/database/model"
+	"BookStore/internal/database/table"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// setMetadata copies the metadata read from the book file to the book, all
+// but the title and annotation. Authors, series and genres are linked by
+// their keys when the book is saved.
+func setMetadata(book *dbmodel.Book, info *model.BookInfo) {
+	book.Author = info.Author
+
+	book.Authors = nil
+	for _, c := range info.Authors {
+		if key := dbmodel.CatalogKey(dbmodel.CatalogAuthors, c.Name); key != "" {
+			book.Authors = append(book.Authors, dbmodel.BookAuthor{
+				Role:     c.Role,
+				Position: len(book.Authors),
+				Author:   dbmodel.Author{Name: c.Name, Key: key},
+			})
+		}
+	}
+
+	book.Series = nil
+	if key := dbmodel.CatalogKey(dbmodel.CatalogSeries, info.Series); key != "" {
+		book.Series = []dbmodel.BookSeries{{
+			Number: info.SeriesIndex,
+			Series: dbmodel.Series{Name: info.Series, Key: key},
+		}}
+	}
+
+	book.Genres = nil
+	for _, genre := range info.Genres {
+		if key := dbmodel.CatalogKey(dbmodel.CatalogGenres, genre); key != "" {
+			book.Genres = append(book.Genres, dbmodel.Genre{Name: genre, Key: key})
+		}
+	}
+
+	book.Identifiers = nil
+	for _, id := range info.Identifiers {
+		book.Identifiers = append(book.Identifiers, dbmodel.Identifier{Scheme: id.Scheme, Value: id.Value})
+	}
+
+	book.Translators = info.Translators
+	book.Language = info.Language
+	book.Publisher = info.Publisher
+	book.PublishDate = info.PublishDate
+}
+
+func (b *bookService) GetCatalog(kind string) ([]*dbmodel.CatalogEntry, error) {
+	entries, err := table.GetCatalog(kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", kind, err)
+	}
+
+	return entries, nil
+}
+
+func (b *bookService) GetCatalogBooks(kind string, id int) ([]*dbmodel.Book, error) {
+	books, err := table.GetCatalogBooks(kind, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get books: %v", err)
+	}
+
+	return books, nil
+}
+
+// RenameCatalogEntry renames an author, series or genre. A name that differs
+// from the name of another entry only in spelling is turned down, the
+// entries are the same and should be merged.
+func (b *bookService) RenameCatalogEntry(kind string, id int, name string) error {
+	name = strings.Join(strings.Fields(name), " ")
+	key := dbmodel.CatalogKey(kind, name)
+	if key == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	bookIds, err := table.RenameCatalogEntry(kind, id, name, key)
+	if err != nil {
+		return fmt.Errorf("failed to rename entry %d: %v", id, err)
+	}
+	b.forgetBooks(bookIds)
+
+	return nil
+}
+
+// MergeCatalogEntries replaces the authors, series or genres ids with into
+// in every book.
+func (b *bookService) MergeCatalogEntries(kind string, into int, ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("no entries to merge")
+	}
+
+	if slices.Contains(ids, into) {
+		return fmt.Errorf("can not merge entry %d into itself", into)
+	}
+
+	if _, err := table.GetCatalogEntry(kind, into); err != nil {
+		return fmt.Errorf("failed to get entry %d: %v", into, err)
+	}
+
+	bookIds, err := table.MergeCatalogEntries(kind, into, ids)
+	if err != nil {
+		return fmt.Errorf("failed to merge entries: %v", err)
+	}
+	b.forgetBooks(bookIds)
+
+	return nil
+}
+
+// forgetBooks drops the cached books, whose metadata changed.
+func (b *bookService) forgetBooks(ids []int) {
+	for _, id := range ids {
+		b.cache.Delete(fmt.Sprintf("bookId:%d", id))
+	}
+	b.cache.Delete("allBooks")
+}
@@ -0,0 +1,278 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/reader"
+	"BookStore/internal/control/service/storage"
+	dbmodel "BookStore/internal/database/model"
+	"BookStore/internal/database/table"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// contentPath is where the plain text of a book is kept. Pages and chapters
+// are read from it through the page index, so reading a book needs neither
+// the original file nor parsing it.
+func contentPath(bookPath string) string {
+	return bookPath + ".text"
+}
+
+// ingest reads the book file and stores its content and page indexes next to
+// the local copy of the file. It returns the page counts by profile name
+// along with what was read.
+func (b *bookService) ingest(key string) (*reader.Ingestion, map[string]uint, error) {
+	bookPath := b.storage.Path(key)
+	path := contentPath(bookPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	// every run writes a file of its own, so runs on the same book at once
+	// do not write over each other
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create content file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	ingestion, err := b.reader.Ingest(key, w, b.profiles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse book: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write content: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write content: %v", err)
+	}
+
+	// the content is replaced at once so readers never see a partial file
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, nil, fmt.Errorf("failed to write content: %v", err)
+	}
+
+	// the blocks are parsed from the book again when they are next read
+	b.removeBlocks(key)
+
+	pages := make(map[string]uint, len(ingestion.Pages))
+	for name, index := range ingestion.Pages {
+		if err := reader.WritePageIndex(pageIndexPath(bookPath, name), index); err != nil {
+			return nil, nil, fmt.Errorf("failed to paginate book: %v", err)
+		}
+		b.cache.Set(fmt.Sprintf("pageIndex:%s:%s", key, name), index)
+		pages[name] = index.Count()
+	}
+
+	return ingestion, pages, nil
+}
+
+// content opens the stored content of the book. Books uploaded before the
+// content was stored, or whose local files are gone, are processed on first
+// read.
+func (b *bookService) content(book *dbmodel.Book) (*os.File, error) {
+	path := contentPath(b.storage.Path(book.Filepath))
+	f, err := os.Open(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return f, err
+	}
+
+	if err := b.reprocess(book); err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+// text returns the whole stored content of the book.
+func (b *bookService) text(book *dbmodel.Book) (string, error) {
+	content, err := b.content(book)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to read content: %v", err)
+	}
+
+	return string(data), nil
+}
+
+// reprocess parses the book file again and replaces everything made from it:
+// the content, the page indexes, the table of contents and the chapter and
+// page counts. The title, author and annotation are kept. Books added before
+// hashes were kept get their hash, and books with no authors, series and
+// genres, like those added before they were read, get the metadata read
+// unless a user edited it.
+func (b *bookService) reprocess(book *dbmodel.Book) error {
+	ingestion, pages, err := b.ingest(book.Filepath)
+	if err != nil {
+		return err
+	}
+
+	if book.Hash == "" {
+		if err := b.hashBook(book); err != nil {
+			return err
+		}
+	}
+
+	if len(book.Authors) == 0 && len(book.Series) == 0 && len(book.Genres) == 0 {
+		edited, err := table.HasBookEdits(book.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get book history: %v", err)
+		}
+
+		if !edited {
+			setMetadata(book, ingestion.Info)
+			if err := table.UpdateBookMetadata(book); err != nil {
+				return fmt.Errorf("failed to update book: %v", err)
+			}
+		}
+	}
+
+	if err := table.UpdateBookContent(book.ID, ingestion.ChaptersCount, pages); err != nil {
+		return fmt.Errorf("failed to update book: %v", err)
+	}
+	book.Chapters, book.Pages = ingestion.ChaptersCount, pages
+
+	if _, err := b.saveToc(book); err != nil {
+		return fmt.Errorf("failed to save table of contents: %v", err)
+	}
+
+	b.cache.Delete("allBooks")
+
+	return nil
+}
+
+func (b *bookService) hashBook(book *dbmodel.Book) error {
+	path, err := b.storage.Fetch(book.Filepath)
+	if err != nil {
+		return fmt.Errorf("failed to fetch book: %v", err)
+	}
+
+	hash, err := storage.Hash(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash book: %v", err)
+	}
+
+	// a copy of a book already hashed keeps its hash empty and shows up
+	// among the duplicates by title and author
+	if _, err := table.GetBookByHash(hash); err == nil {
+		return nil
+	}
+
+	if err := table.SetBookHash(book.ID, hash); err != nil {
+		return fmt.Errorf("failed to update book: %v", err)
+	}
+	book.Hash = hash
+
+	return nil
+}
+
+// storeLegacy moves the file of a book stored with its absolute path into the
+// storage and points the books with that file to its key. The files made
+// from it are made again next to the stored copy.
+func (b *bookService) storeLegacy(book *dbmodel.Book) error {
+	old := book.Filepath
+	key, err := b.storage.Store(old)
+	if err != nil {
+		return fmt.Errorf("failed to store book: %v", err)
+	}
+
+	if err := table.SetBooksFilepath(old, key); err != nil {
+		return fmt.Errorf("failed to update book: %v", err)
+	}
+	book.Filepath = key
+
+	os.Remove(contentPath(old))
+	b.removeBlocks(old)
+	for _, profile := range b.profiles {
+		os.Remove(pageIndexPath(old, profile.Name))
+	}
+
+	return nil
+}
+
+// ReprocessBooks queues a job that processes every book again, which is
+// needed after a parser changes. While a job is unfinished, it is returned
+// instead of queueing another.
+func (b *bookService) ReprocessBooks(user *model.UserContext) (*dbmodel.ImportJob, error) {
+	jobs, err := table.GetUnfinishedImportJobs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import jobs: %v", err)
+	}
+
+	for _, job := range jobs {
+		if job.Kind == dbmodel.JobReprocess {
+			return job, nil
+		}
+	}
+
+	now := time.Now().Unix()
+	job := &dbmodel.ImportJob{
+		UserID:    user.ID,
+		Kind:      dbmodel.JobReprocess,
+		Status:    dbmodel.ImportQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := table.Upsert(job); err != nil {
+		return nil, fmt.Errorf("failed to save import job: %v", err)
+	}
+
+	if err := b.enqueue(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// reprocessBooks processes every book again. Books that fail do not stop
+// the others and are reported together.
+func (b *bookService) reprocessBooks() (int, error) {
+	books, err := table.GetBooks()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get books: %v", err)
+	}
+
+	var count int
+	var errs []error
+	keys := make(map[string]string)
+	for _, book := range books {
+		// books stored before keys were introduced are moved into the
+		// storage, once for all the books sharing the file
+		if key, ok := keys[book.Filepath]; ok {
+			book.Filepath = key
+		} else if filepath.IsAbs(book.Filepath) {
+			old := book.Filepath
+			if err := b.storeLegacy(book); err != nil {
+				errs = append(errs, fmt.Errorf("book %d: %v", book.ID, err))
+				continue
+			}
+			keys[old] = book.Filepath
+		}
+
+		if err := b.reprocess(book); err != nil {
+			errs = append(errs, fmt.Errorf("book %d: %v", book.ID, err))
+			continue
+		}
+		count++
+	}
+
+	// pages, chapters and tables of contents cached from the old content
+	// are all stale now
+	b.cache.Clean()
+
+	return count, errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	dbmodel "BookStore/internal/database/model"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// coverSizes are the thumbnail sizes generated for covers, by the length of
+// the longer side in pixels.
+var coverSizes = map[string]int{
+	"small":  160,
+	"medium": 400,
+}
+
+// maxCoverPixels is the largest cover by width times height. Decoding takes
+// memory by the dimensions an image declares, which a small file can make
+// huge, so larger covers are left out.
+const maxCoverPixels = 8000 * 8000
+
+var coverExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/bmp":     ".bmp",
+	"image/svg+xml": ".svg",
+}
+
+// saveCover stores the cover of the book next to the local copy of the book
+// file together with its thumbnails and returns the file name of the cover.
+// Books without a cover return an empty name.
+func (b *bookService) saveCover(key string) (string, error) {
+	cover, err := b.reader.GetCover(key)
+	if err != nil || cover == nil {
+		return "", nil
+	}
+
+	if config, _, err := image.DecodeConfig(bytes.NewReader(cover.Data)); err == nil {
+		if int64(config.Width)*int64(config.Height) > maxCoverPixels {
+			return "", nil
+		}
+	}
+
+	ext, ok := coverExtensions[cover.ContentType]
+	if !ok {
+		ext = ".img"
+	}
+
+	dest := b.storage.Path(key) + ".cover" + ext
+	if err := os.WriteFile(dest, cover.Data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write cover: %v", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(cover.Data))
+	if err != nil {
+		// formats the standard library can not decode are served as is
+		return filepath.Base(dest), nil
+	}
+
+	for size, length := range coverSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumbnail(img, length), &jpeg.Options{Quality: 85}); err != nil {
+			return "", fmt.Errorf("failed to encode thumbnail: %v", err)
+		}
+
+		if err := os.WriteFile(thumbnailPath(dest, size), buf.Bytes(), 0644); err != nil {
+			return "", fmt.Errorf("failed to write thumbnail: %v", err)
+		}
+	}
+
+	return filepath.Base(dest), nil
+}
+
+// coverPath returns where the cover of the book is. Books added before the
+// storage keep the full path of their cover.
+func (b *bookService) coverPath(book *dbmodel.Book) string {
+	if book.Cover == "" || filepath.IsAbs(book.Cover) {
+		return book.Cover
+	}
+
+	return filepath.Join(filepath.Dir(b.storage.Path(book.Filepath)), book.Cover)
+}
+
+func (b *bookService) GetCover(id int, size string) (*model.Image, error) {
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	if book.Cover == "" {
+		return nil, fmt.Errorf("book has no cover")
+	}
+
+	cover := b.coverPath(book)
+
+	// the cover lives next to the local copy of the book, which a remote
+	// storage may not have anymore
+	if _, err := os.Stat(cover); errors.Is(err, os.ErrNotExist) && !filepath.IsAbs(book.Cover) {
+		if _, err := b.saveCover(book.Filepath); err != nil {
+			return nil, fmt.Errorf("failed to save cover: %v", err)
+		}
+	}
+
+	name := cover
+	if size != "" && size != "full" {
+		if _, ok := coverSizes[size]; !ok {
+			return nil, fmt.Errorf("unknown cover size: %s", size)
+		}
+
+		if _, err := os.Stat(thumbnailPath(cover, size)); err == nil {
+			name = thumbnailPath(cover, size)
+		}
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover: %v", err)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &model.Image{Name: filepath.Base(name), ContentType: contentType, Data: data}, nil
+}
+
+func (b *bookService) GetImage(id int, name string) (*model.Image, error) {
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	return b.reader.GetImage(book.Filepath, name)
+}
+
+func removeCover(cover string) {
+	if cover == "" {
+		return
+	}
+
+	os.Remove(cover)
+	for size := range coverSizes {
+		os.Remove(thumbnailPath(cover, size))
+	}
+}
+
+func thumbnailPath(cover, size string) string {
+	return strings.TrimSuffix(cover, filepath.Ext(cover)) + "_" + size + ".jpg"
+}
+
+// thumbnail scales img down so that its longer side is at most length pixels,
+// averaging the source pixels that fall into each target pixel.
+func thumbnail(img image.Image, length int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= length && h <= length {
+		return img
+	}
+
+	tw, th := length, h*length/w
+	if h > w {
+		tw, th = w*length/h, length
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+max((x+1)*w/tw, x*w/tw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,162 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/reader"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// contentTypes are the content types books are downloaded with by format.
+var contentTypes = map[string]string{
+	"epub":     "application/epub+zip",
+	"fb2":      "application/x-fictionbook+xml",
+	"mobi":     "application/x-mobipocket-ebook",
+	"azw":      "application/vnd.amazon.ebook",
+	"azw3":     "application/vnd.amazon.ebook",
+	"pdf":      "application/pdf",
+	"txt":      "text/plain; charset=utf-8",
+	"md":       "text/markdown; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"html":     "text/html; charset=utf-8",
+	"htm":      "text/html; charset=utf-8",
+}
+
+var fileNamePattern = regexp.MustCompile(`[\x00-\x1f\x7f/\\:*?"<>|]+`)
+
+// downloadPath is where the file of a book downloaded in a format is kept,
+// next to the local copy of the file it is made from. The token changes with
+// the metadata of the book, so a file made before an edit is not served.
+func downloadPath(bookPath string, id int, token, format string) string {
+	return fmt.Sprintf("%s.download.%d.%s.%s", bookPath, id, token, format)
+}
+
+// removeDownloads removes the files made for downloads of the book, or if
+// keep is set, the ones in its format made before it.
+func removeDownloads(bookPath string, id int, keep string) {
+	paths, _ := filepath.Glob(fmt.Sprintf("%s.download.%d.*", bookPath, id))
+	for _, path := range paths {
+		if keep == "" || path != keep && filepath.Ext(path) == filepath.Ext(keep) {
+			os.Remove(path)
+		}
+	}
+}
+
+// DownloadBook returns the file of the book in the format, or in the format
+// it was uploaded in if format is empty. The file is written with the
+// metadata the book has in the library and converted if the format is
+// another one, and it is kept until the book changes. Books whose metadata
+// can not be written to their files are downloaded as they were uploaded.
+func (b *bookService) DownloadBook(id int, format string) (*model.BookFile, error) {
+	book, err := b.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	own := strings.ToLower(strings.TrimPrefix(book.Format, "."))
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if format == "" {
+		format = own
+	}
+	if format != own && !slices.Contains(reader.ConvertFormats, format) {
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	file := &model.BookFile{Name: downloadName(book.Title, format), ContentType: contentTypes[format]}
+	if file.ContentType == "" {
+		file.ContentType = "application/octet-stream"
+	}
+
+	if format == own && !b.reader.WritesMetadata(format) {
+		if file.Path, err = b.storage.Fetch(book.Filepath); err != nil {
+			return nil, fmt.Errorf("failed to fetch book: %v", err)
+		}
+		return file, nil
+	}
+
+	var cover *model.Image
+	if book.Cover != "" {
+		if cover, err = b.GetCover(id, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	info := bookInfo(book)
+	token, err := downloadToken(info, cover, format)
+	if err != nil {
+		return nil, err
+	}
+
+	bookPath := b.storage.Path(book.Filepath)
+	file.Path = downloadPath(bookPath, id, token, format)
+	if _, err := os.Stat(file.Path); err == nil {
+		return file, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(file.Path), filepath.Base(file.Path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if format == own {
+		err = b.reader.Export(book.Filepath, f, info, cover)
+	} else {
+		err = b.reader.Convert(book.Filepath, format, f, info, cover)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write book: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write book: %v", err)
+	}
+
+	// the file is replaced at once so downloads never get a partial file
+	if err := os.Rename(f.Name(), file.Path); err != nil {
+		return nil, fmt.Errorf("failed to write book: %v", err)
+	}
+	removeDownloads(bookPath, id, file.Path)
+
+	return file, nil
+}
+
+// downloadToken tells the metadata and cover a book is downloaded with.
+func downloadToken(info *model.BookInfo, cover *model.Image, format string) (string, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal book info: %v", err)
+	}
+
+	h := sha1.New()
+	h.Write(data)
+	if cover != nil {
+		h.Write([]byte(cover.ContentType))
+		h.Write(cover.Data)
+	}
+	h.Write([]byte(format))
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// downloadName names the downloaded file after the title of the book.
+func downloadName(title, format string) string {
+	name := strings.Trim(fileNamePattern.ReplaceAllString(strings.TrimSpace(title), "_"), ". _")
+	if name == "" {
+		name = "book"
+	}
+
+	return name + "." + format
+}
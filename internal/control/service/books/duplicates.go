@@ -0,0 +1,89 @@
+package books
+
+import (
+	dbmodel "BookStore/internal/database/model"
+	"BookStore/internal/database/table"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GetDuplicates returns the groups of books that are likely the same book:
+// different files with the same title and author, ignoring case,
+// punctuation, accents and the order of the author's names.
+func (b *bookService) GetDuplicates() ([][]*dbmodel.Book, error) {
+	books, err := table.GetBooks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get books: %v", err)
+	}
+
+	groups := map[string][]*dbmodel.Book{}
+	var keys []string
+	for _, book := range books {
+		title := dbmodel.NormalizeWords(book.Title)
+		if title == "" {
+			continue
+		}
+
+		author := strings.Fields(dbmodel.NormalizeWords(book.Author))
+		sort.Strings(author)
+
+		key := title + "\x00" + strings.Join(author, " ")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], book)
+	}
+
+	duplicates := [][]*dbmodel.Book{}
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			duplicates = append(duplicates, groups[key])
+		}
+	}
+
+	return duplicates, nil
+}
+
+// MergeBooks replaces the books ids with the book into: their readers keep
+// reading into, from the position saved in the merged book if they read it
+// last, and the files of the merged books are removed.
+func (b *bookService) MergeBooks(into int, ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("no books to merge")
+	}
+
+	if slices.Contains(ids, into) {
+		return fmt.Errorf("can not merge book %d into itself", into)
+	}
+
+	if _, err := table.GetBook(into); err != nil {
+		return fmt.Errorf("failed to get book %d: %v", into, err)
+	}
+
+	books := make([]*dbmodel.Book, 0, len(ids))
+	for _, id := range ids {
+		book, err := table.GetBook(id)
+		if err != nil {
+			return fmt.Errorf("failed to get book %d: %v", id, err)
+		}
+		books = append(books, book)
+	}
+
+	if err := table.MergeBooks(into, ids); err != nil {
+		return fmt.Errorf("failed to merge books: %v", err)
+	}
+
+	for _, book := range books {
+		b.cache.Delete(fmt.Sprintf("bookId:%d", book.ID))
+		b.forgetToc(book.ID)
+
+		if err := b.removeFiles(book); err != nil {
+			return fmt.Errorf("failed to delete book %d: %v", book.ID, err)
+		}
+	}
+	b.cache.Delete("allBooks")
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	dbmodel "BookStore/internal/database/model"
+	"BookStore/internal/database/table"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// UpdateBook changes the metadata of a book, which the user who uploaded it
+// or an admin may do. The fields that changed are added to the history of
+// the book; a command that changes nothing is not.
+func (b *bookService) UpdateBook(cmd *model.UpdateBookCommand, user *model.UserContext) (*dbmodel.Book, error) {
+	book, err := b.editableBook(cmd.BookId, user, "update")
+	if err != nil {
+		return nil, err
+	}
+
+	before := bookInfo(book)
+	after, err := applyUpdate(*before, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffInfo(before, after)
+	if len(changes) == 0 {
+		return book, nil
+	}
+
+	book.Title, book.Annotation = after.Title, after.Annotation
+	setMetadata(book, after)
+
+	edit := &dbmodel.BookEdit{
+		BookID:    book.ID,
+		UserID:    user.ID,
+		Changes:   changes,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := table.UpdateBook(book, edit); err != nil {
+		return nil, fmt.Errorf("failed to update book: %v", err)
+	}
+	b.forgetBooks([]int{book.ID})
+
+	return b.GetBook(book.ID)
+}
+
+// GetBookHistory returns the edits of a book, the last first.
+func (b *bookService) GetBookHistory(id int, user *model.UserContext) ([]*dbmodel.BookEdit, error) {
+	if _, err := b.editableBook(id, user, "see history of"); err != nil {
+		return nil, err
+	}
+
+	edits, err := table.GetBookEdits(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book history: %v", err)
+	}
+
+	return edits, nil
+}
+
+// editableBook reads the book from the database, not the cache, which an
+// edit must not start from, and checks that the user may edit it.
+func (b *bookService) editableBook(id int, user *model.UserContext, action string) (*dbmodel.Book, error) {
+	book, err := table.GetBook(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get book: %v", err)
+	}
+
+	if user.Role != "admin" {
+		if user.ID != book.UserId {
+			return nil, fmt.Errorf("you have no permission to %s book", action)
+		}
+	}
+
+	return book, nil
+}
+
+// bookInfo returns the metadata of a stored book. Lists are never nil, so
+// that an empty list equals an emptied one.
+func bookInfo(book *dbmodel.Book) *model.BookInfo {
+	info := &model.BookInfo{
+		Title:       book.Title,
+		Author:      book.Author,
+		Annotation:  book.Annotation,
+		Authors:     []model.Contributor{},
+		Translators: append([]string{}, book.Translators...),
+		Genres:      []string{},
+		Language:    book.Language,
+		Publisher:   book.Publisher,
+		PublishDate: book.PublishDate,
+		Identifiers: []model.Identifier{},
+	}
+
+	for _, link := range book.Authors {
+		info.Authors = append(info.Authors, model.Contributor{Name: link.Author.Name, Role: link.Role})
+	}
+
+	if len(book.Series) > 0 {
+		info.Series, info.SeriesIndex = book.Series[0].Series.Name, book.Series[0].Number
+	}
+
+	for _, genre := range book.Genres {
+		info.Genres = append(info.Genres, genre.Name)
+	}
+
+	for _, id := range book.Identifiers {
+		info.Identifiers = append(info.Identifiers, model.Identifier{Scheme: id.Scheme, Value: id.Value})
+	}
+
+	return info
+}
+
+// applyUpdate returns info with the fields set by the command, cleaned up.
+func applyUpdate(info model.BookInfo, cmd *model.UpdateBookCommand) (*model.BookInfo, error) {
+	if cmd.Title != nil {
+		info.Title = strings.Join(strings.Fields(*cmd.Title), " ")
+		if info.Title == "" {
+			return nil, fmt.Errorf("title is empty")
+		}
+	}
+
+	if cmd.Annotation != nil {
+		info.Annotation = strings.TrimSpace(*cmd.Annotation)
+	}
+
+	if cmd.Authors != nil {
+		info.Authors = []model.Contributor{}
+		for _, c := range *cmd.Authors {
+			c.Name = strings.Join(strings.Fields(c.Name), " ")
+			c.Role = strings.ToLower(strings.TrimSpace(c.Role))
+			if c.Role == "" {
+				c.Role = "author"
+			}
+			if c.Name != "" {
+				info.Authors = append(info.Authors, c)
+			}
+		}
+	}
+
+	if cmd.Translators != nil {
+		info.Translators = cleanList(*cmd.Translators)
+	}
+
+	if cmd.Series != nil {
+		info.Series = strings.Join(strings.Fields(*cmd.Series), " ")
+	}
+
+	if cmd.SeriesIndex != nil {
+		if *cmd.SeriesIndex < 0 {
+			return nil, fmt.Errorf("series index is negative")
+		}
+		info.SeriesIndex = *cmd.SeriesIndex
+	}
+
+	if info.Series == "" {
+		info.SeriesIndex = 0
+	}
+
+	if cmd.Genres != nil {
+		info.Genres = cleanList(*cmd.Genres)
+	}
+
+	if cmd.Language != nil {
+		info.Language = strings.TrimSpace(*cmd.Language)
+	}
+
+	if cmd.Publisher != nil {
+		info.Publisher = strings.TrimSpace(*cmd.Publisher)
+	}
+
+	if cmd.PublishDate != nil {
+		info.PublishDate = strings.TrimSpace(*cmd.PublishDate)
+	}
+
+	if cmd.Identifiers != nil {
+		info.Identifiers = []model.Identifier{}
+		for _, id := range *cmd.Identifiers {
+			id.Scheme = strings.ToUpper(strings.TrimSpace(id.Scheme))
+			id.Value = strings.TrimSpace(id.Value)
+			if id.Scheme == "" || id.Value == "" {
+				return nil, fmt.Errorf("identifier needs a scheme and a value")
+			}
+			info.Identifiers = append(info.Identifiers, id)
+		}
+	}
+
+	return &info, nil
+}
+
+// cleanList trims the values and leaves out the empty ones.
+func cleanList(values []string) []string {
+	list := []string{}
+	for _, v := range values {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func diffInfo(before, after *model.BookInfo) []dbmodel.FieldChange {
+	fields := []dbmodel.FieldChange{
+		{Field: "title", Old: before.Title, New: after.Title},
+		{Field: "annotation", Old: before.Annotation, New: after.Annotation},
+		{Field: "authors", Old: before.Authors, New: after.Authors},
+		{Field: "translators", Old: before.Translators, New: after.Translators},
+		{Field: "series", Old: before.Series, New: after.Series},
+		{Field: "series_index", Old: before.SeriesIndex, New: after.SeriesIndex},
+		{Field: "genres", Old: before.Genres, New: after.Genres},
+		{Field: "language", Old: before.Language, New: after.Language},
+		{Field: "publisher", Old: before.Publisher, New: after.Publisher},
+		{Field: "publish_date", Old: before.PublishDate, New: after.PublishDate},
+		{Field: "identifiers", Old: before.Identifiers, New: after.Identifiers},
+	}
+
+	var changes []dbmodel.FieldChange
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.Old, field.New) {
+			changes = append(changes, field)
+		}
+	}
+
+	return changes
+}
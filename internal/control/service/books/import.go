@@ -0,0 +1,318 @@
+package books
+
+import (
+	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/reader"
+	"BookStore/internal/control/service/storage"
+	dbmodel "BookStore/internal/database/model"
+	"BookStore/internal/database/table"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"os"
+	"time"
+)
+
+// importQueueSize is how many jobs can wait for a worker before uploads are
+// turned down.
+const importQueueSize = 256
+
+// RunImports starts the workers that ingest uploaded books and queues the
+// jobs left unfinished by the previous run. The workers stop with ctx.
+func (b *bookService) RunImports(ctx context.Context, workers int) error {
+	jobs, err := table.GetUnfinishedImportJobs()
+	if err != nil {
+		return fmt.Errorf("failed to get import jobs: %v", err)
+	}
+
+	for i := 0; i < max(workers, 1); i++ {
+		go b.importWorker(ctx)
+	}
+
+	// there may be more of them than the queue holds, so they are sent as
+	// the workers take them
+	go func() {
+		for _, job := range jobs {
+			select {
+			case b.imports <- job.ID:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (b *bookService) importWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-b.imports:
+			b.runImport(id)
+		}
+	}
+}
+
+// enqueue hands the job to the workers. A job that does not fit in the queue
+// fails at once and can be retried later.
+func (b *bookService) enqueue(job *dbmodel.ImportJob) error {
+	select {
+	case b.imports <- job.ID:
+		return nil
+	default:
+	}
+
+	job.Status = dbmodel.ImportFailed
+	job.Error = "import queue is full"
+	job.UpdatedAt = time.Now().Unix()
+	if err := table.Upsert(job); err != nil {
+		return fmt.Errorf("failed to save import job: %v", err)
+	}
+
+	return nil
+}
+
+func (b *bookService) runImport(id int) {
+	job, err := table.GetImportJob(id)
+	if err != nil {
+		log.Errorf("failed to get import job %d: %v", id, err)
+		return
+	}
+
+	job.Status = dbmodel.ImportProcessing
+	job.Error = ""
+	job.ErrorCode = ""
+	job.Attempts++
+	job.UpdatedAt = time.Now().Unix()
+	if err := table.Upsert(job); err != nil {
+		log.Errorf("failed to save import job %d: %v", id, err)
+		return
+	}
+
+	var bookId int
+	if job.Kind == dbmodel.JobReprocess {
+		job.Processed, err = b.reprocessBooks()
+	} else {
+		bookId, err = b.importBook(job)
+	}
+	if err != nil {
+		job.Status = dbmodel.ImportFailed
+		job.Error = err.Error()
+
+		var invalid *reader.ValidationError
+		if errors.As(err, &invalid) {
+			job.ErrorCode = invalid.Code
+		}
+	} else {
+		job.Status = dbmodel.ImportDone
+		if job.Kind != dbmodel.JobReprocess {
+			job.BookID = &bookId
+		}
+	}
+
+	job.UpdatedAt = time.Now().Unix()
+	if err := table.Upsert(job); err != nil {
+		log.Errorf("failed to save import job %d: %v", id, err)
+	}
+}
+
+// importBook downloads the book of the job if needed, moves it to the
+// storage and adds it. A book that made it to the storage stays there when
+// adding fails, so a retry starts from it. A file some book already has is
+// not stored again, the job gets that book.
+func (b *bookService) importBook(job *dbmodel.ImportJob) (int, error) {
+	if job.FileKey == "" {
+		if err := b.stageImport(job); err != nil {
+			return 0, err
+		}
+
+		if book, err := table.GetBookByHash(job.Hash); err == nil {
+			os.Remove(job.Path)
+			return b.importDuplicate(job, book)
+		}
+
+		key, err := b.storage.Store(job.Path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store book: %v", err)
+		}
+		job.FileKey = key
+	}
+
+	path, err := b.storage.Fetch(job.FileKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch book: %v", err)
+	}
+
+	format, err := reader.DetectFormat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect book format: %v", err)
+	}
+
+	id, err := b.addBook(job.FileKey, job.Hash, format, job.CreatedAt, job.UserID)
+	if err != nil {
+		// another job may have added the same file in the meantime
+		if book, err := table.GetBookByHash(job.Hash); err == nil && job.Hash != "" {
+			return b.importDuplicate(job, book)
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// importDuplicate finishes the job of a file the library has already with the
+// book of that file, which is added to the books of the uploader.
+func (b *bookService) importDuplicate(job *dbmodel.ImportJob, book *dbmodel.Book) (int, error) {
+	if err := table.LinkBook(job.UserID, book.ID); err != nil {
+		return 0, fmt.Errorf("failed to link book: %v", err)
+	}
+	job.Duplicate = true
+
+	return book.ID, nil
+}
+
+// stageImport makes the uploaded file of the job ready to be stored.
+func (b *bookService) stageImport(job *dbmodel.ImportJob) error {
+	if job.Url != "" {
+		if err := b.download(job); err != nil {
+			return err
+		}
+	}
+
+	if err := reader.ValidateUpload(job.Path, b.limits); err != nil {
+		return err
+	}
+
+	path, err := reader.UnwrapArchive(job.Path)
+	if err != nil {
+		return fmt.Errorf("failed to unwrap archive: %v", err)
+	}
+
+	// the archive is gone once unwrapped and what it held is checked too
+	if path != job.Path {
+		job.Path = path
+		if err := reader.ValidateUpload(path, b.limits); err != nil {
+			return err
+		}
+	}
+
+	if _, err := reader.DetectFormat(path); err != nil {
+		return fmt.Errorf("failed to detect book format: %v", err)
+	}
+
+	hash, err := storage.Hash(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash book: %v", err)
+	}
+	job.Hash = hash
+
+	return nil
+}
+
+// download fetches the book of a url job into a new file in the upload
+// directory, named as the server names it.
+func (b *bookService) download(job *dbmodel.ImportJob) error {
+	// what a failed attempt left
+	if job.Path != "" {
+		os.Remove(job.Path)
+		job.Path = ""
+	}
+
+	if err := os.MkdirAll(b.uploadDir, 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(b.uploadDir, "*.download")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	name, err := b.fetcher.Fetch(context.Background(), job.Url, tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	dest, err := b.stagingPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	job.Path, job.FileName = dest, name
+
+	return nil
+}
+
+func (b *bookService) newImportJob(user *model.UserContext, url, path, fileName string, createTime int64) (*dbmodel.ImportJob, error) {
+	job := &dbmodel.ImportJob{
+		UserID:    user.ID,
+		Url:       url,
+		Path:      path,
+		FileName:  fileName,
+		Status:    dbmodel.ImportQueued,
+		CreatedAt: createTime,
+		UpdatedAt: createTime,
+	}
+
+	if err := table.Upsert(job); err != nil {
+		return nil, fmt.Errorf("failed to save import job: %v", err)
+	}
+
+	if err := b.enqueue(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetImportJob returns an import job to the user who started it or an admin.
+func (b *bookService) GetImportJob(id int, user *model.UserContext) (*dbmodel.ImportJob, error) {
+	job, err := table.GetImportJob(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job: %v", err)
+	}
+
+	if user.Role != "admin" && user.ID != job.UserID {
+		return nil, fmt.Errorf("you have no permission to see import job")
+	}
+
+	return job, nil
+}
+
+// RetryImport queues a failed import job again.
+func (b *bookService) RetryImport(id int, user *model.UserContext) (*dbmodel.ImportJob, error) {
+	job, err := b.GetImportJob(id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != dbmodel.ImportFailed {
+		return nil, fmt.Errorf("import job is %s, only failed jobs can be retried", job.Status)
+	}
+
+	job.Status = dbmodel.ImportQueued
+	job.Error = ""
+	job.ErrorCode = ""
+	job.UpdatedAt = time.Now().Unix()
+	if err := table.Upsert(job); err != nil {
+		return nil, fmt.Errorf("failed to save import job: %v", err)
+	}
+
+	if err := b.enqueue(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
@@ -0,0 +1,291 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 2 * time.Minute
+	DefaultMaxSize      = 100 << 20
+	DefaultMaxRedirects = 5
+)
+
+// DefaultBlockList holds the networks books are never fetched from: private,
+// loopback, link-local and other addresses that are not on the internet.
+var DefaultBlockList = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// contentTypeExtensions name files served without a usable name.
+var contentTypeExtensions = map[string]string{
+	"application/epub+zip":           ".epub",
+	"application/x-fictionbook+xml":  ".fb2",
+	"application/x-fictionbook":      ".fb2",
+	"application/x-mobipocket-ebook": ".mobi",
+	"application/vnd.amazon.ebook":   ".azw",
+	"application/pdf":                ".pdf",
+	"application/zip":                ".zip",
+	"text/plain":                     ".txt",
+	"text/markdown":                  ".md",
+	"text/html":                      ".html",
+}
+
+// Fetcher downloads books from urls given by users, which may point
+// anywhere, so it only connects to public addresses and gives up on slow or
+// large downloads.
+type Fetcher struct {
+	client       *http.Client
+	timeout      time.Duration
+	maxSize      int64
+	maxRedirects int
+	blockList    []netip.Prefix
+}
+
+type Option func(*Fetcher)
+
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		timeout:      DefaultTimeout,
+		maxSize:      DefaultMaxSize,
+		maxRedirects: DefaultMaxRedirects,
+		blockList:    DefaultBlockList,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		// the address is checked after the name is resolved, so a name can
+		// not be made to point at a blocked address after Check
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+
+			return f.checkAddr(ip)
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: f.timeout,
+		Transport: &http.Transport{
+			// a proxy would be the only address checked
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", f.maxRedirects)
+			}
+			return f.Check(req.URL.String())
+		},
+	}
+
+	return f
+}
+
+// WithTimeout limits the time a whole download may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		if timeout > 0 {
+			f.timeout = timeout
+		}
+	}
+}
+
+// WithMaxSize limits the size of a downloaded file in bytes.
+func WithMaxSize(size int64) Option {
+	return func(f *Fetcher) {
+		if size > 0 {
+			f.maxSize = size
+		}
+	}
+}
+
+func WithMaxRedirects(n int) Option {
+	return func(f *Fetcher) {
+		if n >= 0 {
+			f.maxRedirects = n
+		}
+	}
+}
+
+// WithBlockList replaces the networks books are never fetched from.
+func WithBlockList(blockList []netip.Prefix) Option {
+	return func(f *Fetcher) {
+		f.blockList = blockList
+	}
+}
+
+// Check tells whether the url can be fetched at all, without connecting.
+// Addresses of host names are checked when connecting.
+func (f *Fetcher) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("url has no host")
+	}
+
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return f.checkAddr(ip)
+	}
+
+	return nil
+}
+
+func (f *Fetcher) checkAddr(ip netip.Addr) error {
+	ip = ip.Unmap()
+	for _, prefix := range f.blockList {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("address %s is not allowed", ip)
+		}
+	}
+
+	return nil
+}
+
+// Fetch downloads the url to w and returns the name of the file, taken from
+// the Content-Disposition header, the url path or the Content-Type in that
+// order.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, w io.Writer) (string, error) {
+	if err := f.Check(rawURL); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %v", err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", f.fetchError(rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+
+	if resp.ContentLength > f.maxSize {
+		return "", fmt.Errorf("file is larger than %d bytes", f.maxSize)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return "", f.fetchError(rawURL, err)
+	}
+
+	if n > f.maxSize {
+		return "", fmt.Errorf("file is larger than %d bytes", f.maxSize)
+	}
+
+	return fileName(resp), nil
+}
+
+func (f *Fetcher) fetchError(rawURL string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("failed to fetch %s: timed out after %s", rawURL, f.timeout)
+	}
+
+	return fmt.Errorf("failed to fetch %s: %v", rawURL, err)
+}
+
+// FileName guesses the name of the file behind the url from its path, for
+// use until the file is fetched.
+func FileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "book"
+	}
+
+	if name := cleanName(path.Base(u.Path)); name != "" {
+		return name
+	}
+
+	return "book"
+}
+
+func fileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := cleanName(params["filename"]); name != "" {
+			return name
+		}
+	}
+
+	// the url after redirects
+	name := cleanName(path.Base(resp.Request.URL.Path))
+	if path.Ext(name) != "" {
+		return name
+	}
+
+	if name == "" {
+		name = "book"
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return name + contentTypeExtensions[contentType]
+}
+
+// cleanName keeps the last element of a name and drops characters that do
+// not belong in a file name.
+func cleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+
+	return strings.TrimSpace(name)
+}
@@ -1,9 +1,28 @@
 package reader
 
-import "BookStore/internal/control/model"
+import (
+	"BookStore/internal/control/model"
+	"io"
+)
 
 type BookReader interface {
 	Parse(path string) (string, error)
 	GetChaptersCount(path string) (uint, error)
 	GetBookInfo(path string) (*model.BookInfo, error)
+	GetToc(path string) ([]*model.Chapter, error)
+	ParseBlocks(path string) ([]*model.Block, error)
+	GetNotes(path string) ([]*model.Note, error)
+	GetCover(path string) (*model.Image, error)
+	GetImage(path string, name string) (*model.Image, error)
+}
+
+// BookIngester reads a book in a single pass when it is uploaded and writes
+// it out with the metadata of the library when it is downloaded, in its own
+// format or converted to another.
+type BookIngester interface {
+	BookReader
+	Ingest(path string, w io.Writer, profiles []Profile) (*Ingestion, error)
+	Export(path string, w io.Writer, info *model.BookInfo, cover *model.Image) error
+	WritesMetadata(format string) bool
+	Convert(path, format string, w io.Writer, info *model.BookInfo, cover *model.Image) error
 }
@@ -0,0 +1,91 @@
+package reader
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UnwrapArchive extracts the book from a single-entry zip archive such as
+// book.fb2.zip next to the archive and removes the archive. Files that are
+// not zip archives (EPUB included) are returned unchanged.
+func UnwrapArchive(path string) (string, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if format != FormatZip {
+		return path, nil
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer r.Close()
+
+	var entry *zip.File
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+
+		if entry != nil {
+			return "", fmt.Errorf("archive must contain a single book")
+		}
+		entry = f
+	}
+
+	if entry == nil {
+		return "", fmt.Errorf("archive is empty")
+	}
+
+	name := filepath.Base(entry.Name)
+	dest := strings.TrimSuffix(path, filepath.Ext(path))
+	if ext := strings.ToLower(filepath.Ext(name)); strings.ToLower(filepath.Ext(dest)) != ext {
+		dest += ext
+	}
+	if dest == path {
+		dest = path + "_" + name
+	}
+
+	if err := extractEntry(entry, dest); err != nil {
+		return "", err
+	}
+
+	if format, err := DetectFormat(dest); err != nil || format == FormatZip {
+		os.Remove(dest)
+		return "", fmt.Errorf("unsupported file type in archive: %s", name)
+	}
+
+	r.Close()
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove archive: %v", err)
+	}
+
+	return dest, nil
+}
+
+func extractEntry(entry *zip.File, dest string) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open archive entry: %v", err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, rc); err != nil {
+		return fmt.Errorf("failed to extract archive entry: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// inlineBuilder collects the inline runs of a text block, collapsing
+// whitespace the way a browser would and merging runs of the same style.
+type inlineBuilder struct {
+	inlines []model.Inline
+}
+
+func (ib *inlineBuilder) add(text string, style model.Inline) {
+	var sb strings.Builder
+	space := ib.endsWithSpace()
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		sb.WriteRune(r)
+		space = false
+	}
+
+	ib.append(sb.String(), style)
+}
+
+// lineBreak adds a forced line break, as <br> does.
+func (ib *inlineBuilder) lineBreak() {
+	if n := len(ib.inlines); n > 0 {
+		ib.inlines[n-1].Text = strings.TrimRight(ib.inlines[n-1].Text, " ")
+	}
+	ib.append("\n", model.Inline{})
+}
+
+func (ib *inlineBuilder) append(text string, style model.Inline) {
+	if text == "" {
+		return
+	}
+
+	style.Text = text
+	if n := len(ib.inlines); n > 0 {
+		last := &ib.inlines[n-1]
+		if last.Emphasis == style.Emphasis && last.Strong == style.Strong && last.Href == style.Href && last.Note == style.Note {
+			last.Text += text
+			return
+		}
+	}
+
+	ib.inlines = append(ib.inlines, style)
+}
+
+func (ib *inlineBuilder) endsWithSpace() bool {
+	if len(ib.inlines) == 0 {
+		return true
+	}
+
+	last := ib.inlines[len(ib.inlines)-1].Text
+	r, _ := utf8.DecodeLastRuneInString(last)
+	return unicode.IsSpace(r)
+}
+
+// finish returns the collected inlines without leading and trailing
+// whitespace, or nil when there is no text, and resets the builder.
+func (ib *inlineBuilder) finish() []model.Inline {
+	inlines := ib.inlines
+	ib.inlines = nil
+
+	for len(inlines) > 0 {
+		inlines[0].Text = strings.TrimLeftFunc(inlines[0].Text, unicode.IsSpace)
+		if inlines[0].Text != "" {
+			break
+		}
+		inlines = inlines[1:]
+	}
+
+	for len(inlines) > 0 {
+		n := len(inlines) - 1
+		inlines[n].Text = strings.TrimRightFunc(inlines[n].Text, unicode.IsSpace)
+		if inlines[n].Text != "" {
+			break
+		}
+		inlines = inlines[:n]
+	}
+
+	if len(inlines) == 0 {
+		return nil
+	}
+
+	return inlines
+}
+
+// linkNotes points the inlines that link to a note at the note's ref and
+// marks them as note references. resolve turns an href into a ref.
+func linkNotes(blocks []*model.Block, notes []*model.Note, resolve func(href string) string) {
+	refs := map[string]bool{}
+	for _, n := range notes {
+		refs[n.Ref] = true
+	}
+
+	var walk func(blocks []*model.Block)
+	walk = func(blocks []*model.Block) {
+		for _, b := range blocks {
+			for i := range b.Inlines {
+				in := &b.Inlines[i]
+				if in.Href == "" {
+					continue
+				}
+				if ref := resolve(in.Href); refs[ref] {
+					in.Href = ref
+					in.Note = true
+				}
+			}
+			walk(b.Children)
+		}
+	}
+	walk(blocks)
+	for _, n := range notes {
+		walk(n.Blocks)
+	}
+}
+
+func textBlock(kind, text string) *model.Block {
+	return &model.Block{Type: kind, Inlines: []model.Inline{{Text: text}}}
+}
+
+func childSeparator(b *model.Block) string {
+	if b.Type == model.BlockStanza {
+		return "\n"
+	}
+
+	return "\n\n"
+}
+
+// BlocksText renders blocks as plain text. Page boundaries of the block view
+// are computed on this text so that they match the plain text pagination.
+func BlocksText(blocks []*model.Block) string {
+	var w blockWriter
+	w.write(blocks, "\n\n")
+	return w.sb.String()
+}
+
+// blockWriter renders blocks as plain text and records the rune offsets of
+// the headings, which start chapters in the block view.
+type blockWriter struct {
+	sb       strings.Builder
+	runes    uint
+	headings []uint
+}
+
+func (w *blockWriter) write(blocks []*model.Block, sep string) {
+	for i, b := range blocks {
+		if i > 0 {
+			w.writeString(sep)
+		}
+
+		if b.IsContainer() {
+			w.write(b.Children, childSeparator(b))
+			continue
+		}
+
+		if b.Type == model.BlockHeading {
+			w.headings = append(w.headings, w.runes)
+		}
+		w.writeString(inlinesText(b.Inlines))
+	}
+}
+
+func (w *blockWriter) writeString(s string) {
+	w.sb.WriteString(s)
+	w.runes += uint(utf8.RuneCountInString(s))
+}
+
+func inlinesText(inlines []model.Inline) string {
+	var sb strings.Builder
+	for _, in := range inlines {
+		sb.WriteString(in.Text)
+	}
+
+	return sb.String()
+}
+
+// BlockPages paginates the text of the blocks for PageBlocks.
+func BlockPages(blocks []*model.Block, profile Profile) *PageIndex {
+	var w blockWriter
+	w.write(blocks, "\n\n")
+
+	return NewPageIndex(w.sb.String(), w.headings, profile)
+}
+
+// PageBlocks returns the blocks of a page of the index BlockPages made of
+// them, starting from 1. Blocks that cross a page boundary are cut so that
+// every piece of text appears on exactly one page.
+func PageBlocks(blocks []*model.Block, idx *PageIndex, page uint) ([]*model.Block, bool) {
+	if page == 0 || (page > idx.Count() && page > 1) {
+		return nil, false
+	}
+
+	from := idx.PageEnd(page - 1)
+	to := idx.PageEnd(page)
+
+	s := &blockSlicer{from: int(from), to: int(to), total: int(idx.RuneCount)}
+	return s.slice(blocks, "\n\n"), true
+}
+
+type blockSlicer struct {
+	pos      int
+	from, to int
+	total    int
+}
+
+func (s *blockSlicer) slice(blocks []*model.Block, sep string) []*model.Block {
+	var out []*model.Block
+
+	for i, b := range blocks {
+		if i > 0 {
+			s.pos += utf8.RuneCountInString(sep)
+		}
+
+		if b.IsContainer() {
+			children := s.slice(b.Children, childSeparator(b))
+			if len(children) > 0 {
+				part := *b
+				part.Children = children
+				out = append(out, &part)
+			}
+			continue
+		}
+
+		start := s.pos
+		for _, in := range b.Inlines {
+			s.pos += utf8.RuneCountInString(in.Text)
+		}
+
+		if start == s.pos {
+			if start >= s.from && (start < s.to || s.to == s.total) {
+				out = append(out, b)
+			}
+			continue
+		}
+
+		if start >= s.to || s.pos <= s.from {
+			continue
+		}
+
+		part := *b
+		part.Inlines = sliceInlines(b.Inlines, s.from-start, s.to-start)
+		out = append(out, &part)
+	}
+
+	return out
+}
+
+func sliceInlines(inlines []model.Inline, from, to int) []model.Inline {
+	var out []model.Inline
+	var pos int
+
+	for _, in := range inlines {
+		runes := []rune(in.Text)
+		start, end := pos, pos+len(runes)
+		pos = end
+
+		if end <= from || start >= to {
+			continue
+		}
+
+		part := in
+		part.Text = string(runes[max(from-start, 0):min(to-start, len(runes))])
+		out = append(out, part)
+	}
+
+	return out
+}
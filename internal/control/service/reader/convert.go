@@ -0,0 +1,179 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ConvertFormats are the formats a book of any format can be converted to.
+var ConvertFormats = []string{"epub", "fb2", "txt"}
+
+var fileNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// convertedBook is what a book is converted from: its parsed content and the
+// metadata it has in the library.
+type convertedBook struct {
+	info   *model.BookInfo
+	cover  *model.Image
+	uuid   string
+	blocks []*model.Block
+	notes  []*model.Note
+	// images are the images the blocks show by their src, in the order they
+	// come in, under the names they are written with
+	srcs   []string
+	images map[string]*model.Image
+	names  map[string]string
+}
+
+// Convert writes the book with the given key to w in another format, made
+// from the blocks, notes and images the reader parses it into and the
+// metadata in info. The formatting of the book is lost on the way.
+func (s *ReaderService) Convert(key, format string, w io.Writer, info *model.BookInfo, cover *model.Image) error {
+	if !slices.Contains(ConvertFormats, format) {
+		return fmt.Errorf("unsupported format to convert to: %s", format)
+	}
+
+	blocks, err := s.ParseBlocks(key)
+	if err != nil {
+		return fmt.Errorf("failed to parse book: %v", err)
+	}
+
+	notes, err := s.GetNotes(key)
+	if err != nil {
+		return fmt.Errorf("failed to read notes: %v", err)
+	}
+
+	sum := sha1.Sum([]byte(key))
+	book := &convertedBook{
+		info:   info,
+		cover:  cover,
+		uuid:   fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]),
+		blocks: blocks,
+		notes:  notes,
+		images: map[string]*model.Image{},
+		names:  map[string]string{},
+	}
+
+	srcs := imageSources(blocks)
+	for _, n := range notes {
+		srcs = append(srcs, imageSources(n.Blocks)...)
+	}
+
+	taken := map[string]bool{}
+	for _, src := range srcs {
+		if _, ok := book.images[src]; ok || isExternalLink(src) {
+			continue
+		}
+
+		// images the book does not have are left out
+		image, err := s.GetImage(key, src)
+		if err != nil || image == nil {
+			continue
+		}
+		book.srcs = append(book.srcs, src)
+		book.images[src] = image
+		book.names[src] = imageName(image, taken)
+	}
+
+	switch format {
+	case "epub":
+		return book.writeEpub(w)
+	case "fb2":
+		return book.writeFb2(w)
+	}
+
+	return book.writeTxt(w)
+}
+
+// writeTxt writes a header with the title and the authors, the text and
+// then the notes. The header is ended the way Project Gutenberg ends it, so
+// the TXT adapter reads the metadata back from it and not as text. Other
+// metadata is lost.
+func (b *convertedBook) writeTxt(w io.Writer) error {
+	var authors []string
+	for _, c := range b.info.Authors {
+		if c.Role == roleAuthor {
+			authors = append(authors, c.Name)
+		}
+	}
+	author := strings.Join(authors, "; ")
+	if author == "" {
+		author = b.info.Author
+	}
+
+	bw := bufio.NewWriter(w)
+	if b.info.Title != "" {
+		bw.WriteString("Title: " + b.info.Title + "\n")
+	}
+	if author != "" {
+		bw.WriteString("Author: " + author + "\n")
+	}
+	bw.WriteString("\n" + txtStartMarker + "\n\n" + BlocksText(b.blocks) + "\n")
+
+	for i, n := range b.notes {
+		if i == 0 {
+			bw.WriteString("\n* * *\n")
+		}
+
+		bw.WriteString("\n")
+		if n.Title != "" {
+			bw.WriteString(n.Title + " ")
+		}
+		bw.WriteString(n.Text + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// noteIds numbers the notes of the book for the ids of their elements.
+func (b *convertedBook) noteIds() map[string]string {
+	ids := make(map[string]string, len(b.notes))
+	for i, n := range b.notes {
+		ids[n.Ref] = fmt.Sprintf("n%d", i+1)
+	}
+
+	return ids
+}
+
+func imageSources(blocks []*model.Block) []string {
+	var srcs []string
+	for _, b := range blocks {
+		if b.Type == model.BlockImage && b.Src != "" {
+			srcs = append(srcs, b.Src)
+		}
+		srcs = append(srcs, imageSources(b.Children)...)
+	}
+
+	return srcs
+}
+
+// imageName names an image after the file it came from, made safe for
+// archive entries and xml ids and unique among the names taken.
+func imageName(image *model.Image, taken map[string]bool) string {
+	name := strings.Trim(fileNamePattern.ReplaceAllString(path.Base(image.Name), "_"), "._")
+	ext := path.Ext(name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(image.ContentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		name += ext
+	}
+
+	// ids must not start with a digit
+	base := "image-" + strings.TrimSuffix(name, ext)
+	name = base + ext
+	for i := 1; taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	taken[name] = true
+
+	return name
+}
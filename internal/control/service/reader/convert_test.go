@@ -0,0 +1,79 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"BookStore/internal/control/service/cache"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestConvertTxt checks that a book converted to TXT reads back with its
+// title, authors and text, and without the header in the text. Other
+// metadata is not kept by the format.
+func TestConvertTxt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "book.fb2")
+	err := os.WriteFile(path, []byte(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><genre>prose</genre><book-title>Ignored</book-title><lang>en</lang></title-info></description>
+<body>
+<section><title><p>Chapter 1</p></title><p>The rain had not stopped since morning.</p></section>
+</body>
+</FictionBook>
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &model.BookInfo{
+		Title: "Fathers and Sons",
+		Authors: []model.Contributor{
+			{Name: "Ivan Turgenev", Role: roleAuthor},
+			{Name: "Homer", Role: roleAuthor},
+			{Name: "Constance Garnett", Role: "translator"},
+		},
+		Series:   "Novels",
+		Language: "en",
+	}
+
+	out := filepath.Join(dir, "book.txt")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewService(WithCache(cache.NewService())).Convert(path, "txt", f, info, nil)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txt := &TxtReaderAdapter{}
+	got, err := txt.GetBookInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != info.Title {
+		t.Errorf("Title = %q, want %q", got.Title, info.Title)
+	}
+	var names []string
+	for _, c := range got.Authors {
+		names = append(names, c.Name+"/"+c.Role)
+	}
+	if want := []string{"Ivan Turgenev/" + roleAuthor, "Homer/" + roleAuthor}; !slices.Equal(names, want) {
+		t.Errorf("Authors = %q, want %q", names, want)
+	}
+	if got.Series != "" || got.Language != "" {
+		t.Errorf("Series, Language = %q, %q, want them lost", got.Series, got.Language)
+	}
+
+	text, err := txt.Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Chapter 1\n\nThe rain had not stopped since morning."; strings.TrimSpace(text) != want {
+		t.Errorf("Parse = %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,107 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+	"regexp"
+	"unicode/utf8"
+)
+
+var (
+	charsetPattern     = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([a-zA-Z0-9_\-]+)`)
+	xmlEncodingPattern = regexp.MustCompile(`encoding\s*=\s*["']([a-zA-Z0-9_\-]+)`)
+)
+
+// decodeText converts raw book data to UTF-8. The charset is used when it is
+// known (e.g. from an HTML meta tag), otherwise byte order marks and UTF-8
+// validity are checked and legacy Cyrillic encodings are guessed.
+func decodeText(data []byte, charset string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		dec := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder()
+		if out, err := dec.Bytes(data); err == nil {
+			return string(out)
+		}
+	}
+
+	if charset != "" {
+		if enc, err := htmlindex.Get(charset); err == nil {
+			if out, err := enc.NewDecoder().Bytes(data); err == nil {
+				return string(out)
+			}
+		}
+	}
+
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	out, err := guessEncoding(data).NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+
+	return string(out)
+}
+
+// guessEncoding tells Windows-1251 from KOI8-R by where lowercase Cyrillic
+// letters, which dominate any Russian text, fall in the byte table.
+func guessEncoding(data []byte) encoding.Encoding {
+	var cp1251, koi8 int
+	for _, b := range data {
+		switch {
+		case b >= 0xE0:
+			cp1251++
+		case b >= 0xC0:
+			koi8++
+		}
+	}
+
+	switch {
+	case cp1251 == 0 && koi8 == 0:
+		return charmap.Windows1252
+	case koi8 > cp1251:
+		return charmap.KOI8R
+	}
+
+	return charmap.Windows1251
+}
+
+func sniffCharset(data []byte) string {
+	head := data[:min(len(data), 4096)]
+	if m := charsetPattern.FindSubmatch(head); m != nil {
+		return string(m[1])
+	}
+
+	if bytes.HasPrefix(head, []byte("<?xml")) {
+		if m := xmlEncodingPattern.FindSubmatch(head); m != nil {
+			return string(m[1])
+		}
+	}
+
+	return ""
+}
+
+// newXmlDecoder returns a decoder that also reads documents declared in a
+// legacy encoding, which FB2 files often are.
+func newXmlDecoder(r io.Reader) *xml.Decoder {
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding %s: %v", charset, err)
+		}
+
+		return enc.NewDecoder().Reader(input), nil
+	}
+
+	return dec
+}
@@ -3,78 +3,405 @@ package reader
 import (
 	"BookStore/internal/control/model"
 	"archive/zip"
+	"bytes"
 	"encoding/xml"
 	"fmt"
+	"golang.org/x/net/html"
 	"io"
-	"path/filepath"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
 	"strings"
 )
 
 type EpubReaderAdapter struct {
+	// maxEntrySize bounds what an entry of the archive may unpack to
+	maxEntrySize int64
 }
 
 func (t *EpubReaderAdapter) Parse(path string) (string, error) {
-	var content strings.Builder
+	var sb strings.Builder
+	if _, err := t.stream(path, newTextSink(&sb, nil)); err != nil {
+		return "", err
+	}
 
-	r, err := zip.OpenReader(path)
+	return sb.String(), nil
+}
+
+func (t *EpubReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	ingestion, err := t.stream(path, newTextSink(io.Discard, nil))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return ingestion.Chapters, nil
+}
+
+func (t *EpubReaderAdapter) ParseBlocks(bookPath string) ([]*model.Block, error) {
+	blocks, _, err := t.readBlocks(bookPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+func (t *EpubReaderAdapter) GetNotes(bookPath string) ([]*model.Note, error) {
+	_, notes, err := t.readBlocks(bookPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// readBlocks converts the spine documents into blocks. Image sources, links
+// and note refs are made paths inside the archive, so a note with id n1 in
+// OEBPS/notes.xhtml has the ref OEBPS/notes.xhtml#n1.
+func (t *EpubReaderAdapter) readBlocks(bookPath string) ([]*model.Block, []*model.Note, error) {
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer r.Close()
 
 	opfPath, err := t.getOpfPath(r)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	manifest, spineIds, err := t.getManifestAndSpineIds(r, opfPath)
+	pkg, err := t.getPackage(r, opfPath)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	for _, id := range spineIds {
-		href := manifest[id]
-		if href != "cover.xhtml" && href != "" {
-			for _, f := range r.File {
-				if strings.HasSuffix(f.Name, href) {
-					rc, err := f.Open()
-					if err != nil {
-						return "", err
-					}
-					defer rc.Close()
+	manifest := map[string]model.Item{}
+	for _, item := range pkg.Manifest.Items {
+		manifest[item.ID] = item
+	}
 
-					data, err := io.ReadAll(rc)
-					if err != nil {
-						return "", err
-					}
+	var blocks []*model.Block
+	var notes []*model.Note
+	for _, ref := range pkg.Spine.Itemrefs {
+		href := manifest[ref.IDRef].Href
+		if href == "cover.xhtml" || href == "" {
+			continue
+		}
 
-					text, err := t.textFromXhtml(string(data))
-					if err != nil {
-						continue
-					}
+		f := t.findFile(r, resolveHref(path.Dir(opfPath), href), href)
+		if f == nil {
+			continue
+		}
 
-					content.WriteString(text)
-					content.WriteString("\n")
-					break
-				}
+		data, err := t.readFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+
+		resolve := func(ref string) string {
+			if isExternalLink(ref) {
+				return ref
+			}
+			if strings.HasPrefix(ref, "#") {
+				return f.Name + ref
 			}
+			return resolveHref(path.Dir(f.Name), ref)
+		}
+
+		fileBlocks, fileNotes := blocksFromHtml(doc)
+		rewriteRefs(fileBlocks, resolve)
+		for _, n := range fileNotes {
+			n.Ref = f.Name + "#" + n.Ref
+			rewriteRefs(n.Blocks, resolve)
 		}
+
+		blocks = append(blocks, fileBlocks...)
+		notes = append(notes, fileNotes...)
+	}
+
+	linkNotes(blocks, notes, func(href string) string { return href })
+
+	return blocks, notes, nil
+}
+
+func (t *EpubReaderAdapter) GetCover(bookPath string) (*model.Image, error) {
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	opfPath, err := t.getOpfPath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := t.getPackage(r, opfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cover := t.coverItem(pkg)
+	if cover == nil {
+		return nil, nil
+	}
+
+	name := resolveHref(path.Dir(opfPath), cover.Href)
+	f := t.findFile(r, name, cover.Href)
+	if f == nil {
+		return nil, nil
+	}
+
+	data, err := t.readFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return newImage(f.Name, data)
+}
+
+// coverItem finds the cover image declared by the EPUB 3 cover-image
+// property or the EPUB 2 cover meta, falling back to an image named cover.
+func (t *EpubReaderAdapter) coverItem(pkg *model.Package) *model.Item {
+	items := pkg.Manifest.Items
+	for i := range items {
+		if strings.Contains(" "+items[i].Properties+" ", " cover-image ") {
+			return &items[i]
+		}
+	}
+
+	for _, meta := range pkg.Metadata.Metas {
+		if meta.Name != "cover" {
+			continue
+		}
+		for i := range items {
+			if items[i].ID == meta.Content && strings.HasPrefix(items[i].MediaType, "image/") {
+				return &items[i]
+			}
+		}
+	}
+
+	for i := range items {
+		name := strings.ToLower(items[i].ID + " " + path.Base(items[i].Href))
+		if strings.HasPrefix(items[i].MediaType, "image/") && strings.Contains(name, "cover") {
+			return &items[i]
+		}
+	}
+
+	return nil
+}
+
+// GetImage returns an image by its path inside the EPUB archive.
+func (t *EpubReaderAdapter) GetImage(bookPath string, name string) (*model.Image, error) {
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+
+		data, err := t.readFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return newImage(name, data)
+	}
+
+	return nil, errImageNotFound
+}
+
+// stream writes the text of the spine documents to the sink one document at
+// a time. Chapters come from the table of contents, or are the non-empty
+// spine documents when the table of contents points to none of them.
+func (t *EpubReaderAdapter) stream(bookPath string, sink *textSink) (*Ingestion, error) {
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	opfPath, err := t.getOpfPath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := t.getPackage(r, opfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info := t.bookInfo(pkg)
+
+	manifest := map[string]model.Item{}
+	for _, item := range pkg.Manifest.Items {
+		manifest[item.ID] = item
+	}
+
+	type spineItem struct {
+		name string
+		file *zip.File
+	}
+
+	opfDir := path.Dir(opfPath)
+	var spine []spineItem
+	last := map[string]int{}
+	for _, ref := range pkg.Spine.Itemrefs {
+		href := manifest[ref.IDRef].Href
+		if href == "cover.xhtml" || href == "" {
+			continue
+		}
+
+		name := resolveHref(opfDir, href)
+		f := t.findFile(r, name, href)
+		if f == nil {
+			continue
+		}
+
+		last[name] = len(spine)
+		spine = append(spine, spineItem{name: name, file: f})
+	}
+
+	// a table of contents entry points to the last occurrence of its
+	// document in the spine, at the element with the id of the fragment
+	toc := t.readToc(r, pkg, manifest, opfDir)
+	chapters := make([]*model.Chapter, len(toc))
+	targets := map[int][]int{}
+	for i, entry := range toc {
+		name, _, _ := strings.Cut(entry.target, "#")
+		if j, ok := last[name]; ok {
+			targets[j] = append(targets[j], i)
+		}
+	}
+
+	for i, item := range spine {
+		text, anchors, err := t.readText(item.file)
+		if err != nil {
+			return nil, err
+		}
+
+		var marks []chapterMark
+		if i == last[item.name] {
+			for _, j := range targets[i] {
+				chapters[j] = &model.Chapter{Title: toc[j].title, Level: toc[j].level}
+				_, id, _ := strings.Cut(toc[j].target, "#")
+				marks = append(marks, chapterMark{offset: anchors[id], chapter: chapters[j]})
+			}
+		}
+
+		if len(targets) == 0 && strings.TrimSpace(text) != "" {
+			chapter := &model.Chapter{Title: chapterTitle(text), Level: 1}
+			chapters = append(chapters, chapter)
+			marks = append(marks, chapterMark{chapter: chapter})
+		}
+
+		writeMarked(sink, text, marks)
+		sink.WriteString("\n")
+
+		// an anchor after the last paragraph starts the next document
+		for _, m := range marks {
+			if m.offset > len(text) {
+				sink.chapter(m.chapter)
+			}
+		}
+	}
+
+	var found []*model.Chapter
+	var count uint
+	for _, c := range chapters {
+		if c == nil {
+			continue
+		}
+
+		found = append(found, c)
+		if c.Level == 1 {
+			count++
+		}
+	}
+
+	return &Ingestion{Info: info, ChaptersCount: count, Chapters: found}, nil
+}
+
+// chapterMark is a chapter that starts at a byte offset into a text.
+type chapterMark struct {
+	offset  int
+	chapter *model.Chapter
+}
+
+// writeMarked writes text to the sink, starting the chapters of the marks
+// that fall inside it where they belong.
+func writeMarked(sink *textSink, text string, marks []chapterMark) {
+	sort.SliceStable(marks, func(i, j int) bool { return marks[i].offset < marks[j].offset })
+
+	var pos int
+	for _, m := range marks {
+		if m.offset > len(text) {
+			break
+		}
+
+		sink.WriteString(text[pos:m.offset])
+		sink.chapter(m.chapter)
+		pos = m.offset
+	}
+	sink.WriteString(text[pos:])
+}
+
+func (t *EpubReaderAdapter) findFile(r *zip.ReadCloser, name, href string) *zip.File {
+	for _, f := range r.File {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	for _, f := range r.File {
+		if strings.HasSuffix(f.Name, href) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// readFile reads an entry of the archive. Uploads are validated, but books
+// stored before that are not, so oversized entries are refused here too.
+func (t *EpubReaderAdapter) readFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(t.maxEntrySize) {
+		return nil, fmt.Errorf("archive entry %s is too large", f.Name)
 	}
 
-	return content.String(), nil
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// the size in the header is what the archive claims, not what it holds
+	data, err := io.ReadAll(io.LimitReader(rc, t.maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > t.maxEntrySize {
+		return nil, fmt.Errorf("archive entry %s is too large", f.Name)
+	}
+
+	return data, nil
 }
 
 func (t *EpubReaderAdapter) getOpfPath(r *zip.ReadCloser) (string, error) {
 	var opfPath string
 	for _, f := range r.File {
 		if f.Name == "META-INF/container.xml" {
-			rc, err := f.Open()
-			if err != nil {
-				return "", err
-			}
-			defer rc.Close()
-
-			data, err := io.ReadAll(rc)
+			data, err := t.readFile(f)
 			if err != nil {
 				return "", err
 			}
@@ -84,72 +411,52 @@ func (t *EpubReaderAdapter) getOpfPath(r *zip.ReadCloser) (string, error) {
 				return "", err
 			}
 
+			if len(container.Rootfiles) == 0 {
+				return "", fmt.Errorf("container.xml has no rootfile")
+			}
+
 			opfPath = container.Rootfiles[0].Rootfile.FullPath
 			break
 		}
 	}
 
+	if opfPath == "" {
+		return "", fmt.Errorf("package document not found")
+	}
+
 	return opfPath, nil
 }
 
-func (t *EpubReaderAdapter) getManifestAndSpineIds(r *zip.ReadCloser, opfPath string) (map[string]string, []string, error) {
-	var manifest = map[string]string{}
-	var spineIds []string
-
+func (t *EpubReaderAdapter) getPackage(r *zip.ReadCloser, opfPath string) (*model.Package, error) {
 	for _, f := range r.File {
 		if f.Name == opfPath {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, nil, err
-			}
-			defer rc.Close()
-
-			data, err := io.ReadAll(rc)
+			data, err := t.readFile(f)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 
 			var pkg model.Package
-			if err := xml.Unmarshal(data, &pkg); err != nil {
-				return nil, nil, err
-			}
-
-			for _, item := range pkg.Manifest.Items {
-				manifest[item.ID] = item.Href
-			}
-
-			for _, ref := range pkg.Spine.Itemrefs {
-				spineIds = append(spineIds, ref.IDRef)
+			if err := newXmlDecoder(bytes.NewReader(data)).Decode(&pkg); err != nil {
+				return nil, err
 			}
 
-			break
+			return &pkg, nil
 		}
 	}
 
-	return manifest, spineIds, nil
+	return nil, fmt.Errorf("opf file not found")
 }
 
 func (t *EpubReaderAdapter) GetChaptersCount(path string) (uint, error) {
-	r, err := zip.OpenReader(path)
+	ingestion, err := t.stream(path, newTextSink(io.Discard, nil))
 	if err != nil {
 		return 0, err
 	}
-	defer r.Close()
-
-	var count uint
-	for _, f := range r.File {
-		if filepath.Ext(f.Name) == ".html" || filepath.Ext(f.Name) == ".xhtml" {
-			if !strings.HasPrefix(f.Name, "cover") {
-				count++
-			}
-		}
-	}
 
-	return count, nil
+	return ingestion.ChaptersCount, nil
 }
 
 func (t *EpubReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
-	var author, title, description string
 	r, err := zip.OpenReader(path)
 	if err != nil {
 		return nil, err
@@ -161,57 +468,118 @@ func (t *EpubReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
 		return nil, err
 	}
 
-	if opfPath == "" {
-		return nil, fmt.Errorf("opf path not found")
+	pkg, err := t.getPackage(r, opfPath)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, f := range r.File {
-		if f.Name == opfPath {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, err
+	return t.bookInfo(pkg), nil
+}
+
+// bookInfo reads the metadata of the package. Roles come from opf attributes
+// in EPUB 2 and from meta elements refining the creators in EPUB 3, which
+// also name the series; books from calibre keep it in their own meta.
+func (t *EpubReaderAdapter) bookInfo(pkg *model.Package) *model.BookInfo {
+	metadata := pkg.Metadata
+	bookInfo := &model.BookInfo{}
+
+	refines := map[string]map[string]string{}
+	var collection string
+	for _, meta := range metadata.Metas {
+		value := strings.TrimSpace(meta.Value)
+		switch {
+		case meta.Refines != "":
+			id := strings.TrimPrefix(meta.Refines, "#")
+			if refines[id] == nil {
+				refines[id] = map[string]string{}
 			}
-			defer rc.Close()
+			refines[id][meta.Property] = value
+		case meta.Property == "belongs-to-collection" && collection == "":
+			bookInfo.Series, collection = value, meta.ID
+		case meta.Name == "calibre:series":
+			bookInfo.Series = strings.TrimSpace(meta.Content)
+		case meta.Name == "calibre:series_index":
+			bookInfo.SeriesIndex = seriesIndex(meta.Content)
+		}
+	}
 
-			dec := xml.NewDecoder(rc)
-			for {
-				tok, err := dec.Token()
-				if err != nil {
-					break
-				}
+	if collection != "" {
+		if kind := refines[collection]["collection-type"]; kind != "" && kind != "series" {
+			bookInfo.Series = ""
+		} else if bookInfo.SeriesIndex == 0 {
+			bookInfo.SeriesIndex = seriesIndex(refines[collection]["group-position"])
+		}
+	}
 
-				switch elem := tok.(type) {
-				case xml.StartElement:
-					switch elem.Name.Local {
-					case "title":
-						var val string
-						if err := dec.DecodeElement(&val, &elem); err == nil && title == "" {
-							title = strings.TrimSpace(val)
-						}
-					case "creator":
-						var val string
-						if err := dec.DecodeElement(&val, &elem); err == nil && author == "" {
-							author = strings.TrimSpace(val)
-						}
-					case "description":
-						var val string
-						if err := dec.DecodeElement(&val, &elem); err == nil && description == "" {
-							description = strings.TrimSpace(val)
-						}
-					}
-				}
-			}
+	for _, title := range metadata.Titles {
+		if bookInfo.Title = strings.TrimSpace(title); bookInfo.Title != "" {
+			break
+		}
+	}
 
-			bookInfo := &model.BookInfo{
-				Title:      title,
-				Author:     author,
-				Annotation: description,
+	var authors []model.Contributor
+	for i, creator := range slices.Concat(metadata.Creators, metadata.Contributors) {
+		role := creator.Role
+		if role == "" && creator.ID != "" {
+			role = refines[creator.ID]["role"]
+		}
+		// contributors with no role are not taken for authors
+		if role == "" && i >= len(metadata.Creators) {
+			continue
+		}
+
+		if role = contributorRole(role); role == "translator" {
+			bookInfo.Translators = addUnique(bookInfo.Translators, creator.Name)
+			continue
+		}
+		authors = append(authors, model.Contributor{Name: creator.Name, Role: role})
+	}
+	setAuthors(bookInfo, authors)
+
+	for _, description := range metadata.Descriptions {
+		description = strings.TrimSpace(description)
+		if description == "" {
+			continue
+		}
+
+		// calibre writes the description as html
+		if strings.Contains(description, "<") {
+			if text, err := textFromHtml(strings.NewReader(description)); err == nil {
+				description = strings.TrimSpace(text)
 			}
+		}
+		bookInfo.Annotation = description
+		break
+	}
 
-			return bookInfo, nil
+	for _, subject := range metadata.Subjects {
+		bookInfo.Genres = addUnique(bookInfo.Genres, subject)
+	}
+
+	if len(metadata.Languages) > 0 {
+		bookInfo.Language = strings.TrimSpace(metadata.Languages[0])
+	}
+
+	if len(metadata.Publishers) > 0 {
+		bookInfo.Publisher = strings.TrimSpace(metadata.Publishers[0])
+	}
+
+	// EPUB 2 tells the publication date from the others by its event
+	for _, date := range metadata.Dates {
+		event := strings.ToLower(date.Event)
+		if event == "" || event == "publication" || bookInfo.PublishDate == "" {
+			bookInfo.PublishDate = strings.TrimSpace(date.Value)
+		}
+		if event == "publication" {
+			break
 		}
 	}
-	return nil, fmt.Errorf("failed to get book info")
+
+	for _, id := range metadata.Identifiers {
+		bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, id.Scheme, id.Value)
+	}
+
+	return bookInfo
 }
 
 //func (t *EpubReaderAdapter) GetBookPage(data string, pageNum uint) (string, error) {
@@ -252,9 +620,23 @@ func (t *EpubReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
 //	return strings.TrimSpace(string(runes[start:end])), nil
 //}
 
-func (t *EpubReaderAdapter) textFromXhtml(data string) (string, error) {
+// readText extracts the text of a spine document along with the offsets of
+// its anchors.
+func (t *EpubReaderAdapter) readText(f *zip.File) (string, map[string]int, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+
+	return t.textFromXhtml(rc)
+}
+
+func (t *EpubReaderAdapter) textFromXhtml(r io.Reader) (string, map[string]int, error) {
 	var extractor model.TextExtractor
-	dec := xml.NewDecoder(strings.NewReader(data))
+	var size, skip int
+	anchors := map[string]int{}
+	dec := newXmlDecoder(r)
 
 	for {
 		tok, err := dec.Token()
@@ -262,8 +644,30 @@ func (t *EpubReaderAdapter) textFromXhtml(data string) (string, error) {
 			break
 		}
 
+		if skip > 0 {
+			switch tok.(type) {
+			case xml.StartElement:
+				skip++
+			case xml.EndElement:
+				skip--
+			}
+			continue
+		}
+
 		switch elem := tok.(type) {
 		case xml.StartElement:
+			if t.isNote(elem) {
+				skip = 1
+				continue
+			}
+			for _, attr := range elem.Attr {
+				if attr.Name.Local == "id" && attr.Value != "" {
+					anchors[attr.Value] = size
+					if len(extractor.Data) > 0 {
+						anchors[attr.Value] += 2
+					}
+				}
+			}
 			if elem.Name.Local == "p" || elem.Name.Local == "div" {
 				extractor.Tag = true
 				extractor.Current.Reset()
@@ -277,11 +681,194 @@ func (t *EpubReaderAdapter) textFromXhtml(data string) (string, error) {
 				extractor.Tag = false
 				raw := strings.TrimSpace(extractor.Current.String())
 				if raw != "" {
+					if len(extractor.Data) > 0 {
+						size += 2
+					}
 					extractor.Data = append(extractor.Data, raw)
+					size += len(raw)
+				}
+			}
+		}
+	}
+
+	return strings.Join(extractor.Data, "\n\n"), anchors, nil
+}
+
+// isNote reports whether the element is a footnote or a collection of them,
+// the same elements isNoteElement finds in parsed HTML.
+func (t *EpubReaderAdapter) isNote(elem xml.StartElement) bool {
+	for _, attr := range elem.Attr {
+		var kinds []string
+		switch attr.Name.Local {
+		case "type":
+			kinds = strings.Fields(attr.Value)
+		case "class":
+			for _, class := range strings.Fields(attr.Value) {
+				if strings.EqualFold(class, "footnote") {
+					return true
+				}
+			}
+		}
+
+		for _, kind := range kinds {
+			switch kind {
+			case "footnote", "endnote", "rearnote", "note", "footnotes", "endnotes", "rearnotes":
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type tocEntry struct {
+	title  string
+	level  int
+	target string
+}
+
+// readToc reads the table of contents from the EPUB 3 navigation document
+// and falls back to the EPUB 2 NCX. Targets are resolved to zip paths.
+func (t *EpubReaderAdapter) readToc(r *zip.ReadCloser, pkg *model.Package, manifest map[string]model.Item, opfDir string) []tocEntry {
+	for _, item := range pkg.Manifest.Items {
+		if !strings.Contains(" "+item.Properties+" ", " nav ") {
+			continue
+		}
+
+		name := resolveHref(opfDir, item.Href)
+		if f := t.findFile(r, name, item.Href); f != nil {
+			if data, err := t.readFile(f); err == nil {
+				if entries := t.readNav(data, path.Dir(name)); len(entries) > 0 {
+					return entries
+				}
+			}
+		}
+	}
+
+	ncx, ok := manifest[pkg.Spine.Toc]
+	if !ok {
+		for _, item := range pkg.Manifest.Items {
+			if item.MediaType == "application/x-dtbncx+xml" {
+				ncx, ok = item, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	name := resolveHref(opfDir, ncx.Href)
+	f := t.findFile(r, name, ncx.Href)
+	if f == nil {
+		return nil
+	}
+
+	data, err := t.readFile(f)
+	if err != nil {
+		return nil
+	}
+
+	var doc model.Ncx
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	var entries []tocEntry
+	var walk func(points []model.NavPoint, level int)
+	walk = func(points []model.NavPoint, level int) {
+		for _, p := range points {
+			entries = append(entries, tocEntry{
+				title:  strings.Join(strings.Fields(p.Label), " "),
+				level:  level,
+				target: resolveHref(path.Dir(name), p.Content.Src),
+			})
+			walk(p.NavPoints, level+1)
+		}
+	}
+	walk(doc.NavMap.NavPoints, 1)
+
+	return entries
+}
+
+func (t *EpubReaderAdapter) readNav(data []byte, dir string) []tocEntry {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var nav *html.Node
+	walkHtml(doc, func(n *html.Node) {
+		if n.Data != "nav" {
+			return
+		}
+		for _, attr := range n.Attr {
+			if attr.Key == "epub:type" && strings.Contains(attr.Val, "toc") && nav == nil {
+				nav = n
+			}
+		}
+	})
+	if nav == nil {
+		return nil
+	}
+
+	var entries []tocEntry
+	var walkList func(list *html.Node, level int)
+	walkList = func(list *html.Node, level int) {
+		for li := list.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.Data != "li" {
+				continue
+			}
+
+			for c := li.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type != html.ElementNode {
+					continue
+				}
+
+				switch c.Data {
+				case "a", "span":
+					var href string
+					for _, attr := range c.Attr {
+						if attr.Key == "href" {
+							href = attr.Val
+						}
+					}
+					entries = append(entries, tocEntry{
+						title:  strings.Join(strings.Fields(nodeText(c)), " "),
+						level:  level,
+						target: resolveHref(dir, href),
+					})
+				case "ol", "ul":
+					walkList(c, level+1)
 				}
 			}
 		}
 	}
 
-	return strings.Join(extractor.Data, "\n\n"), nil
+	for c := nav.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.Data == "ol" || c.Data == "ul") {
+			walkList(c, 1)
+		}
+	}
+
+	return entries
+}
+
+// resolveHref resolves a link found in a file of the dir directory to a path
+// inside the zip, keeping the #fragment if there is one.
+func resolveHref(dir, href string) string {
+	target, fragment, _ := strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+
+	if target != "" {
+		target = strings.TrimPrefix(path.Join(dir, target), "./")
+	}
+
+	if fragment != "" {
+		return target + "#" + fragment
+	}
+
+	return target
 }
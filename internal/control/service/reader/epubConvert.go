@@ -0,0 +1,327 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+const epubStyle = `.poem { margin: 1em 2em; }
+.stanza { margin-bottom: 1em; }
+.verse { margin: 0; text-indent: 0; }
+.epigraph { margin: 1em 0 1em 30%; font-style: italic; }
+.attribution { text-align: right; }
+.image { text-align: center; }
+.image img { max-width: 100%; }
+`
+
+// epubChapter is a document of the converted book, made of the blocks from
+// a heading up to the next heading of the same or a higher level.
+type epubChapter struct {
+	href   string
+	title  string
+	blocks []*model.Block
+}
+
+// writeEpub writes the book as an EPUB 3, a document for every chapter and
+// one for the notes.
+func (b *convertedBook) writeEpub(w io.Writer) error {
+	chapters := b.epubChapters()
+	notes := b.noteIds()
+
+	zw := zip.NewWriter(w)
+	add := func(name string, data []byte, method uint16) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			return err
+		}
+
+		_, err = fw.Write(data)
+		return err
+	}
+
+	// the mimetype must come first and not be compressed
+	if err := add("mimetype", []byte("application/epub+zip"), zip.Store); err != nil {
+		return err
+	}
+
+	container := `<?xml version="1.0" encoding="utf-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+	if err := add("META-INF/container.xml", []byte(container), zip.Deflate); err != nil {
+		return err
+	}
+
+	opf, err := b.epubPackage(chapters)
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if err := add("OEBPS/content.opf", opf, zip.Deflate); err != nil {
+		return err
+	}
+
+	if err := add("OEBPS/nav.xhtml", b.epubNav(chapters), zip.Deflate); err != nil {
+		return err
+	}
+
+	if err := add("OEBPS/style.css", []byte(epubStyle), zip.Deflate); err != nil {
+		return err
+	}
+
+	for _, chapter := range chapters {
+		x := &xhtmlWriter{images: b.names, notes: notes}
+		x.blocks(chapter.blocks)
+		if err := add("OEBPS/"+chapter.href, b.xhtml(chapter.title, "../style.css", x.sb.String()), zip.Deflate); err != nil {
+			return err
+		}
+	}
+
+	if len(b.notes) > 0 {
+		x := &xhtmlWriter{images: b.names, notes: notes}
+		x.sb.WriteString(`<section epub:type="footnotes">`)
+		for _, n := range b.notes {
+			x.sb.WriteString("\n" + `<aside epub:type="footnote" id="` + notes[n.Ref] + `">`)
+			x.blocks(n.Blocks)
+			x.sb.WriteString("</aside>")
+		}
+		x.sb.WriteString("\n</section>")
+		if err := add("OEBPS/text/notes.xhtml", b.xhtml("Notes", "../style.css", x.sb.String()), zip.Deflate); err != nil {
+			return err
+		}
+	}
+
+	for _, src := range b.srcs {
+		if err := add("OEBPS/images/"+b.names[src], b.images[src].Data, zip.Store); err != nil {
+			return err
+		}
+	}
+
+	if b.cover != nil {
+		if err := add("OEBPS/"+b.coverHref(), b.cover.Data, zip.Store); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// epubChapters splits the blocks at the headings of the highest level.
+func (b *convertedBook) epubChapters() []*epubChapter {
+	level := 0
+	for _, block := range b.blocks {
+		if block.Type == model.BlockHeading && (level == 0 || block.Level < level) {
+			level = block.Level
+		}
+	}
+
+	var chapters []*epubChapter
+	for _, block := range b.blocks {
+		if len(chapters) == 0 || block.Type == model.BlockHeading && block.Level <= level && len(chapters[len(chapters)-1].blocks) > 0 {
+			chapters = append(chapters, &epubChapter{href: fmt.Sprintf("text/chapter%03d.xhtml", len(chapters)+1)})
+		}
+
+		chapter := chapters[len(chapters)-1]
+		if chapter.title == "" && block.Type == model.BlockHeading {
+			chapter.title = strings.Join(strings.Fields(inlinesText(block.Inlines)), " ")
+		}
+		chapter.blocks = append(chapter.blocks, block)
+	}
+
+	if len(chapters) == 0 {
+		chapters = append(chapters, &epubChapter{href: "text/chapter001.xhtml"})
+	}
+
+	for _, chapter := range chapters {
+		if chapter.title == "" {
+			chapter.title = b.info.Title
+		}
+	}
+
+	return chapters
+}
+
+func (b *convertedBook) coverHref() string {
+	ext := path.Ext(b.cover.Name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(b.cover.ContentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	return "images/cover" + ext
+}
+
+// epubPackage writes a package document listing the files of the book and
+// fills its metadata in the way the metadata of an EPUB is rewritten.
+func (b *convertedBook) epubPackage(chapters []*epubChapter) ([]byte, error) {
+	var manifest, spine strings.Builder
+	item := func(id, href, mediaType, properties string) {
+		manifest.WriteString("\n    " + xmlTag("item", "", "id", id, "href", href, "media-type", mediaType, "properties", properties))
+	}
+
+	item("nav", "nav.xhtml", "application/xhtml+xml", "nav")
+	item("style", "style.css", "text/css", "")
+	for i, chapter := range chapters {
+		id := fmt.Sprintf("chapter%d", i+1)
+		item(id, chapter.href, "application/xhtml+xml", "")
+		spine.WriteString("\n    " + xmlTag("itemref", "", "idref", id))
+	}
+
+	if len(b.notes) > 0 {
+		item("notes", "text/notes.xhtml", "application/xhtml+xml", "")
+		spine.WriteString("\n    " + xmlTag("itemref", "", "idref", "notes", "linear", "no"))
+	}
+
+	for _, src := range b.srcs {
+		item(b.names[src], "images/"+b.names[src], b.images[src].ContentType, "")
+	}
+
+	language := ""
+	if b.info.Language == "" {
+		language = "\n    <dc:language>und</dc:language>"
+	}
+
+	doc := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="` + dcNamespace + `">
+    <dc:identifier id="uid">urn:uuid:` + b.uuid + `</dc:identifier>` + language + `
+    <meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+  </metadata>
+  <manifest>` + manifest.String() + `
+  </manifest>
+  <spine>` + spine.String() + `
+  </spine>
+</package>
+`)
+
+	var pkg model.Package
+	if err := xml.Unmarshal(doc, &pkg); err != nil {
+		return nil, err
+	}
+
+	var cover *model.Item
+	if b.cover != nil {
+		cover = &model.Item{Href: b.coverHref(), MediaType: b.cover.ContentType}
+	}
+
+	return (&EpubReaderAdapter{}).writeOpf(doc, &pkg, b.info, cover)
+}
+
+func (b *convertedBook) epubNav(chapters []*epubChapter) []byte {
+	var nav strings.Builder
+	nav.WriteString(`<nav epub:type="toc" id="toc">` + "\n" + xmlTag("h1", b.info.Title) + "\n<ol>")
+	for _, chapter := range chapters {
+		nav.WriteString("\n" + xmlMarkup("li", xmlTag("a", chapter.title, "href", chapter.href)))
+	}
+	nav.WriteString("\n</ol>\n</nav>")
+
+	return b.xhtml(b.info.Title, "style.css", nav.String())
+}
+
+// xhtml wraps the body in a document of the book, which is where the
+// language of the text is told. style is the href of the stylesheet from
+// the document.
+func (b *convertedBook) xhtml(title, style, body string) []byte {
+	var lang string
+	if b.info.Language != "" {
+		lang = ` lang="` + escapeXml(b.info.Language) + `" xml:lang="` + escapeXml(b.info.Language) + `"`
+	}
+
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"` + lang + `>
+<head>
+<title>` + escapeXml(title) + `</title>
+<link rel="stylesheet" type="text/css" href="` + style + `"/>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`)
+}
+
+// xhtmlWriter renders blocks as XHTML. Images and notes are linked by the
+// names the converted book gives them.
+type xhtmlWriter struct {
+	sb     strings.Builder
+	images map[string]string
+	notes  map[string]string
+}
+
+func (x *xhtmlWriter) blocks(blocks []*model.Block) {
+	for _, b := range blocks {
+		x.sb.WriteString("\n")
+		switch b.Type {
+		case model.BlockHeading:
+			tag := fmt.Sprintf("h%d", min(max(b.Level, 1), 6))
+			x.sb.WriteString("<" + tag + ">" + x.inlines(b.Inlines) + "</" + tag + ">")
+		case model.BlockVerse:
+			x.sb.WriteString(`<p class="verse">` + x.inlines(b.Inlines) + "</p>")
+		case model.BlockAttribution:
+			x.sb.WriteString(`<p class="attribution">` + x.inlines(b.Inlines) + "</p>")
+		case model.BlockPoem, model.BlockStanza, model.BlockEpigraph:
+			x.sb.WriteString(`<div class="` + b.Type + `">`)
+			x.blocks(b.Children)
+			x.sb.WriteString("</div>")
+		case model.BlockQuote:
+			x.sb.WriteString("<blockquote>")
+			x.blocks(b.Children)
+			x.sb.WriteString("</blockquote>")
+		case model.BlockList:
+			tag := "ul"
+			if b.Ordered {
+				tag = "ol"
+			}
+			x.sb.WriteString("<" + tag + ">")
+			for _, item := range b.Children {
+				x.sb.WriteString("\n<li>")
+				if len(item.Children) > 0 {
+					x.blocks(item.Children)
+				} else {
+					x.sb.WriteString(x.inlines(item.Inlines))
+				}
+				x.sb.WriteString("</li>")
+			}
+			x.sb.WriteString("</" + tag + ">")
+		case model.BlockImage:
+			if name, ok := x.images[b.Src]; ok {
+				x.sb.WriteString(`<div class="image"><img src="../images/` + escapeXml(name) + `" alt=""/></div>`)
+			}
+		default:
+			x.sb.WriteString("<p>" + x.inlines(b.Inlines) + "</p>")
+		}
+	}
+}
+
+func (x *xhtmlWriter) inlines(inlines []model.Inline) string {
+	var sb strings.Builder
+	for _, in := range inlines {
+		text := strings.ReplaceAll(escapeXml(in.Text), "\n", "<br/>")
+		if in.Emphasis {
+			text = "<em>" + text + "</em>"
+		}
+		if in.Strong {
+			text = "<strong>" + text + "</strong>"
+		}
+
+		if id, ok := x.notes[in.Href]; ok && in.Note {
+			text = `<a epub:type="noteref" href="notes.xhtml#` + id + `">` + text + "</a>"
+		} else if in.Href != "" && isExternalLink(in.Href) {
+			text = `<a href="` + escapeXml(in.Href) + `">` + text + "</a>"
+		}
+		sb.WriteString(text)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,410 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	opfNamespace = "http://www.idpf.org/2007/opf"
+)
+
+var xmlIdPattern = regexp.MustCompile(`\sid\s*=\s*["']([^"']+)["']`)
+
+// WriteMetadata writes a copy of the EPUB with the metadata of its package
+// replaced by info. The other entries are copied without being decompressed,
+// so the mimetype stays the first entry and stored.
+func (t *EpubReaderAdapter) WriteMetadata(bookPath string, w io.Writer, info *model.BookInfo, cover *model.Image) error {
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	opfPath, err := t.getOpfPath(r)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := t.getPackage(r, opfPath)
+	if err != nil {
+		return err
+	}
+
+	opf := t.findFile(r, opfPath, opfPath)
+	data, err := t.readFile(opf)
+	if err != nil {
+		return err
+	}
+
+	var coverItem *model.Item
+	if cover != nil && t.coverItem(pkg) == nil {
+		coverItem = t.newCoverItem(r, opfPath, cover)
+	}
+
+	doc, err := t.writeOpf(utf8Xml(data), pkg, info, coverItem)
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range r.File {
+		if f != opf {
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: f.Modified})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(doc); err != nil {
+			return err
+		}
+	}
+
+	if coverItem != nil {
+		fw, err := zw.Create(resolveHref(path.Dir(opfPath), coverItem.Href))
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(cover.Data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// newCoverItem names the cover added to a book that has none after its
+// content type, next to the package document.
+func (t *EpubReaderAdapter) newCoverItem(r *zip.ReadCloser, opfPath string, cover *model.Image) *model.Item {
+	ext := path.Ext(cover.Name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(cover.ContentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	names := map[string]bool{}
+	for _, f := range r.File {
+		names[f.Name] = true
+	}
+
+	href := "cover" + ext
+	for i := 1; names[resolveHref(path.Dir(opfPath), href)]; i++ {
+		href = fmt.Sprintf("cover-%d%s", i, ext)
+	}
+
+	return &model.Item{Href: href, MediaType: cover.ContentType}
+}
+
+// opfEntry is an element of the metadata along with what it says, by which
+// an element of the book that says the same is kept instead.
+type opfEntry struct {
+	key    string
+	markup string
+}
+
+// writeOpf replaces the metadata of the package document with info. The
+// elements that say what info does are kept as they are, with the meta
+// elements refining them, and the rest of what the reader takes from the
+// metadata is written anew after the elements it does not read.
+func (t *EpubReaderAdapter) writeOpf(doc []byte, pkg *model.Package, info *model.BookInfo, cover *model.Item) ([]byte, error) {
+	metadata, err := findXmlElement(doc, "package", "metadata")
+	if err != nil {
+		return nil, err
+	}
+
+	var decl string
+	dc := xmlPrefix(doc[:metadata.open], dcNamespace)
+	if dc == "" {
+		dc, decl = "dc", ` xmlns:dc="`+dcNamespace+`"`
+	}
+
+	epub3 := strings.HasPrefix(strings.TrimSpace(pkg.Version), "3")
+	opf := xmlPrefix(doc[:metadata.open], opfNamespace)
+	if opf == "" && !epub3 {
+		opf, decl = "opf", decl+` xmlns:opf="`+opfNamespace+`"`
+	}
+
+	meta := "meta"
+	if prefix, _, ok := strings.Cut(metadata.rawName(doc), ":"); ok {
+		meta = prefix + ":meta"
+	}
+
+	ids := map[string]bool{}
+	for _, m := range xmlIdPattern.FindAllSubmatch(doc, -1) {
+		ids[string(m[1])] = true
+	}
+	newId := func(prefix string) string {
+		for i := 1; ; i++ {
+			if id := prefix + strconv.Itoa(i); !ids[id] {
+				ids[id] = true
+				return id
+			}
+		}
+	}
+
+	refines := map[string]map[string]string{}
+	for _, m := range pkg.Metadata.Metas {
+		if m.Refines != "" {
+			id := strings.TrimPrefix(m.Refines, "#")
+			if refines[id] == nil {
+				refines[id] = map[string]string{}
+			}
+			refines[id][m.Property] = strings.TrimSpace(m.Value)
+		}
+	}
+
+	var uniqueId string
+	for _, id := range pkg.Metadata.Identifiers {
+		if id.ID != "" && id.ID == pkg.UniqueIdentifier {
+			if list := addIdentifier(nil, id.Scheme, id.Value); len(list) > 0 {
+				uniqueId = list[0].Scheme + ":" + list[0].Value
+			}
+		}
+	}
+
+	// the elements of the book by what they say; those not read are kept
+	kept := map[string][]*xmlElement{}
+	var others []*xmlElement
+	for _, e := range metadata.children {
+		if key := t.entryKey(e, pkg, refines, info); key != "" {
+			kept[key] = append(kept[key], e)
+		} else {
+			others = append(others, e)
+		}
+	}
+
+	var entries []opfEntry
+	add := func(key, markup string) {
+		entries = append(entries, opfEntry{key: key, markup: markup})
+	}
+
+	if info.Title != "" {
+		add("title:"+info.Title, xmlTag(dc+":title", info.Title))
+	}
+
+	contributors := info.Authors
+	for _, name := range info.Translators {
+		contributors = append(contributors, model.Contributor{Name: name, Role: "translator"})
+	}
+	for _, c := range contributors {
+		name := dc + ":contributor"
+		if c.Role == roleAuthor {
+			name = dc + ":creator"
+		}
+
+		key := "creator:" + c.Role + ":" + c.Name
+		if !epub3 {
+			add(key, xmlTag(name, c.Name, opf+":role", relatorCode(c.Role)))
+			continue
+		}
+
+		if len(kept[key]) > 0 {
+			add(key, "")
+			continue
+		}
+		id := newId("creator")
+		add(key, xmlTag(name, c.Name, "id", id))
+		add("", xmlTag(meta, relatorCode(c.Role), "refines", "#"+id, "property", "role", "scheme", "marc:relators"))
+	}
+
+	if info.Annotation != "" {
+		add("description:"+info.Annotation, xmlTag(dc+":description", info.Annotation))
+	}
+
+	for _, genre := range info.Genres {
+		add("subject:"+genre, xmlTag(dc+":subject", genre))
+	}
+
+	if info.Language != "" {
+		add("language:"+info.Language, xmlTag(dc+":language", info.Language))
+	}
+
+	if info.Publisher != "" {
+		add("publisher:"+info.Publisher, xmlTag(dc+":publisher", info.Publisher))
+	}
+
+	if info.PublishDate != "" {
+		add("date:"+info.PublishDate, xmlTag(dc+":date", info.PublishDate))
+	}
+
+	for _, id := range info.Identifiers {
+		key := id.Scheme + ":" + id.Value
+		if key == uniqueId {
+			continue
+		}
+
+		if epub3 {
+			add("identifier:"+key, xmlTag(dc+":identifier", "urn:"+strings.ToLower(id.Scheme)+":"+id.Value))
+		} else {
+			add("identifier:"+key, xmlTag(dc+":identifier", id.Value, opf+":scheme", id.Scheme))
+		}
+	}
+
+	if info.Series != "" {
+		index := ""
+		if info.SeriesIndex > 0 {
+			index = strconv.FormatFloat(info.SeriesIndex, 'f', -1, 64)
+		}
+
+		if epub3 {
+			id := newId("collection")
+			add("", xmlTag(meta, info.Series, "property", "belongs-to-collection", "id", id))
+			add("", xmlTag(meta, "series", "refines", "#"+id, "property", "collection-type"))
+			if index != "" {
+				add("", xmlTag(meta, index, "refines", "#"+id, "property", "group-position"))
+			}
+		} else {
+			add("", xmlTag(meta, "", "name", "calibre:series", "content", info.Series))
+			if index != "" {
+				add("", xmlTag(meta, "", "name", "calibre:series_index", "content", index))
+			}
+		}
+	}
+
+	if cover != nil {
+		cover.ID = newId("cover-image")
+		add("", xmlTag(meta, "", "name", "cover", "content", cover.ID))
+	}
+
+	var elements []string
+	for _, entry := range entries {
+		if entry.key == "" || len(kept[entry.key]) == 0 {
+			if entry.markup != "" {
+				elements = append(elements, entry.markup)
+			}
+			continue
+		}
+
+		elements = append(elements, kept[entry.key][0].markup(doc))
+		kept[entry.key] = kept[entry.key][1:]
+	}
+
+	// what is left of the elements the book had is dropped, and so are the
+	// meta elements refining them
+	dropped := map[string]bool{}
+	for _, list := range kept {
+		for _, e := range list {
+			if id := e.attr("id"); id != "" {
+				dropped[id] = true
+			}
+		}
+	}
+
+	var content []string
+	for _, e := range others {
+		if refined := strings.TrimPrefix(e.attr("refines"), "#"); refined == "" || !dropped[refined] {
+			content = append(content, e.markup(doc))
+		}
+	}
+	doc = replaceContent(doc, metadata, append(content, elements...), decl)
+
+	if cover == nil {
+		return doc, nil
+	}
+
+	manifest, err := findXmlElement(doc, "package", "manifest")
+	if err != nil {
+		return nil, err
+	}
+
+	item := "item"
+	if prefix, _, ok := strings.Cut(manifest.rawName(doc), ":"); ok {
+		item = prefix + ":item"
+	}
+
+	properties := ""
+	if epub3 {
+		properties = "cover-image"
+	}
+
+	content = nil
+	for _, e := range manifest.children {
+		content = append(content, e.markup(doc))
+	}
+	content = append(content, xmlTag(item, "", "id", cover.ID, "href", cover.Href, "media-type", cover.MediaType, "properties", properties))
+
+	return replaceContent(doc, manifest, content, ""), nil
+}
+
+// entryKey tells what an element of the metadata says in the terms of the
+// entries written for info, or returns an empty string for the elements the
+// reader does not take metadata from, which are kept. Elements info has no
+// value for in place of are kept too, as the language a book must have.
+func (t *EpubReaderAdapter) entryKey(e *xmlElement, pkg *model.Package, refines map[string]map[string]string, info *model.BookInfo) string {
+	text := strings.Join(strings.Fields(e.text), " ")
+
+	if e.Name.Local == "meta" {
+		switch {
+		case e.attr("name") == "calibre:series", e.attr("name") == "calibre:series_index":
+			return "series"
+		case e.attr("property") == "belongs-to-collection":
+			if kind := refines[e.attr("id")]["collection-type"]; kind == "" || kind == "series" {
+				return "series"
+			}
+		}
+		return ""
+	}
+
+	if e.Name.Space != dcNamespace && e.Name.Space != "dc" {
+		return ""
+	}
+
+	switch e.Name.Local {
+	case "title":
+		if info.Title != "" {
+			return "title:" + text
+		}
+	case "creator", "contributor":
+		role := e.attr("role")
+		if role == "" && e.attr("id") != "" {
+			role = refines[e.attr("id")]["role"]
+		}
+		if role == "" && e.Name.Local == "contributor" {
+			return ""
+		}
+		return "creator:" + contributorRole(role) + ":" + text
+	case "description":
+		description := strings.TrimSpace(e.text)
+		if strings.Contains(description, "<") {
+			if text, err := textFromHtml(strings.NewReader(description)); err == nil {
+				description = strings.TrimSpace(text)
+			}
+		}
+		return "description:" + description
+	case "subject":
+		return "subject:" + text
+	case "language":
+		if info.Language != "" {
+			return "language:" + text
+		}
+	case "publisher":
+		return "publisher:" + text
+	case "date":
+		if event := strings.ToLower(e.attr("event")); event == "" || event == "publication" {
+			return "date:" + text
+		}
+	case "identifier":
+		if id := e.attr("id"); id != "" && id == pkg.UniqueIdentifier {
+			return ""
+		}
+		if list := addIdentifier(nil, e.attr("scheme"), e.text); len(list) > 0 {
+			return "identifier:" + list[0].Scheme + ":" + list[0].Value
+		}
+	}
+
+	return ""
+}
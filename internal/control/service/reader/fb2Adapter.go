@@ -2,62 +2,288 @@ package reader
 
 import (
 	"BookStore/internal/control/model"
+	"bufio"
+	"bytes"
+	"encoding/base64"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 )
 
 type Fb2ReaderAdapter struct{}
 
 func (t *Fb2ReaderAdapter) Parse(path string) (string, error) {
-	var content strings.Builder
-	var inTitle, inParagraph, inSubtitle, inBody bool
+	var sb strings.Builder
+	if _, err := t.stream(path, newTextSink(&sb, nil)); err != nil {
+		return "", err
+	}
 
-	data, err := os.ReadFile(path)
+	return sb.String(), nil
+}
+
+func (t *Fb2ReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	ingestion, err := t.stream(path, newTextSink(io.Discard, nil))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return ingestion.Chapters, nil
+}
+
+func (t *Fb2ReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	ingestion, err := t.stream(path, newTextSink(io.Discard, nil))
+	if err != nil {
+		return 0, err
 	}
 
-	dec := xml.NewDecoder(strings.NewReader(string(data)))
+	return ingestion.ChaptersCount, nil
+}
+
+// GetBookInfo reads the description, which comes first, and does not look
+// at the rest of the file.
+func (t *Fb2ReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var description model.Fb2Description
+	var depth int
+	dec := newXmlDecoder(bufio.NewReader(f))
 	for {
 		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch elem := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 && elem.Name.Local == "description" {
+				if err := dec.DecodeElement(&description, &elem); err != nil {
+					return nil, err
+				}
+				return fb2BookInfo(&description), nil
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return fb2BookInfo(&description), nil
+}
+
+// fb2BookInfo reads the metadata from the description. The series and the
+// publication year of the printed edition in publish-info are taken over
+// those of the text in title-info.
+func fb2BookInfo(description *model.Fb2Description) *model.BookInfo {
+	info := description.TitleInfo
+	publish := description.PublishInfo
+
+	bookInfo := &model.BookInfo{
+		Title:     strings.TrimSpace(info.BookTitle),
+		Genres:    addUnique(nil, info.Genres...),
+		Language:  strings.TrimSpace(info.Lang),
+		Publisher: strings.TrimSpace(publish.Publisher),
+	}
+
+	var authors []model.Contributor
+	for _, author := range info.Authors {
+		authors = append(authors, model.Contributor{Name: fb2Name(author), Role: roleAuthor})
+	}
+	setAuthors(bookInfo, authors)
+
+	for _, translator := range info.Translators {
+		bookInfo.Translators = addUnique(bookInfo.Translators, fb2Name(translator))
+	}
+
+	if content := strings.TrimSpace(info.Annotation.Content); content != "" {
+		annotation, err := textFromHtml(strings.NewReader(content))
 		if err != nil {
+			annotation = content
+		}
+		bookInfo.Annotation = strings.TrimSpace(annotation)
+	}
+
+	for _, sequence := range slices.Concat(publish.Sequences, info.Sequences) {
+		if name := strings.TrimSpace(sequence.Name); name != "" {
+			bookInfo.Series = name
+			bookInfo.SeriesIndex = seriesIndex(sequence.Number)
+			break
+		}
+	}
+
+	bookInfo.PublishDate = strings.TrimSpace(publish.Year)
+	if bookInfo.PublishDate == "" {
+		bookInfo.PublishDate = strings.TrimSpace(info.Date.Value)
+	}
+	if bookInfo.PublishDate == "" {
+		bookInfo.PublishDate = strings.TrimSpace(info.Date.Text)
+	}
+
+	bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "ISBN", publish.Isbn)
+	if id := strings.TrimSpace(description.DocumentInfo.ID); id != "" {
+		// the id of the document is a UUID when made by most editors
+		if isUuid(id) {
+			bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "UUID", id)
+		} else {
+			bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "FB2", id)
+		}
+	}
+
+	return bookInfo
+}
+
+// fb2Name joins the parts of a name, the nickname stands for a name that is
+// not given.
+func fb2Name(author model.Fb2Author) string {
+	name := strings.Join(strings.Fields(author.FirstName+" "+author.MiddleName+" "+author.LastName), " ")
+	if name == "" {
+		name = strings.TrimSpace(author.Nickname)
+	}
+
+	return name
+}
+
+// stream reads the book in one pass. The text of the main body goes to the
+// sink, a section title starts a chapter unless it is empty, and the top
+// level sections of the main body are counted as chapters. Binaries, which
+// make up most of a book with images, are skipped without being decoded.
+func (t *Fb2ReaderAdapter) stream(path string, sink *textSink) (*Ingestion, error) {
+	var title strings.Builder
+	var inTitle, inParagraph, inSubtitle, inBody, inNotes bool
+	var depth, level int
+	var chapter *model.Chapter
+	var chapters []*model.Chapter
+	var description model.Fb2Description
+	var count uint
+	var inMain, closed bool
+	var subsection int
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sink.trim = true
+	dec := newXmlDecoder(bufio.NewReader(f))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// whatever follows the root element is ignored
+			if err != io.EOF && !closed {
+				return nil, fmt.Errorf("failed to parse fb2: %v", err)
+			}
 			break
 		}
 
 		switch elem := tok.(type) {
 		case xml.StartElement:
+			switch {
+			case level == 1 && elem.Name.Local == "description":
+				if err := dec.DecodeElement(&description, &elem); err != nil {
+					return nil, fmt.Errorf("failed to parse fb2 description: %v", err)
+				}
+				continue
+			case elem.Name.Local == "binary":
+				if err := dec.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to parse fb2: %v", err)
+				}
+				continue
+			}
+			level++
+
 			switch elem.Name.Local {
 			case "body":
 				inBody = true
+				inNotes = false
+				inTitle, inParagraph, inSubtitle = false, false, false
+				depth = 0
+				for _, attr := range elem.Attr {
+					if attr.Name.Local == "name" && attr.Value != "" {
+						inNotes = true
+					}
+				}
+				inMain = !inNotes
+			case "section":
+				depth++
+				if inMain {
+					if subsection == 0 {
+						count++
+					}
+					subsection++
+				}
 			case "title":
 				inTitle = true
+				if depth > 0 && !inNotes {
+					chapter = &model.Chapter{Level: depth}
+					title.Reset()
+					sink.hold()
+				}
 			case "p":
 				inParagraph = true
 			case "subtitle":
 				inSubtitle = true
 			}
 		case xml.EndElement:
+			level--
+			closed = level == 0
+
 			switch elem.Name.Local {
+			case "body":
+				inMain = false
+			case "section":
+				if inMain && subsection != 0 {
+					subsection--
+				}
+			}
+
+			if inNotes {
+				continue
+			}
+
+			switch elem.Name.Local {
+			case "section":
+				if depth > 0 {
+					depth--
+				}
 			case "title":
 				inTitle = false
-				content.WriteString("\n")
+				sink.WriteString("\n")
+				if chapter != nil {
+					chapter.Title = strings.Join(strings.Fields(title.String()), " ")
+					if chapter.Title != "" {
+						sink.release(chapter)
+						chapters = append(chapters, chapter)
+					}
+					sink.release(nil)
+					chapter = nil
+				}
 			case "p":
 				inParagraph = false
-				content.WriteString("\n\n")
+				sink.WriteString("\n\n")
 			case "subtitle":
 				inSubtitle = false
-				content.WriteString("* * *\n\n")
+				sink.WriteString("* * *\n\n")
 			}
 		case xml.CharData:
-			if inBody {
+			if inBody && !inNotes {
 				text := strings.TrimSpace(string(elem))
 				if text != "" {
 					switch {
 					case inTitle:
-						content.WriteString(text + "\n")
+						sink.WriteString(text + "\n")
+						title.WriteString(text + " ")
 					case inParagraph:
-						content.WriteString(text + " ")
+						sink.WriteString(text + " ")
 					case inSubtitle:
 					}
 				}
@@ -65,72 +291,323 @@ func (t *Fb2ReaderAdapter) Parse(path string) (string, error) {
 		}
 	}
 
-	return strings.TrimSpace(content.String()), nil
+	return &Ingestion{
+		Info:          fb2BookInfo(&description),
+		ChaptersCount: count,
+		Chapters:      chapters,
+	}, nil
 }
 
-func (t *Fb2ReaderAdapter) GetChaptersCount(path string) (uint, error) {
-	var count uint
-	var inBody bool
-	var subsection int
+func (t *Fb2ReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	blocks, _, err := t.readBlocks(path)
+	if err != nil {
+		return nil, err
+	}
 
+	return blocks, nil
+}
+
+func (t *Fb2ReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	_, notes, err := t.readBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// readBlocks converts the main body into blocks. Bodies with a name, such as
+// <body name="notes">, hold notes; each of their sections is a note with the
+// section id as its ref.
+func (t *Fb2ReaderAdapter) readBlocks(path string) ([]*model.Block, []*model.Note, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
 
-	dec := xml.NewDecoder(strings.NewReader(string(data)))
+	root, err := readXmlTree(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []*model.Block
+	var notes []*model.Note
+	for _, body := range root.elements("body") {
+		if body.attr("name") == "" {
+			var b fb2BlockBuilder
+			blocks = append(blocks, b.blocks(body, 0, model.BlockParagraph)...)
+			continue
+		}
+
+		t.readNotes(body, &notes)
+	}
+
+	linkNotes(blocks, notes, func(href string) string {
+		return strings.TrimPrefix(href, "#")
+	})
+
+	return blocks, notes, nil
+}
+
+func (t *Fb2ReaderAdapter) readNotes(n *xmlNode, notes *[]*model.Note) {
+	b := fb2BlockBuilder{notes: true}
+	for _, section := range n.elements("section") {
+		id := section.attr("id")
+		if id == "" {
+			t.readNotes(section, notes)
+			continue
+		}
+
+		var title string
+		for _, c := range section.elements("title") {
+			if inlines := b.inlines(c); inlines != nil {
+				title = strings.Join(strings.Fields(inlinesText(inlines)), " ")
+			}
+		}
+
+		blocks := b.blocks(section, 0, model.BlockParagraph)
+		*notes = append(*notes, &model.Note{
+			Ref:    id,
+			Title:  title,
+			Text:   BlocksText(blocks),
+			Blocks: blocks,
+		})
+	}
+}
+
+func (t *Fb2ReaderAdapter) GetCover(path string) (*model.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := readXmlTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, description := range root.elements("description") {
+		for _, info := range description.elements("title-info") {
+			for _, coverpage := range info.elements("coverpage") {
+				for _, image := range coverpage.elements("image") {
+					if href := strings.TrimPrefix(image.attr("href"), "#"); href != "" {
+						return t.binary(root, href)
+					}
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// GetImage returns the <binary> with the given id.
+func (t *Fb2ReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := readXmlTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.binary(root, strings.TrimPrefix(name, "#"))
+}
+
+func (t *Fb2ReaderAdapter) binary(root *xmlNode, id string) (*model.Image, error) {
+	for _, bin := range root.elements("binary") {
+		if bin.attr("id") != id {
+			continue
+		}
+
+		var encoded strings.Builder
+		for _, c := range bin.children {
+			encoded.WriteString(strings.Join(strings.Fields(c.text), ""))
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %v", err)
+		}
+
+		return newImage(id, data)
+	}
+
+	return nil, errImageNotFound
+}
+
+// xmlNode is a minimal element tree; text nodes have an empty name.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+func readXmlTree(data []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+
+	dec := newXmlDecoder(bytes.NewReader(data))
 	for {
 		tok, err := dec.Token()
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return nil, err
+		}
+
+		top := stack[len(stack)-1]
 		switch elem := tok.(type) {
 		case xml.StartElement:
-			if elem.Name.Local == "body" {
-				inBody = true
-			}
-			if inBody && elem.Name.Local == "section" {
-				if subsection == 0 {
-					count++
-				}
-				subsection++
-			}
+			node := &xmlNode{name: elem.Name.Local, attrs: elem.Attr}
+			top.children = append(top.children, node)
+			stack = append(stack, node)
 		case xml.EndElement:
-			if elem.Name.Local == "body" {
-				inBody = false
-			}
-			if inBody && elem.Name.Local == "section" {
-				if subsection != 0 {
-					subsection--
-				}
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
 			}
+		case xml.CharData:
+			top.children = append(top.children, &xmlNode{text: string(elem)})
+		}
+	}
+
+	if len(root.children) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+
+	for _, c := range root.children {
+		if c.name != "" {
+			return c, nil
 		}
 	}
 
-	return count, nil
+	return root, nil
 }
 
-func (t *Fb2ReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+func (n *xmlNode) attr(name string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	return ""
+}
+
+func (n *xmlNode) elements(name string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.children {
+		if c.name == name {
+			out = append(out, c)
+		}
 	}
 
-	var fb2 model.Fb2Root
-	if err := xml.Unmarshal(data, &fb2); err != nil {
-		return nil, err
+	return out
+}
+
+type fb2BlockBuilder struct {
+	ib    inlineBuilder
+	notes bool
+}
+
+func (b *fb2BlockBuilder) blocks(n *xmlNode, depth int, leaf string) []*model.Block {
+	var out []*model.Block
+	container := func(kind string, c *xmlNode, leaf string) {
+		if children := b.blocks(c, depth, leaf); len(children) > 0 {
+			out = append(out, &model.Block{Type: kind, ID: c.attr("id"), Children: children})
+		}
+	}
+	text := func(kind string, level int, c *xmlNode) {
+		if inlines := b.inlines(c); inlines != nil {
+			out = append(out, &model.Block{Type: kind, Level: level, Inlines: inlines})
+		}
 	}
 
-	info := fb2.Description.TitleInfo
+	for _, c := range n.children {
+		switch c.name {
+		case "section":
+			out = append(out, b.blocks(c, depth+1, leaf)...)
+		case "title":
+			// the title of a note is returned apart from its text
+			if !b.notes {
+				text(model.BlockHeading, max(depth, 1), c)
+			}
+		case "subtitle":
+			text(model.BlockHeading, depth+1, c)
+		case "p", "v":
+			kind := leaf
+			if c.name == "v" {
+				kind = model.BlockVerse
+			}
+			text(kind, 0, c)
+		case "text-author":
+			text(model.BlockAttribution, 0, c)
+		case "poem":
+			container(model.BlockPoem, c, model.BlockVerse)
+		case "stanza":
+			container(model.BlockStanza, c, model.BlockVerse)
+		case "epigraph":
+			container(model.BlockEpigraph, c, model.BlockParagraph)
+		case "cite":
+			container(model.BlockQuote, c, model.BlockParagraph)
+		case "image":
+			if href := c.attr("href"); href != "" {
+				out = append(out, &model.Block{Type: model.BlockImage, Src: strings.TrimPrefix(href, "#")})
+			}
+		case "table":
+			for _, tr := range c.elements("tr") {
+				for _, cell := range tr.children {
+					b.inline(cell, model.Inline{})
+					b.ib.add(" ", model.Inline{})
+				}
+				if inlines := b.ib.finish(); inlines != nil {
+					out = append(out, &model.Block{Type: model.BlockParagraph, Inlines: inlines})
+				}
+			}
+		case "annotation":
+			out = append(out, b.blocks(c, depth, leaf)...)
+		}
+	}
 
-	bookInfo := &model.BookInfo{
-		Title:      info.BookTitle,
-		Author:     info.Author.FirstName + " " + info.Author.LastName,
-		Annotation: info.Annotation.Paragraph,
+	return out
+}
+
+// inlines collects the text of an element; the paragraphs of a multi-line
+// title are joined with line breaks.
+func (b *fb2BlockBuilder) inlines(n *xmlNode) []model.Inline {
+	for i, c := range n.children {
+		if c.name == "p" && i > 0 && len(b.ib.inlines) > 0 {
+			b.ib.lineBreak()
+		}
+		b.inline(c, model.Inline{})
+	}
+
+	return b.ib.finish()
+}
+
+func (b *fb2BlockBuilder) inline(n *xmlNode, style model.Inline) {
+	switch n.name {
+	case "":
+		b.ib.add(n.text, style)
+		return
+	case "emphasis":
+		style.Emphasis = true
+	case "strong":
+		style.Strong = true
+	case "a":
+		style.Href = n.attr("href")
+		style.Note = n.attr("type") == "note"
+	case "image":
+		return
 	}
 
-	return bookInfo, nil
+	for _, c := range n.children {
+		b.inline(c, style)
+	}
 }
 
 //func (t *Fb2ReaderAdapter) GetBookPage(data string, pageNum uint) (string, error) {
@@ -0,0 +1,236 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// writeFb2 writes the book as an FB2. Headings start sections nested by
+// their levels, and the notes go to a body of their own.
+func (b *convertedBook) writeFb2(w io.Writer) error {
+	f := &fb2BodyWriter{images: b.names, notes: b.noteIds()}
+
+	var publish strings.Builder
+	if b.info.Publisher != "" {
+		publish.WriteString(xmlTag("publisher", b.info.Publisher))
+	}
+	if b.info.PublishDate != "" {
+		publish.WriteString(xmlTag("year", b.info.PublishDate))
+	}
+	for _, id := range b.info.Identifiers {
+		if id.Scheme == "ISBN" {
+			publish.WriteString(xmlTag("isbn", id.Value))
+			break
+		}
+	}
+
+	f.sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="` + xlinkNamespace + `">
+<description>
+<title-info></title-info>
+<document-info>` + xmlMarkup("author", xmlTag("nickname", "BookStore")) + xmlTag("program-used", "BookStore") +
+		xmlTag("date", time.Now().Format("2006-01-02"), "value", time.Now().Format("2006-01-02")) +
+		xmlTag("id", b.uuid) + xmlTag("version", "1.0") + `</document-info>`)
+	if publish.Len() > 0 {
+		f.sb.WriteString("\n" + xmlMarkup("publish-info", publish.String()))
+	}
+	f.sb.WriteString("\n</description>\n<body>")
+
+	var levels []int
+	closeSections := func(level int) {
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			f.sb.WriteString("\n</section>")
+			levels = levels[:len(levels)-1]
+		}
+	}
+
+	if len(b.blocks) == 0 {
+		f.sb.WriteString("\n<section><empty-line/></section>")
+	}
+
+	for _, block := range b.blocks {
+		if block.Type == model.BlockHeading {
+			closeSections(block.Level)
+			levels = append(levels, block.Level)
+			f.sb.WriteString("\n<section>\n<title>" + f.paragraphs(block.Inlines) + "</title>")
+			continue
+		}
+
+		// text before the first heading has a section of its own
+		if len(levels) == 0 {
+			levels = append(levels, math.MaxInt)
+			f.sb.WriteString("\n<section>")
+		}
+		f.blocks([]*model.Block{block}, "p")
+	}
+	closeSections(math.MinInt)
+	f.sb.WriteString("\n</body>")
+
+	if len(b.notes) > 0 {
+		f.sb.WriteString("\n" + `<body name="notes">`)
+		for _, n := range b.notes {
+			f.sb.WriteString("\n" + `<section id="` + f.notes[n.Ref] + `">`)
+			if n.Title != "" {
+				f.sb.WriteString(xmlMarkup("title", xmlTag("p", n.Title)))
+			}
+			f.blocks(n.Blocks, "p")
+			f.sb.WriteString("\n</section>")
+		}
+		f.sb.WriteString("\n</body>")
+	}
+
+	for _, src := range b.srcs {
+		image := b.images[src]
+		f.sb.WriteString("\n" + xmlTag("binary", base64.StdEncoding.EncodeToString(image.Data), "id", b.names[src], "content-type", image.ContentType))
+	}
+	f.sb.WriteString("\n</FictionBook>\n")
+
+	doc, err := (&Fb2ReaderAdapter{}).writeDescription([]byte(f.sb.String()), b.info, b.cover)
+	if err != nil {
+		return fmt.Errorf("failed to write description: %v", err)
+	}
+
+	_, err = w.Write(doc)
+	return err
+}
+
+// fb2BodyWriter renders blocks as FB2 markup. Images and notes are linked by
+// the ids the converted book gives them.
+type fb2BodyWriter struct {
+	sb     strings.Builder
+	images map[string]string
+	notes  map[string]string
+}
+
+// blocks writes the blocks with leaf as the element of plain text, which is
+// a verse in poems.
+func (f *fb2BodyWriter) blocks(blocks []*model.Block, leaf string) {
+	for _, b := range blocks {
+		f.sb.WriteString("\n")
+		switch b.Type {
+		case model.BlockHeading:
+			f.sb.WriteString(xmlMarkup("subtitle", f.inlines(b.Inlines)))
+		case model.BlockVerse:
+			f.sb.WriteString(xmlMarkup("v", f.inlines(b.Inlines)))
+		case model.BlockAttribution:
+			f.sb.WriteString(xmlMarkup("text-author", f.inlines(b.Inlines)))
+		case model.BlockPoem:
+			f.sb.WriteString("<poem>")
+			f.poem(b.Children)
+			f.sb.WriteString("\n</poem>")
+		case model.BlockStanza:
+			f.sb.WriteString("<poem>")
+			f.poem([]*model.Block{b})
+			f.sb.WriteString("\n</poem>")
+		case model.BlockEpigraph:
+			f.sb.WriteString("<epigraph>")
+			f.blocks(b.Children, "p")
+			f.sb.WriteString("\n</epigraph>")
+		case model.BlockQuote:
+			f.sb.WriteString("<cite>")
+			f.blocks(b.Children, "p")
+			f.sb.WriteString("\n</cite>")
+		case model.BlockList:
+			// FB2 has no lists, the items become paragraphs with a mark
+			for i, item := range b.Children {
+				mark := "• "
+				if b.Ordered {
+					mark = fmt.Sprintf("%d. ", i+1)
+				}
+				if len(item.Children) > 0 {
+					f.blocks(item.Children, leaf)
+				} else {
+					f.sb.WriteString(xmlMarkup("p", escapeXml(mark)+f.inlines(item.Inlines)))
+				}
+			}
+		case model.BlockImage:
+			if id, ok := f.images[b.Src]; ok {
+				f.sb.WriteString(`<image l:href="#` + escapeXml(id) + `"/>`)
+			}
+		default:
+			f.sb.WriteString(xmlMarkup(leaf, f.inlines(b.Inlines)))
+		}
+	}
+}
+
+// poem writes the children of a poem, whose verses must be in stanzas.
+func (f *fb2BodyWriter) poem(children []*model.Block) {
+	var verses []*model.Block
+	flush := func() {
+		if len(verses) > 0 {
+			f.sb.WriteString("\n<stanza>")
+			f.blocks(verses, "v")
+			f.sb.WriteString("\n</stanza>")
+			verses = nil
+		}
+	}
+
+	for _, c := range children {
+		switch c.Type {
+		case model.BlockStanza:
+			flush()
+			f.sb.WriteString("\n<stanza>")
+			f.blocks(c.Children, "v")
+			f.sb.WriteString("\n</stanza>")
+		case model.BlockAttribution, model.BlockHeading:
+			flush()
+			f.blocks([]*model.Block{c}, "v")
+		default:
+			c := *c
+			c.Type = model.BlockVerse
+			verses = append(verses, &c)
+		}
+	}
+	flush()
+}
+
+// paragraphs writes the lines of a title as paragraphs.
+func (f *fb2BodyWriter) paragraphs(inlines []model.Inline) string {
+	var out strings.Builder
+	for _, line := range strings.Split(f.inlines(inlines), "\n") {
+		if strings.TrimSpace(line) != "" {
+			out.WriteString(xmlMarkup("p", line))
+		}
+	}
+
+	return out.String()
+}
+
+// inlines writes the inlines, keeping the line breaks in the text. FB2 has
+// no line breaks, so outside of titles they are left to the reader as
+// white space.
+func (f *fb2BodyWriter) inlines(inlines []model.Inline) string {
+	var sb strings.Builder
+	for _, in := range inlines {
+		var text strings.Builder
+		for i, line := range strings.Split(in.Text, "\n") {
+			if i > 0 {
+				text.WriteString("\n")
+			}
+			if line = escapeXml(line); line != "" {
+				if in.Emphasis {
+					line = "<emphasis>" + line + "</emphasis>"
+				}
+				if in.Strong {
+					line = "<strong>" + line + "</strong>"
+				}
+			}
+			text.WriteString(line)
+		}
+
+		if id, ok := f.notes[in.Href]; ok && in.Note {
+			sb.WriteString(`<a l:href="#` + id + `" type="note">` + text.String() + "</a>")
+		} else if in.Href != "" && isExternalLink(in.Href) {
+			sb.WriteString(`<a l:href="` + escapeXml(in.Href) + `">` + text.String() + "</a>")
+		} else {
+			sb.WriteString(text.String())
+		}
+	}
+
+	return sb.String()
+}
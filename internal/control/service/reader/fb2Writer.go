@@ -0,0 +1,292 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const xlinkNamespace = "http://www.w3.org/1999/xlink"
+
+// fb2TitleInfo is the order the schema gives the elements of title-info in.
+var fb2TitleInfo = []string{
+	"genre", "author", "book-title", "annotation", "keywords", "date",
+	"coverpage", "lang", "src-lang", "translator", "sequence",
+}
+
+// WriteMetadata writes a copy of the FB2 with its title-info made from info,
+// and the series of publish-info too, which the reader takes over the one
+// in title-info. The copy is written in UTF-8 whatever the book was in.
+func (t *Fb2ReaderAdapter) WriteMetadata(path string, w io.Writer, info *model.BookInfo, cover *model.Image) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	doc, err := t.writeDescription(utf8Xml(data), info, cover)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(doc)
+	return err
+}
+
+// writeDescription returns the UTF-8 document with the metadata of info.
+func (t *Fb2ReaderAdapter) writeDescription(doc []byte, info *model.BookInfo, cover *model.Image) ([]byte, error) {
+	titleInfo, err := findXmlElement(doc, "FictionBook", "description", "title-info")
+	if err != nil {
+		return nil, err
+	}
+
+	elements := map[string][]*xmlElement{}
+	var others []*xmlElement
+	for _, e := range titleInfo.children {
+		if slices.Contains(fb2TitleInfo, e.Name.Local) {
+			elements[e.Name.Local] = append(elements[e.Name.Local], e)
+		} else {
+			others = append(others, e)
+		}
+	}
+
+	var coverpage, binary string
+	if cover != nil && len(elements["coverpage"]) == 0 {
+		root, err := findXmlElement(doc, "FictionBook")
+		if err != nil {
+			return nil, err
+		}
+
+		href, decl := "l:href", ` xmlns:l="`+xlinkNamespace+`"`
+		if prefix := xmlPrefix(doc[:root.open], xlinkNamespace); prefix != "" {
+			href, decl = prefix+":href", ""
+		}
+
+		id := t.coverId(root, cover)
+		coverpage = xmlMarkup("coverpage", "<image"+decl+" "+href+`="#`+escapeXml(id)+`"/>`)
+		binary = xmlTag("binary", base64.StdEncoding.EncodeToString(cover.Data), "id", id, "content-type", cover.ContentType)
+	}
+
+	text := func(e *xmlElement) string {
+		return strings.Join(strings.Fields(e.text), " ")
+	}
+	person := func(e *xmlElement) string {
+		return fb2PersonName(e.markup(doc))
+	}
+
+	var content []string
+	for _, name := range fb2TitleInfo {
+		switch name {
+		case "genre":
+			// a book must have a genre, an author and a language, so the
+			// ones it has are kept where the library has none
+			if len(info.Genres) == 0 {
+				content = append(content, markups(doc, elements[name])...)
+			}
+			for _, genre := range info.Genres {
+				content = append(content, t.keep(doc, elements, name, genre, text, xmlTag(name, genre)))
+			}
+		case "author":
+			authors := len(content)
+			for _, c := range info.Authors {
+				if c.Role == roleAuthor {
+					content = append(content, t.keep(doc, elements, name, c.Name, person, t.person(name, c.Name)))
+				}
+			}
+			if len(content) == authors {
+				content = append(content, markups(doc, elements[name])...)
+			}
+		case "book-title":
+			content = append(content, t.keep(doc, elements, name, info.Title, text, xmlTag(name, info.Title)))
+		case "annotation":
+			if info.Annotation != "" {
+				annotation := func(e *xmlElement) string {
+					return fb2Annotation(e.markup(doc))
+				}
+				content = append(content, t.keep(doc, elements, name, info.Annotation, annotation, t.annotation(info.Annotation)))
+			}
+		case "lang":
+			if info.Language == "" {
+				content = append(content, markups(doc, elements[name])...)
+			} else {
+				content = append(content, t.keep(doc, elements, name, info.Language, text, xmlTag(name, info.Language)))
+			}
+		case "translator":
+			for _, translator := range info.Translators {
+				content = append(content, t.keep(doc, elements, name, translator, person, t.person(name, translator)))
+			}
+		case "sequence":
+			if info.Series != "" {
+				content = append(content, t.sequence(info))
+			}
+		case "coverpage":
+			if coverpage != "" {
+				content = append(content, coverpage)
+			}
+			content = append(content, markups(doc, elements[name])...)
+		default:
+			content = append(content, markups(doc, elements[name])...)
+		}
+	}
+	content = append(content, markups(doc, others)...)
+
+	out, err := t.writeSequence(replaceContent(doc, titleInfo, content, ""), info)
+	if err != nil {
+		return nil, err
+	}
+
+	if binary != "" {
+		root, err := findXmlElement(out, "FictionBook")
+		if err != nil {
+			return nil, err
+		}
+		out = slices.Concat(out[:root.close], []byte(binary+"\n"), out[root.close:])
+	}
+
+	return out, nil
+}
+
+// keep returns the first element named name that says value, which is then
+// not kept again, or the markup written for value if there is none.
+func (t *Fb2ReaderAdapter) keep(doc []byte, elements map[string][]*xmlElement, name, value string, says func(*xmlElement) string, markup string) string {
+	for i, e := range elements[name] {
+		if says(e) == value {
+			elements[name] = append(elements[name][:i:i], elements[name][i+1:]...)
+			return e.markup(doc)
+		}
+	}
+
+	return markup
+}
+
+// writeSequence replaces the series of publish-info, if it names one, with
+// the series of info.
+func (t *Fb2ReaderAdapter) writeSequence(doc []byte, info *model.BookInfo) ([]byte, error) {
+	publishInfo, err := findXmlElement(doc, "FictionBook", "description", "publish-info")
+	if err != nil {
+		// publish-info is optional
+		return doc, nil
+	}
+
+	var content []string
+	var sequences int
+	for _, e := range publishInfo.children {
+		if e.Name.Local == "sequence" {
+			sequences++
+		} else {
+			content = append(content, e.markup(doc))
+		}
+	}
+
+	if sequences == 0 {
+		return doc, nil
+	}
+
+	if info.Series != "" {
+		content = append(content, t.sequence(info))
+	}
+
+	return replaceContent(doc, publishInfo, content, ""), nil
+}
+
+func (t *Fb2ReaderAdapter) sequence(info *model.BookInfo) string {
+	number := ""
+	if info.SeriesIndex > 0 {
+		number = strconv.FormatFloat(info.SeriesIndex, 'f', -1, 64)
+	}
+
+	return xmlTag("sequence", "", "name", info.Series, "number", number)
+}
+
+// person writes a name as an author or translator. The last word is taken
+// for the last name, and a single word for a nickname.
+func (t *Fb2ReaderAdapter) person(element, name string) string {
+	words := strings.Fields(name)
+	if len(words) < 2 {
+		return xmlMarkup(element, xmlTag("nickname", name))
+	}
+
+	first := strings.Join(words[:len(words)-1], " ")
+	return xmlMarkup(element, xmlTag("first-name", first)+xmlTag("last-name", words[len(words)-1]))
+}
+
+// annotation writes a paragraph for every line of the text.
+func (t *Fb2ReaderAdapter) annotation(text string) string {
+	var paragraphs strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paragraphs.WriteString(xmlTag("p", line))
+		}
+	}
+
+	return xmlMarkup("annotation", paragraphs.String())
+}
+
+// coverId names the binary of a cover added to a book that has none.
+func (t *Fb2ReaderAdapter) coverId(root *xmlParent, cover *model.Image) string {
+	ext := path.Ext(cover.Name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(cover.ContentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, e := range root.children {
+		if e.Name.Local == "binary" {
+			ids[e.attr("id")] = true
+		}
+	}
+
+	id := "cover" + ext
+	for i := 1; ids[id]; i++ {
+		id = fmt.Sprintf("cover-%d%s", i, ext)
+	}
+
+	return id
+}
+
+// fb2PersonName reads the name of an author or translator element the way
+// the reader does.
+func fb2PersonName(markup string) string {
+	var author model.Fb2Author
+	if err := xml.Unmarshal([]byte(markup), &author); err != nil {
+		return ""
+	}
+
+	return fb2Name(author)
+}
+
+// fb2Annotation reads the text of an annotation element the way the reader
+// does.
+func fb2Annotation(markup string) string {
+	var annotation struct {
+		Content string `xml:",innerxml"`
+	}
+	if err := xml.Unmarshal([]byte(markup), &annotation); err != nil {
+		return ""
+	}
+
+	text, err := textFromHtml(strings.NewReader(strings.TrimSpace(annotation.Content)))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(text)
+}
+
+func markups(doc []byte, elements []*xmlElement) []string {
+	var out []string
+	for _, e := range elements {
+		out = append(out, e.markup(doc))
+	}
+
+	return out
+}
@@ -0,0 +1,194 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"golang.org/x/net/html"
+	"os"
+	"strings"
+)
+
+type HtmlReaderAdapter struct{}
+
+func (t *HtmlReaderAdapter) Parse(path string) (string, error) {
+	text, err := t.read(path)
+	if err != nil {
+		return "", err
+	}
+
+	return textFromHtml(strings.NewReader(text))
+}
+
+func (t *HtmlReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	doc, err := t.parse(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var h1, h2 uint
+	walkHtml(doc, func(n *html.Node) {
+		switch n.Data {
+		case "h1":
+			h1++
+		case "h2":
+			h2++
+		}
+	})
+
+	if h1 <= 1 && h2 > 0 {
+		return h2, nil
+	}
+
+	return h1, nil
+}
+
+func (t *HtmlReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	doc, err := t.parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text, marks := extractHtml(doc)
+	chapters := headingChapters(marks)
+	toRuneOffsets(text, chapters)
+
+	return chapters, nil
+}
+
+func (t *HtmlReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	doc, err := t.parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, _ := htmlBlocks(doc)
+	return blocks, nil
+}
+
+func (t *HtmlReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	doc, err := t.parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, notes := htmlBlocks(doc)
+	return notes, nil
+}
+
+func (t *HtmlReaderAdapter) GetCover(path string) (*model.Image, error) {
+	return nil, nil
+}
+
+func (t *HtmlReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	return nil, errImageNotFound
+}
+
+func (t *HtmlReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	doc, err := t.parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bookInfo := &model.BookInfo{}
+	var heading string
+	var authors []string
+
+	walkHtml(doc, func(n *html.Node) {
+		switch n.Data {
+		case "html":
+			for _, attr := range n.Attr {
+				if attr.Key == "lang" && bookInfo.Language == "" {
+					bookInfo.Language = strings.TrimSpace(attr.Val)
+				}
+			}
+		case "title":
+			if bookInfo.Title == "" {
+				bookInfo.Title = strings.Join(strings.Fields(nodeText(n)), " ")
+			}
+		case "h1":
+			if heading == "" {
+				heading = strings.Join(strings.Fields(nodeText(n)), " ")
+			}
+		case "meta":
+			var name, content string
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "name", "property":
+					name = strings.ToLower(attr.Val)
+				case "content":
+					content = strings.TrimSpace(attr.Val)
+				}
+			}
+
+			switch name {
+			case "author", "dc.creator", "dcterms.creator":
+				authors = append(authors, splitNames(content)...)
+			case "description", "dc.description", "dcterms.abstract":
+				if bookInfo.Annotation == "" {
+					bookInfo.Annotation = content
+				}
+			case "dc.title", "dcterms.title":
+				bookInfo.Title = content
+			case "dc.language", "dcterms.language":
+				bookInfo.Language = content
+			case "dc.publisher", "dcterms.publisher":
+				bookInfo.Publisher = content
+			case "dc.date", "dcterms.issued", "dcterms.date":
+				if bookInfo.PublishDate == "" {
+					bookInfo.PublishDate = content
+				}
+			case "keywords", "dc.subject", "dcterms.subject":
+				bookInfo.Genres = addUnique(bookInfo.Genres, strings.Split(content, ",")...)
+			case "dc.identifier", "dcterms.identifier":
+				bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "", content)
+			}
+		}
+	})
+	setAuthors(bookInfo, authorsOf(authors))
+
+	if bookInfo.Title == "" {
+		bookInfo.Title = heading
+	}
+
+	return bookInfo, nil
+}
+
+func (t *HtmlReaderAdapter) read(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeText(data, sniffCharset(data)), nil
+}
+
+func (t *HtmlReaderAdapter) parse(path string) (*html.Node, error) {
+	text, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return html.Parse(strings.NewReader(text))
+}
+
+func walkHtml(n *html.Node, fn func(n *html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHtml(c, fn)
+	}
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+
+	return sb.String()
+}
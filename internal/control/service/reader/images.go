@@ -0,0 +1,47 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var errImageNotFound = fmt.Errorf("image not found")
+
+// newImage wraps image data found in a book. Anything that does not look like
+// an image is rejected so that book internals can not be served as images.
+func newImage(name string, data []byte) (*model.Image, error) {
+	contentType := http.DetectContentType(data)
+	if strings.EqualFold(path.Ext(name), ".svg") {
+		contentType = "image/svg+xml"
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%s is not an image", name)
+	}
+
+	return &model.Image{Name: name, ContentType: contentType, Data: data}, nil
+}
+
+// rewriteRefs replaces the src of every image block and the href of every
+// link with the result of fn, turning references relative to a book file
+// into image names and note refs.
+func rewriteRefs(blocks []*model.Block, fn func(ref string) string) {
+	for _, b := range blocks {
+		if b.Type == model.BlockImage {
+			b.Src = fn(b.Src)
+		}
+		for i := range b.Inlines {
+			if b.Inlines[i].Href != "" {
+				b.Inlines[i].Href = fn(b.Inlines[i].Href)
+			}
+		}
+		rewriteRefs(b.Children, fn)
+	}
+}
+
+func isExternalLink(src string) bool {
+	return strings.Contains(src, ":") && !strings.HasPrefix(src, "#")
+}
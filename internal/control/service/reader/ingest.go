@@ -0,0 +1,219 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ingestion is everything upload needs to know about a book, collected in a
+// single pass over the file.
+type Ingestion struct {
+	Info          *model.BookInfo
+	ChaptersCount uint
+	Chapters      []*model.Chapter
+	Pages         map[string]*PageIndex
+}
+
+// streamer is implemented by adapters that can read a book without holding
+// all of its text, writing the text to the sink as it goes. The returned
+// ingestion has no pages, they are built by the sink.
+type streamer interface {
+	stream(path string, sink *textSink) (*Ingestion, error)
+}
+
+// Ingest reads a book once, writing its plain text to w and building the page
+// index of every profile on the way. Formats that cannot be streamed are
+// parsed as a whole.
+func (s *ReaderService) Ingest(path string, w io.Writer, profiles []Profile) (*Ingestion, error) {
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ingestion *Ingestion
+	if st, ok := adapter.(streamer); ok {
+		sink := newTextSink(w, profiles)
+		if ingestion, err = st.stream(file, sink); err != nil {
+			return nil, err
+		}
+		if ingestion.Pages, err = sink.finish(); err != nil {
+			return nil, fmt.Errorf("failed to write text: %v", err)
+		}
+	} else if ingestion, err = s.ingestText(path, w, profiles); err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(fmt.Sprintf("bookInfo:%s", path), ingestion.Info)
+	s.cache.Set(fmt.Sprintf("bookChaptersCount:%s", path), ingestion.ChaptersCount)
+	s.cache.Set(fmt.Sprintf("bookToc:%s", path), ingestion.Chapters)
+
+	return ingestion, nil
+}
+
+func (s *ReaderService) ingestText(path string, w io.Writer, profiles []Profile) (*Ingestion, error) {
+	count, err := s.GetChaptersCount(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.GetBookInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := s.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	toc, err := s.GetToc(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(w, text); err != nil {
+		return nil, fmt.Errorf("failed to write text: %v", err)
+	}
+
+	offsets := make([]uint, 0, len(toc))
+	for _, c := range toc {
+		offsets = append(offsets, c.Offset)
+	}
+
+	pages := make(map[string]*PageIndex, len(profiles))
+	for _, profile := range profiles {
+		pages[profile.Name] = NewPageIndex(text, offsets, profile)
+	}
+
+	return &Ingestion{Info: info, ChaptersCount: count, Chapters: toc, Pages: pages}, nil
+}
+
+// textSink receives the text of a book piece by piece, passing it on to the
+// writer and the page builders and keeping count of the runes so chapters
+// get their offsets.
+type textSink struct {
+	w        io.Writer
+	builders map[string]*PageBuilder
+	runes    uint
+	err      error
+
+	// trim drops the whitespace the text starts and ends with. Leading
+	// whitespace is dropped until started, trailing whitespace is pending
+	// until more text follows.
+	trim    bool
+	started bool
+	pending string
+
+	// text written while holding is kept back until release
+	holding bool
+	held    strings.Builder
+}
+
+func newTextSink(w io.Writer, profiles []Profile) *textSink {
+	builders := make(map[string]*PageBuilder, len(profiles))
+	for _, profile := range profiles {
+		builders[profile.Name] = NewPageBuilder(profile)
+	}
+
+	return &textSink{w: w, builders: builders}
+}
+
+func (s *textSink) WriteString(text string) {
+	if s.holding {
+		s.held.WriteString(text)
+		return
+	}
+
+	if !s.trim {
+		s.emit(text)
+		return
+	}
+
+	if !s.started {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return
+		}
+		s.started = true
+	}
+
+	body := strings.TrimRightFunc(text, unicode.IsSpace)
+	if body == "" {
+		s.pending += text
+		return
+	}
+
+	s.emit(s.pending)
+	s.emit(body)
+	s.pending = text[len(body):]
+}
+
+// chapter starts the chapter c at the end of the text written so far.
+func (s *textSink) chapter(c *model.Chapter) {
+	c.Offset = 0
+	if s.started || !s.trim {
+		s.emit(s.pending)
+		s.pending = ""
+		c.Offset = s.runes
+	}
+
+	for _, b := range s.builders {
+		b.Chapter()
+	}
+}
+
+// hold keeps back the text that follows, such as a heading that only starts
+// a chapter if it turns out not to be empty.
+func (s *textSink) hold() {
+	s.release(nil)
+	s.holding = true
+}
+
+// release writes the text kept back since hold, starting the chapter c
+// before it unless c is nil.
+func (s *textSink) release(c *model.Chapter) {
+	if !s.holding {
+		return
+	}
+
+	s.holding = false
+	if c != nil {
+		s.chapter(c)
+	}
+
+	s.WriteString(s.held.String())
+	s.held.Reset()
+}
+
+func (s *textSink) emit(text string) {
+	if text == "" {
+		return
+	}
+
+	if s.err == nil {
+		_, s.err = io.WriteString(s.w, text)
+	}
+	for _, b := range s.builders {
+		b.WriteString(text)
+	}
+	s.runes += uint(utf8.RuneCountInString(text))
+}
+
+// finish returns the page indexes of the text and the first write error.
+func (s *textSink) finish() (map[string]*PageIndex, error) {
+	s.release(nil)
+	if !s.trim {
+		s.emit(s.pending)
+	}
+
+	pages := make(map[string]*PageIndex, len(s.builders))
+	for name, b := range s.builders {
+		pages[name] = b.Index()
+	}
+
+	return pages, s.err
+}
@@ -0,0 +1,147 @@
+package reader
+
+import (
+	"BookStore/internal/control/service/cache"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchChapters and benchParagraphs size the sample books, which come to
+// about 9 MB of text, the size of a long novel series in one file.
+const (
+	benchChapters   = 300
+	benchParagraphs = 60
+)
+
+var benchSentence = "The rain had not stopped since morning, and the streets of the old town were empty but for a cart that rolled slowly towards the river. "
+
+func benchParagraph(chapter, n int) string {
+	return fmt.Sprintf("Chapter %d, paragraph %d. %s", chapter, n, strings.Repeat(benchSentence, 3))
+}
+
+// writeSampleFb2 writes a large FB2 book to dir and returns its path.
+func writeSampleFb2(tb testing.TB, dir string) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><genre>prose</genre><author><first-name>Sample</first-name><last-name>Author</last-name></author>
+<book-title>Sample Book</book-title><lang>en</lang></title-info></description>
+<body>
+`)
+	for c := 1; c <= benchChapters; c++ {
+		fmt.Fprintf(&sb, "<section><title><p>Chapter %d</p></title>\n", c)
+		for p := 1; p <= benchParagraphs; p++ {
+			sb.WriteString("<p>" + benchParagraph(c, p) + "</p>\n")
+		}
+		sb.WriteString("</section>\n")
+	}
+	sb.WriteString("</body>\n</FictionBook>\n")
+
+	path := filepath.Join(dir, "sample.fb2")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	return path
+}
+
+// writeSampleEpub writes a large EPUB book with a document for every chapter
+// to dir and returns its path.
+func writeSampleEpub(tb testing.TB, dir string) string {
+	path := filepath.Join(dir, "sample.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	add := func(name, data string, method uint16) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	add("mimetype", "application/epub+zip", zip.Store)
+	add("META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`, zip.Deflate)
+
+	var manifest, spine, nav strings.Builder
+	for c := 1; c <= benchChapters; c++ {
+		fmt.Fprintf(&manifest, `<item id="c%d" href="c%d.xhtml" media-type="application/xhtml+xml"/>`+"\n", c, c)
+		fmt.Fprintf(&spine, `<itemref idref="c%d"/>`+"\n", c)
+		fmt.Fprintf(&nav, `<li><a href="c%d.xhtml">Chapter %d</a></li>`+"\n", c, c)
+
+		var doc strings.Builder
+		fmt.Fprintf(&doc, `<?xml version="1.0" encoding="utf-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter %d</title></head><body>
+<h1>Chapter %d</h1>
+`, c, c)
+		for p := 1; p <= benchParagraphs; p++ {
+			doc.WriteString("<p>" + benchParagraph(c, p) + "</p>\n")
+		}
+		doc.WriteString("</body></html>\n")
+		add(fmt.Sprintf("OEBPS/c%d.xhtml", c), doc.String(), zip.Deflate)
+	}
+
+	add("OEBPS/nav.xhtml", `<?xml version="1.0" encoding="utf-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><head><title>Contents</title></head><body>
+<nav epub:type="toc"><ol>
+`+nav.String()+`</ol></nav></body></html>`, zip.Deflate)
+
+	add("OEBPS/content.opf", `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="uid">urn:uuid:00000000-0000-0000-0000-000000000000</dc:identifier>
+<dc:title>Sample Book</dc:title><dc:creator>Sample Author</dc:creator><dc:language>en</dc:language>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+`+manifest.String()+`</manifest>
+<spine>
+`+spine.String()+`</spine>
+</package>`, zip.Deflate)
+
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return path
+}
+
+func benchmarkIngest(b *testing.B, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(info.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// a new cache every time, or the metadata of the first pass is kept
+		s := NewService(WithCache(cache.NewService()))
+		if _, err := s.Ingest(path, io.Discard, DefaultProfiles); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIngestFb2(b *testing.B) {
+	benchmarkIngest(b, writeSampleFb2(b, b.TempDir()))
+}
+
+func BenchmarkIngestEpub(b *testing.B) {
+	benchmarkIngest(b, writeSampleEpub(b, b.TempDir()))
+}
@@ -0,0 +1,369 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdListItem = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+	mdRule     = regexp.MustCompile(`^\s*([-*_]\s*){3,}$`)
+)
+
+// mdSpan matches the inline markup of Markdown at once, so that the first
+// span of a text is found whatever its kind: an image, a link with its text
+// and href, code, strong or emphasis text with either delimiter, or an HTML
+// tag. Emphasis does not start or end with a space, "2 * 3 * 4" is no span.
+var mdSpan = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)` +
+	`|\[([^\]]*)\]\(\s*<?([^)\s>]*)>?[^)]*\)` +
+	"|`([^`]*)`" +
+	`|\*\*(.+?)\*\*|__(.+?)__` +
+	`|\*([^*\s](?:[^*]*[^*\s])?)\*|_([^_\s](?:[^_]*[^_\s])?)_` +
+	`|<[^>]+>`)
+
+// the groups of mdSpan
+const (
+	mdLinkText = 1 + iota
+	mdLinkHref
+	mdCode
+	mdStrongStars
+	mdStrongUnderscores
+	mdEmphasisStar
+	mdEmphasisUnderscore
+)
+
+type MarkdownReaderAdapter struct{}
+
+// mdBlock is a paragraph or heading of a Markdown file. Text is its plain
+// text, raw its Markdown, which code blocks have none of.
+type mdBlock struct {
+	text  string
+	raw   string
+	level int
+}
+
+func (t *MarkdownReaderAdapter) Parse(path string) (string, error) {
+	blocks, _, err := t.read(path)
+	if err != nil {
+		return "", err
+	}
+
+	paragraphs := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		paragraphs = append(paragraphs, b.text)
+	}
+
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+func (t *MarkdownReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	blocks, _, err := t.read(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(len(t.chapters(blocks))), nil
+}
+
+func (t *MarkdownReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	blocks, _, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	top := 0
+	for _, b := range t.chapters(blocks) {
+		top = b.level
+	}
+
+	var chapters []*model.Chapter
+	var offset int
+	for i, b := range blocks {
+		if i > 0 {
+			offset += 2
+		}
+		if b.level > 0 && top > 0 && b.level >= top && b.level < top+3 {
+			chapters = append(chapters, &model.Chapter{
+				Title:  b.text,
+				Level:  b.level - top + 1,
+				Offset: uint(offset),
+			})
+		}
+		offset += len(b.text)
+	}
+
+	text := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		text = append(text, b.text)
+	}
+	toRuneOffsets(strings.Join(text, "\n\n"), chapters)
+
+	return chapters, nil
+}
+
+func (t *MarkdownReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	blocks, _, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*model.Block, 0, len(blocks))
+	for _, b := range blocks {
+		block := textBlock(model.BlockParagraph, b.text)
+		if b.raw != "" {
+			block.Inlines = t.inlines(b.raw)
+		}
+		if b.level > 0 {
+			block.Type, block.Level = model.BlockHeading, b.level
+		}
+		out = append(out, block)
+	}
+
+	return out, nil
+}
+
+func (t *MarkdownReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	return nil, nil
+}
+
+func (t *MarkdownReaderAdapter) GetCover(path string) (*model.Image, error) {
+	return nil, nil
+}
+
+func (t *MarkdownReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	return nil, errImageNotFound
+}
+
+func (t *MarkdownReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	blocks, meta, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bookInfo := &model.BookInfo{
+		Title:       meta["title"],
+		Annotation:  meta["description"],
+		Series:      meta["series"],
+		SeriesIndex: seriesIndex(meta["series_index"]),
+		Language:    meta["lang"],
+		Publisher:   meta["publisher"],
+		PublishDate: meta["date"],
+	}
+	setAuthors(bookInfo, authorsOf(splitNames(strings.Trim(meta["author"], "[]"))))
+
+	if bookInfo.Annotation == "" {
+		bookInfo.Annotation = meta["summary"]
+	}
+
+	if bookInfo.Language == "" {
+		bookInfo.Language = meta["language"]
+	}
+
+	// lists may also be written inline, as [a, b]
+	for _, key := range []string{"genre", "genres", "tags", "keywords", "subject"} {
+		bookInfo.Genres = addUnique(bookInfo.Genres, strings.Split(strings.Trim(meta[key], "[]"), ",")...)
+	}
+
+	bookInfo.Translators = addUnique(nil, splitNames(strings.Trim(meta["translator"], "[]"))...)
+	bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "ISBN", meta["isbn"])
+	bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "", meta["identifier"])
+
+	if bookInfo.Title == "" {
+		for _, b := range blocks {
+			if b.level == 1 {
+				bookInfo.Title = b.text
+				break
+			}
+		}
+	}
+
+	return bookInfo, nil
+}
+
+// chapters returns the headings that split the book into chapters: the
+// first-level headings, or the second-level ones when the only first-level
+// heading is the book title.
+func (t *MarkdownReaderAdapter) chapters(blocks []mdBlock) []mdBlock {
+	var byLevel [7][]mdBlock
+	for _, b := range blocks {
+		byLevel[b.level] = append(byLevel[b.level], b)
+	}
+
+	if len(byLevel[1]) > 1 {
+		return byLevel[1]
+	}
+	if len(byLevel[2]) > 0 {
+		return byLevel[2]
+	}
+
+	return byLevel[1]
+}
+
+func (t *MarkdownReaderAdapter) read(path string) ([]mdBlock, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	text := strings.ReplaceAll(decodeText(data, ""), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	lines, meta := t.frontMatter(lines)
+
+	var blocks []mdBlock
+	var current []string
+	var fenced bool
+
+	flush := func() {
+		if len(current) > 0 {
+			raw := strings.Join(strings.Fields(strings.Join(current, " ")), " ")
+			if text := t.inline(raw); text != "" {
+				blocks = append(blocks, mdBlock{text: text, raw: raw})
+			}
+			current = nil
+		}
+	}
+
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flush()
+			fenced = !fenced
+			continue
+		}
+
+		if fenced {
+			if strings.TrimSpace(line) != "" {
+				blocks = append(blocks, mdBlock{text: strings.TrimRight(line, " \t")})
+			}
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimLeft(line, ">"))
+
+		switch {
+		case line == "" || mdRule.MatchString(line):
+			flush()
+		case mdHeading.MatchString(line):
+			flush()
+			m := mdHeading.FindStringSubmatch(line)
+			blocks = append(blocks, mdBlock{text: t.inline(m[2]), raw: m[2], level: len(m[1])})
+		case mdListItem.MatchString(line):
+			flush()
+			current = append(current, mdListItem.ReplaceAllString(line, ""))
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	return blocks, meta, nil
+}
+
+func (t *MarkdownReaderAdapter) inline(s string) string {
+	return inlinesText(t.inlines(s))
+}
+
+// inlines parses the inline markup of s into runs of text with their style.
+// Images and HTML tags are left out, code is kept as plain text.
+func (t *MarkdownReaderAdapter) inlines(s string) []model.Inline {
+	var ib inlineBuilder
+	t.span(&ib, s, model.Inline{})
+
+	return ib.finish()
+}
+
+func (t *MarkdownReaderAdapter) span(ib *inlineBuilder, s string, style model.Inline) {
+	for s != "" {
+		m := mdSpan.FindStringSubmatchIndex(s)
+		if m == nil {
+			ib.add(s, style)
+			return
+		}
+		ib.add(s[:m[0]], style)
+
+		group := func(n int) (string, bool) {
+			if m[2*n] < 0 {
+				return "", false
+			}
+			return s[m[2*n]:m[2*n+1]], true
+		}
+
+		inner := style
+		if text, ok := group(mdLinkText); ok {
+			inner.Href, _ = group(mdLinkHref)
+			t.span(ib, text, inner)
+		} else if text, ok := group(mdCode); ok {
+			ib.add(text, style)
+		} else if text, ok := group(mdStrongStars); ok {
+			inner.Strong = true
+			t.span(ib, text, inner)
+		} else if text, ok := group(mdStrongUnderscores); ok {
+			inner.Strong = true
+			t.span(ib, text, inner)
+		} else if text, ok := group(mdEmphasisStar); ok {
+			inner.Emphasis = true
+			t.span(ib, text, inner)
+		} else if text, ok := group(mdEmphasisUnderscore); ok {
+			// underscores within a word, as in snake_case, are no markup
+			before, _ := utf8.DecodeLastRuneInString(s[:m[0]])
+			after, _ := utf8.DecodeRuneInString(s[m[1]:])
+			if isWordRune(before) || isWordRune(after) {
+				ib.add("_", style)
+				s = s[m[0]+1:]
+				continue
+			}
+			inner.Emphasis = true
+			t.span(ib, text, inner)
+		}
+
+		s = s[m[1]:]
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// frontMatter strips a YAML front matter block and returns its flat
+// "key: value" pairs; list values are joined with commas.
+func (t *MarkdownReaderAdapter) frontMatter(lines []string) ([]string, map[string]string) {
+	meta := map[string]string{}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return lines, meta
+	}
+
+	var key string
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" || line == "..." {
+			return lines[i+1:], meta
+		}
+
+		if strings.HasPrefix(line, "- ") && key != "" {
+			item := strings.Trim(strings.TrimSpace(line[2:]), `"'`)
+			if meta[key] != "" {
+				meta[key] += ", "
+			}
+			meta[key] += item
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(k))
+		if key == "authors" {
+			key = "author"
+		}
+		meta[key] = strings.Trim(strings.TrimSpace(v), `"'`)
+	}
+
+	return lines, map[string]string{}
+}
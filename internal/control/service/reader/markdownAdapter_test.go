@@ -0,0 +1,72 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMarkdownParseBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.md")
+	data := "# The *First* Chapter\n\n" +
+		"It was **very** dark and *quiet*, said\n" +
+		"[the __old__ man](https://example.com/man \"title\").\n\n" +
+		"Keep `*code*`, snake_case_names and 2 * 3 * 4 as they are. ![cover](cover.png)\n\n" +
+		"```\n*not emphasis*\n```\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := (&MarkdownReaderAdapter{}).ParseBlocks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*model.Block{
+		{Type: model.BlockHeading, Level: 1, Inlines: []model.Inline{
+			{Text: "The "},
+			{Text: "First", Emphasis: true},
+			{Text: " Chapter"},
+		}},
+		{Type: model.BlockParagraph, Inlines: []model.Inline{
+			{Text: "It was "},
+			{Text: "very", Strong: true},
+			{Text: " dark and "},
+			{Text: "quiet", Emphasis: true},
+			{Text: ", said "},
+			{Text: "the ", Href: "https://example.com/man"},
+			{Text: "old", Strong: true, Href: "https://example.com/man"},
+			{Text: " man", Href: "https://example.com/man"},
+			{Text: "."},
+		}},
+		{Type: model.BlockParagraph, Inlines: []model.Inline{
+			{Text: "Keep *code*, snake_case_names and 2 * 3 * 4 as they are."},
+		}},
+		{Type: model.BlockParagraph, Inlines: []model.Inline{
+			{Text: "*not emphasis*"},
+		}},
+	}
+
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(blocks[i], want[i]) {
+			t.Errorf("block %d = %+v, want %+v", i, *blocks[i], *want[i])
+		}
+	}
+
+	text, err := (&MarkdownReaderAdapter{}).Parse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantText := "The First Chapter\n\n" +
+		"It was very dark and quiet, said the old man.\n\n" +
+		"Keep *code*, snake_case_names and 2 * 3 * 4 as they are.\n\n" +
+		"*not emphasis*"
+	if text != wantText {
+		t.Errorf("Parse = %q, want %q", text, wantText)
+	}
+}
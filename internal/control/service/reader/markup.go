@@ -0,0 +1,442 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"golang.org/x/net/html"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "section": true, "article": true,
+	"table": true, "ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+	"hr": true, "body": true, "mbp:pagebreak": true,
+}
+
+var skipTags = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "guide": true,
+}
+
+var headingLevels = map[string]int{
+	"h1": 1, "h2": 2, "h3": 3,
+}
+
+// textMark remembers where a heading, a page break or an element with an id
+// starts in the text extracted from HTML. Offset is a byte offset.
+type textMark struct {
+	tag    string
+	id     string
+	text   string
+	offset int
+}
+
+func textFromHtml(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	text, _ := extractHtml(doc)
+	return text, nil
+}
+
+func extractHtml(doc *html.Node) (string, []textMark) {
+	var paragraphs []string
+	var marks []textMark
+	var current strings.Builder
+	var size int
+
+	flush := func() {
+		raw := strings.Join(strings.Fields(current.String()), " ")
+		if raw != "" {
+			if len(paragraphs) > 0 {
+				size += 2
+			}
+			paragraphs = append(paragraphs, raw)
+			size += len(raw)
+		}
+		current.Reset()
+	}
+
+	next := func() int {
+		if len(paragraphs) > 0 {
+			return size + 2
+		}
+		return size
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if skipTags[n.Data] || isNoteElement(n) {
+				return
+			}
+			if blockTags[n.Data] {
+				flush()
+				defer flush()
+			}
+
+			if _, ok := headingLevels[n.Data]; ok || n.Data == "mbp:pagebreak" {
+				marks = append(marks, textMark{
+					tag:    n.Data,
+					text:   strings.Join(strings.Fields(nodeText(n)), " "),
+					offset: next(),
+				})
+			}
+			for _, attr := range n.Attr {
+				if attr.Key == "id" && attr.Val != "" {
+					marks = append(marks, textMark{id: attr.Val, offset: next()})
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return strings.Join(paragraphs, "\n\n"), marks
+}
+
+// headingChapters builds a table of contents from the h1-h3 headings found
+// in the text, nesting them relative to the topmost heading level used.
+func headingChapters(marks []textMark) []*model.Chapter {
+	top := 0
+	for _, m := range marks {
+		if level, ok := headingLevels[m.tag]; ok && m.text != "" && (top == 0 || level < top) {
+			top = level
+		}
+	}
+
+	var chapters []*model.Chapter
+	for _, m := range marks {
+		level, ok := headingLevels[m.tag]
+		if !ok || m.text == "" {
+			continue
+		}
+
+		chapters = append(chapters, &model.Chapter{
+			Title:  m.text,
+			Level:  level - top + 1,
+			Offset: uint(m.offset),
+		})
+	}
+
+	return chapters
+}
+
+// chapterTitle makes a title for a chapter that has none from the first line
+// of its text.
+func chapterTitle(text string) string {
+	text = strings.TrimSpace(text)
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = text[:idx]
+	}
+
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) > 80 {
+		return strings.TrimSpace(string(runes[:80])) + "…"
+	}
+
+	return string(runes)
+}
+
+// toRuneOffsets converts chapter offsets collected as byte offsets into text
+// to rune offsets, which is what pagination works with.
+func toRuneOffsets(text string, chapters []*model.Chapter) {
+	order := make([]*model.Chapter, len(chapters))
+	copy(order, chapters)
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Offset < order[j].Offset
+	})
+
+	var pos, runes int
+	for _, c := range order {
+		offset := min(int(c.Offset), len(text))
+		runes += utf8.RuneCountInString(text[pos:offset])
+		pos = offset
+		c.Offset = uint(runes)
+	}
+}
+
+// blocksFromHtml converts an HTML document into the block model. Poems,
+// stanzas and epigraphs are recognised by the class names that common
+// converters use. Footnotes, marked by the epub:type attribute, are returned
+// separately with the id of their element as the ref.
+func blocksFromHtml(doc *html.Node) ([]*model.Block, []*model.Note) {
+	var hb htmlBlockBuilder
+	blocks := hb.blocks(doc, model.BlockParagraph)
+	return blocks, hb.notes
+}
+
+// htmlBlocks converts a standalone HTML document, where notes are referred
+// to by #id links, and links the notes to their references.
+func htmlBlocks(doc *html.Node) ([]*model.Block, []*model.Note) {
+	blocks, notes := blocksFromHtml(doc)
+	linkNotes(blocks, notes, func(href string) string {
+		return strings.TrimPrefix(href, "#")
+	})
+
+	return blocks, notes
+}
+
+type htmlBlockBuilder struct {
+	ib    inlineBuilder
+	notes []*model.Note
+}
+
+// collectNotes looks for notes inside n. Inside a note collection such as
+// <section epub:type="endnotes"> every element with an id is a note.
+func (hb *htmlBlockBuilder) collectNotes(n *html.Node, collection bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+
+		id := htmlAttr(c, "id")
+		if id == "" || isNoteCollection(c) || !(collection || isNoteElement(c)) {
+			hb.collectNotes(c, collection || isNoteCollection(c))
+			continue
+		}
+
+		blocks := hb.blocks(c, model.BlockParagraph)
+		if len(blocks) > 0 {
+			hb.notes = append(hb.notes, &model.Note{Ref: id, Text: BlocksText(blocks), Blocks: blocks})
+		}
+	}
+}
+
+func (hb *htmlBlockBuilder) blocks(n *html.Node, leaf string) []*model.Block {
+	var out []*model.Block
+	flush := func() {
+		if inlines := hb.ib.finish(); inlines != nil {
+			out = append(out, &model.Block{Type: leaf, Inlines: inlines})
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && skipTags[c.Data] {
+			continue
+		}
+
+		if isBlockElement(c) {
+			flush()
+			out = append(out, hb.block(c, leaf)...)
+			continue
+		}
+
+		hb.inline(c, model.Inline{})
+	}
+	flush()
+
+	return out
+}
+
+func (hb *htmlBlockBuilder) block(n *html.Node, leaf string) []*model.Block {
+	container := func(kind, leaf string) []*model.Block {
+		children := hb.blocks(n, leaf)
+		if len(children) == 0 {
+			return nil
+		}
+		return []*model.Block{{Type: kind, ID: htmlAttr(n, "id"), Children: children}}
+	}
+
+	switch {
+	case len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6':
+		if inlines := hb.inlines(n); inlines != nil {
+			return []*model.Block{{Type: model.BlockHeading, Level: int(n.Data[1] - '0'), Inlines: inlines}}
+		}
+		return nil
+	case n.Data == "img" || n.Data == "image":
+		src := htmlAttr(n, "src")
+		if src == "" {
+			src = htmlAttr(n, "href")
+		}
+		if src == "" {
+			src = htmlAttr(n, "xlink:href")
+		}
+		if src == "" {
+			src = htmlAttr(n, "recindex")
+		}
+		if src == "" {
+			return nil
+		}
+		return []*model.Block{{Type: model.BlockImage, Src: src}}
+	case n.Data == "hr" || n.Data == "br":
+		return nil
+	case n.Data == "pre":
+		if text := strings.Trim(nodeText(n), "\r\n"); strings.TrimSpace(text) != "" {
+			return []*model.Block{textBlock(leaf, text)}
+		}
+		return nil
+	case isNoteElement(n):
+		if id := htmlAttr(n, "id"); id != "" && !isNoteCollection(n) {
+			blocks := hb.blocks(n, model.BlockParagraph)
+			if len(blocks) > 0 {
+				hb.notes = append(hb.notes, &model.Note{Ref: id, Text: BlocksText(blocks), Blocks: blocks})
+			}
+			return nil
+		}
+		hb.collectNotes(n, isNoteCollection(n))
+		return nil
+	case hasClass(n, "poem"):
+		return container(model.BlockPoem, model.BlockVerse)
+	case hasClass(n, "stanza"):
+		return container(model.BlockStanza, model.BlockVerse)
+	case hasClass(n, "epigraph"):
+		return container(model.BlockEpigraph, model.BlockParagraph)
+	case n.Data == "blockquote":
+		return container(model.BlockQuote, model.BlockParagraph)
+	case n.Data == "ul" || n.Data == "ol":
+		list := &model.Block{Type: model.BlockList, Ordered: n.Data == "ol"}
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.Data != "li" {
+				continue
+			}
+
+			if containsBlock(li) {
+				if children := hb.blocks(li, model.BlockParagraph); len(children) > 0 {
+					list.Children = append(list.Children, &model.Block{Type: model.BlockItem, Children: children})
+				}
+			} else if inlines := hb.inlines(li); inlines != nil {
+				list.Children = append(list.Children, &model.Block{Type: model.BlockItem, Inlines: inlines})
+			}
+		}
+		if len(list.Children) == 0 {
+			return nil
+		}
+		return []*model.Block{list}
+	case containsBlock(n):
+		return hb.blocks(n, leaf)
+	}
+
+	kind := leaf
+	if hasClass(n, "text-author") || hasClass(n, "attribution") {
+		kind = model.BlockAttribution
+	}
+	if inlines := hb.inlines(n); inlines != nil {
+		return []*model.Block{{Type: kind, Inlines: inlines}}
+	}
+
+	return nil
+}
+
+func (hb *htmlBlockBuilder) inlines(n *html.Node) []model.Inline {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		hb.inline(c, model.Inline{})
+	}
+
+	return hb.ib.finish()
+}
+
+func (hb *htmlBlockBuilder) inline(n *html.Node, style model.Inline) {
+	switch n.Type {
+	case html.TextNode:
+		hb.ib.add(n.Data, style)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "br":
+		hb.ib.lineBreak()
+		return
+	case "script", "style":
+		return
+	case "em", "i", "cite", "dfn":
+		style.Emphasis = true
+	case "strong", "b":
+		style.Strong = true
+	case "a":
+		if href := htmlAttr(n, "href"); href != "" {
+			style.Href = href
+			style.Note = strings.Contains(htmlAttr(n, "epub:type"), "noteref") || hasClass(n, "note")
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		hb.inline(c, style)
+	}
+}
+
+// isNoteElement reports whether n is a footnote or a collection of notes,
+// which are kept out of the main text.
+func isNoteElement(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	for _, kind := range strings.Fields(htmlAttr(n, "epub:type")) {
+		switch kind {
+		case "footnote", "endnote", "rearnote", "note", "footnotes", "endnotes", "rearnotes":
+			return true
+		}
+	}
+
+	return hasClass(n, "footnote")
+}
+
+func isNoteCollection(n *html.Node) bool {
+	for _, kind := range strings.Fields(htmlAttr(n, "epub:type")) {
+		switch kind {
+		case "footnotes", "endnotes", "rearnotes":
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBlockElement(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data == "br" {
+		return false
+	}
+
+	switch n.Data {
+	case "img", "image", "svg", "aside", "figure", "figcaption", "nav", "header", "footer", "html":
+		return true
+	}
+
+	return blockTags[n.Data]
+}
+
+func containsBlock(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBlockElement(c) || containsBlock(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
+
+func hasClass(n *html.Node, name string) bool {
+	for _, class := range strings.Fields(htmlAttr(n, "class")) {
+		if strings.EqualFold(class, name) {
+			return true
+		}
+	}
+
+	return false
+}
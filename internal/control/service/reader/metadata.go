@@ -0,0 +1,238 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	dbmodel "BookStore/internal/database/model"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const roleAuthor = dbmodel.RoleAuthor
+
+// relatorRoles names the MARC relator codes EPUB and other formats give the
+// roles of contributors with.
+var relatorRoles = map[string]string{
+	"aut": roleAuthor,
+	"edt": "editor",
+	"ill": "illustrator",
+	"trl": "translator",
+	"nrt": "narrator",
+	"aui": "introduction",
+	"com": "compiler",
+}
+
+func contributorRole(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return roleAuthor
+	}
+
+	if role, ok := relatorRoles[code]; ok {
+		return role
+	}
+
+	return code
+}
+
+// relatorCode returns the MARC relator code of a role. Roles with no code
+// are codes read from a book already.
+func relatorCode(role string) string {
+	for code, r := range relatorRoles {
+		if r == role {
+			return code
+		}
+	}
+
+	return role
+}
+
+// setAuthors sets the contributors of the book, leaving out empty and
+// repeated names, and joins the names of the authors for display.
+func setAuthors(info *model.BookInfo, contributors []model.Contributor) {
+	seen := map[string]bool{}
+	info.Authors = nil
+	for _, c := range contributors {
+		c.Name = strings.Join(strings.Fields(c.Name), " ")
+		if c.Name == "" || seen[c.Name+"\x00"+c.Role] {
+			continue
+		}
+		seen[c.Name+"\x00"+c.Role] = true
+		info.Authors = append(info.Authors, c)
+	}
+
+	info.Author = dbmodel.AuthorNames(info.Authors, func(c model.Contributor) (string, string) {
+		return c.Name, c.Role
+	})
+}
+
+func authorsOf(names []string) []model.Contributor {
+	var authors []model.Contributor
+	for _, name := range names {
+		authors = append(authors, model.Contributor{Name: name, Role: roleAuthor})
+	}
+
+	return authors
+}
+
+// splitNames splits a list of people given as one string. Names are
+// separated by semicolons, ampersands or commas, but a comma between single
+// words is taken as in "Tolstoy, Leo" and kept.
+func splitNames(s string) []string {
+	var names []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '&' }) {
+		items := strings.Split(part, ",")
+		whole := false
+		for _, item := range items {
+			if len(strings.Fields(item)) < 2 {
+				whole = true
+			}
+		}
+
+		if whole {
+			items = []string{part}
+		}
+
+		for _, item := range items {
+			if name := strings.Join(strings.Fields(item), " "); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// addUnique appends the values missing from list, comparing them without
+// case.
+func addUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		v = strings.Join(strings.Fields(v), " ")
+		if v == "" {
+			continue
+		}
+
+		found := false
+		for _, item := range list {
+			if strings.EqualFold(item, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// addIdentifier appends an identifier unless it is empty or already there.
+// The scheme is guessed from URNs and the shape of the value when the book
+// does not give it; values of unknown schemes are left out.
+func addIdentifier(list []model.Identifier, scheme, value string) []model.Identifier {
+	scheme = strings.ToUpper(strings.TrimSpace(scheme))
+	value = strings.TrimSpace(value)
+
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"urn:", "isbn:", "uuid:"} {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+
+		if prefix == "urn:" {
+			if s, v, ok := strings.Cut(value[len(prefix):], ":"); ok {
+				scheme, value = strings.ToUpper(s), v
+			}
+		} else {
+			scheme, value = strings.ToUpper(strings.TrimSuffix(prefix, ":")), value[len(prefix):]
+		}
+		break
+	}
+
+	if isbn := cleanIsbn(value); isbn != "" && (scheme == "" || scheme == "ISBN") {
+		scheme, value = "ISBN", isbn
+	} else if scheme == "" && isUuid(value) {
+		scheme = "UUID"
+	}
+
+	if scheme == "" || value == "" {
+		return list
+	}
+
+	if scheme == "UUID" {
+		value = strings.ToLower(value)
+	}
+
+	for _, id := range list {
+		if id.Scheme == scheme && id.Value == value {
+			return list
+		}
+	}
+
+	return append(list, model.Identifier{Scheme: scheme, Value: value})
+}
+
+// cleanIsbn returns the ISBN-10 or ISBN-13 in s without dashes and spaces,
+// or an empty string if s is not one.
+func cleanIsbn(s string) string {
+	isbn := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+
+	if len(isbn) != 10 && len(isbn) != 13 {
+		return ""
+	}
+
+	for i, r := range isbn {
+		if r >= '0' && r <= '9' || r == 'X' && i == 9 && len(isbn) == 10 {
+			continue
+		}
+		return ""
+	}
+
+	return isbn
+}
+
+func isUuid(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(values[0])
+}
+
+// seriesIndex reads the number of a book in its series, 0 if there is none.
+func seriesIndex(s string) float64 {
+	index, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+	if err != nil || index < 0 {
+		return 0
+	}
+
+	return index
+}
@@ -0,0 +1,737 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding/charmap"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type MobiReaderAdapter struct{}
+
+// mobiRecordSize is the size of the text records when the header does not
+// tell it.
+const mobiRecordSize = 4096
+
+func (t *MobiReaderAdapter) Parse(path string) (string, error) {
+	book, records, err := t.open(path)
+	if err != nil {
+		return "", err
+	}
+
+	markup, err := t.readMarkup(book, records)
+	if err != nil {
+		return "", err
+	}
+
+	return textFromHtml(bytes.NewReader(markup))
+}
+
+func (t *MobiReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	book, records, err := t.open(path)
+	if err != nil {
+		return 0, err
+	}
+
+	markup, err := t.readMarkup(book, records)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	var hasText bool
+	var skip int
+
+	z := html.NewTokenizer(bytes.NewReader(markup))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "mbp:pagebreak", "body":
+				if hasText {
+					count++
+				}
+				hasText = false
+			case "head", "script", "style":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "head", "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.TextToken:
+			if skip == 0 && strings.TrimSpace(string(z.Text())) != "" {
+				hasText = true
+			}
+		}
+	}
+
+	if hasText {
+		count++
+	}
+
+	return count, nil
+}
+
+func (t *MobiReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	book, records, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	markup, err := t.readMarkup(book, records)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(markup))
+	if err != nil {
+		return nil, err
+	}
+
+	text, marks := extractHtml(doc)
+	chapters := headingChapters(marks)
+
+	if len(chapters) == 0 {
+		starts := []int{0}
+		for _, m := range marks {
+			if m.tag == "mbp:pagebreak" {
+				starts = append(starts, m.offset)
+			}
+		}
+
+		for _, start := range starts {
+			if start >= len(text) {
+				continue
+			}
+			if title := chapterTitle(text[start:]); title != "" {
+				if n := len(chapters); n > 0 && chapters[n-1].Offset == uint(start) {
+					continue
+				}
+				chapters = append(chapters, &model.Chapter{
+					Title:  title,
+					Level:  1,
+					Offset: uint(start),
+				})
+			}
+		}
+	}
+
+	toRuneOffsets(text, chapters)
+
+	return chapters, nil
+}
+
+func (t *MobiReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	blocks, _, err := t.readBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+func (t *MobiReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	_, notes, err := t.readBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (t *MobiReaderAdapter) readBlocks(path string) ([]*model.Block, []*model.Note, error) {
+	book, records, err := t.open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	markup, err := t.readMarkup(book, records)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(markup))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// images are referred to by a zero-padded recindex
+	blocks, notes := htmlBlocks(doc)
+	rewriteRefs(blocks, func(ref string) string {
+		if n, err := strconv.Atoi(ref); err == nil {
+			return strconv.Itoa(n)
+		}
+		return ref
+	})
+
+	return blocks, notes, nil
+}
+
+func (t *MobiReaderAdapter) GetCover(path string) (*model.Image, error) {
+	book, records, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.Cover < 0 {
+		return nil, nil
+	}
+
+	return t.image(book, records, book.Cover, "cover")
+}
+
+// GetImage returns an image by the recindex the markup refers to it with.
+func (t *MobiReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	n, err := strconv.Atoi(name)
+	if err != nil || n < 1 {
+		return nil, errImageNotFound
+	}
+
+	book, records, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.image(book, records, n-1, name)
+}
+
+func (t *MobiReaderAdapter) image(book *model.MobiBook, records [][]byte, offset int, name string) (*model.Image, error) {
+	first := int64(book.Mobi.FirstImageRecord)
+	if first == 0 || first == 0xFFFFFFFF {
+		return nil, errImageNotFound
+	}
+
+	idx := first + int64(offset)
+	if idx >= int64(len(records)) {
+		return nil, errImageNotFound
+	}
+
+	return newImage(name, records[idx])
+}
+
+func (t *MobiReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	book, _, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	title := book.FullName
+	if names := book.Exth[model.MobiExthUpdatedName]; len(names) > 0 && names[0] != "" {
+		title = names[0]
+	}
+
+	var annotation string
+	if desc := book.Exth[model.MobiExthDescription]; len(desc) > 0 {
+		annotation, err = textFromHtml(strings.NewReader(desc[0]))
+		if err != nil {
+			annotation = desc[0]
+		}
+	}
+
+	bookInfo := &model.BookInfo{
+		Title:      strings.TrimSpace(title),
+		Annotation: strings.TrimSpace(annotation),
+		Genres:     addUnique(nil, book.Exth[model.MobiExthSubject]...),
+		Language:   firstValue(book.Exth[model.MobiExthLanguage]),
+		Publisher:  firstValue(book.Exth[model.MobiExthPublisher]),
+		// calibre writes the date as an ISO timestamp
+		PublishDate: firstValue(book.Exth[model.MobiExthPublishDate]),
+	}
+
+	// calibre joins the authors of a book in one record
+	var names []string
+	for _, author := range book.Exth[model.MobiExthAuthor] {
+		names = append(names, splitNames(author)...)
+	}
+	setAuthors(bookInfo, authorsOf(names))
+
+	for _, isbn := range book.Exth[model.MobiExthIsbn] {
+		bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "ISBN", isbn)
+	}
+	for _, asin := range book.Exth[model.MobiExthAsin] {
+		bookInfo.Identifiers = addIdentifier(bookInfo.Identifiers, "ASIN", asin)
+	}
+
+	return bookInfo, nil
+}
+
+func (t *MobiReaderAdapter) open(path string) (*model.MobiBook, [][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, err := t.readRecords(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	book, err := t.readHeaders(records[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return book, records, nil
+}
+
+func (t *MobiReaderAdapter) readRecords(data []byte) ([][]byte, error) {
+	if len(data) < 78 {
+		return nil, fmt.Errorf("invalid palmdb header")
+	}
+
+	kind := string(data[60:68])
+	if kind != "BOOKMOBI" && kind != "TEXtREAd" {
+		return nil, fmt.Errorf("unsupported palmdb type: %q", kind)
+	}
+
+	num := int(binary.BigEndian.Uint16(data[76:78]))
+	if num == 0 || len(data) < 78+num*8 {
+		return nil, fmt.Errorf("invalid palmdb record list")
+	}
+
+	offsets := make([]int, num+1)
+	for i := 0; i < num; i++ {
+		offsets[i] = int(binary.BigEndian.Uint32(data[78+i*8:]))
+	}
+	offsets[num] = len(data)
+
+	records := make([][]byte, num)
+	for i := 0; i < num; i++ {
+		start, end := offsets[i], offsets[i+1]
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("invalid palmdb record %d", i)
+		}
+		records[i] = data[start:end]
+	}
+
+	return records, nil
+}
+
+func (t *MobiReaderAdapter) readHeaders(rec []byte) (*model.MobiBook, error) {
+	if len(rec) < 16 {
+		return nil, fmt.Errorf("invalid palmdoc header")
+	}
+
+	be := binary.BigEndian
+	book := &model.MobiBook{
+		PalmDoc: model.PalmDocHeader{
+			Compression:    be.Uint16(rec[0:]),
+			TextLength:     be.Uint32(rec[4:]),
+			RecordCount:    be.Uint16(rec[8:]),
+			RecordSize:     be.Uint16(rec[10:]),
+			EncryptionType: be.Uint16(rec[12:]),
+		},
+		Exth:  map[uint32][]string{},
+		Cover: -1,
+	}
+
+	if book.PalmDoc.EncryptionType != 0 {
+		return nil, fmt.Errorf("encrypted books are not supported")
+	}
+
+	if len(rec) < 132 || string(rec[16:20]) != "MOBI" {
+		return book, nil
+	}
+
+	h := model.MobiHeader{
+		HeaderLength:       be.Uint32(rec[20:]),
+		MobiType:           be.Uint32(rec[24:]),
+		TextEncoding:       be.Uint32(rec[28:]),
+		Version:            be.Uint32(rec[36:]),
+		FirstNonBookRecord: be.Uint32(rec[80:]),
+		FirstImageRecord:   be.Uint32(rec[108:]),
+		FullNameOffset:     be.Uint32(rec[84:]),
+		FullNameLength:     be.Uint32(rec[88:]),
+		HuffRecordOffset:   be.Uint32(rec[112:]),
+		HuffRecordCount:    be.Uint32(rec[116:]),
+		ExthFlags:          be.Uint32(rec[128:]),
+	}
+	if h.HeaderLength >= 0xE4 && len(rec) >= 0xF4 {
+		h.ExtraRecordFlags = be.Uint16(rec[0xF2:])
+	}
+	book.Mobi = h
+
+	if end := uint64(h.FullNameOffset) + uint64(h.FullNameLength); end <= uint64(len(rec)) {
+		book.FullName = t.decode(h, rec[h.FullNameOffset:end])
+	}
+
+	if h.ExthFlags&0x40 != 0 {
+		t.readExth(book, rec[min(uint64(16)+uint64(h.HeaderLength), uint64(len(rec))):])
+	}
+
+	return book, nil
+}
+
+func (t *MobiReaderAdapter) readExth(book *model.MobiBook, data []byte) {
+	if len(data) < 12 || string(data[0:4]) != "EXTH" {
+		return
+	}
+
+	count := binary.BigEndian.Uint32(data[8:])
+	pos := 12
+	for i := uint32(0); i < count && pos+8 <= len(data); i++ {
+		kind := binary.BigEndian.Uint32(data[pos:])
+		size := int(binary.BigEndian.Uint32(data[pos+4:]))
+		if size < 8 || pos+size > len(data) {
+			return
+		}
+
+		if kind == model.MobiExthCoverOffset && size == 12 {
+			book.Cover = int(binary.BigEndian.Uint32(data[pos+8:]))
+			pos += size
+			continue
+		}
+
+		value := t.decode(book.Mobi, data[pos+8:pos+size])
+		book.Exth[kind] = append(book.Exth[kind], strings.TrimSpace(value))
+		pos += size
+	}
+}
+
+func (t *MobiReaderAdapter) decode(h model.MobiHeader, data []byte) string {
+	if h.TextEncoding == 65001 {
+		return string(data)
+	}
+
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+
+	return string(decoded)
+}
+
+func (t *MobiReaderAdapter) readMarkup(book *model.MobiBook, records [][]byte) ([]byte, error) {
+	var huff *huffDecoder
+	if book.PalmDoc.Compression == model.MobiCompressionHuff {
+		var err error
+		huff, err = t.loadHuff(book.Mobi, records, int(book.PalmDoc.RecordSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	last := int(book.PalmDoc.RecordCount)
+	if last >= len(records) {
+		last = len(records) - 1
+	}
+
+	for i := 1; i <= last; i++ {
+		rec := records[i]
+		if book.Mobi.ExtraRecordFlags != 0 {
+			rec = rec[:len(rec)-trailingSize(rec, book.Mobi.ExtraRecordFlags)]
+		}
+
+		switch book.PalmDoc.Compression {
+		case model.MobiCompressionNone:
+			out.Write(rec)
+		case model.MobiCompressionPalmDoc:
+			out.Write(palmDocDecompress(rec))
+		case model.MobiCompressionHuff:
+			text, err := huff.unpack(rec, 0)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(text)
+		default:
+			return nil, fmt.Errorf("unsupported compression: %d", book.PalmDoc.Compression)
+		}
+	}
+
+	markup := out.Bytes()
+	if n := int(book.PalmDoc.TextLength); n > 0 && n < len(markup) {
+		markup = markup[:n]
+	}
+
+	if book.Mobi.TextEncoding != 65001 {
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(markup)
+		if err != nil {
+			return nil, err
+		}
+		markup = decoded
+	}
+
+	return markup, nil
+}
+
+// loadHuff reads the HUFF and CDIC records. A text record is not unpacked
+// to more than recordSize bytes.
+func (t *MobiReaderAdapter) loadHuff(h model.MobiHeader, records [][]byte, recordSize int) (*huffDecoder, error) {
+	first := int(h.HuffRecordOffset)
+	count := int(h.HuffRecordCount)
+	if count == 0 || first <= 0 || first+count > len(records) {
+		return nil, fmt.Errorf("invalid huff records")
+	}
+
+	if recordSize <= 0 {
+		recordSize = mobiRecordSize
+	}
+
+	huff := &huffDecoder{maxSize: recordSize}
+	if err := huff.loadHuff(records[first]); err != nil {
+		return nil, err
+	}
+
+	for i := first + 1; i < first+count; i++ {
+		if err := huff.loadCdic(records[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return huff, nil
+}
+
+// trailingSize returns the number of trailing bytes appended to a text record
+// that are described by the extra record data flags of the MOBI header.
+func trailingSize(rec []byte, flags uint16) int {
+	size := len(rec)
+	num := 0
+
+	for f := flags >> 1; f != 0; f >>= 1 {
+		if f&1 != 0 && num < size {
+			num += backwardVarint(rec[:size-num])
+		}
+	}
+
+	if flags&1 != 0 && size-num-1 >= 0 {
+		num += int(rec[size-num-1]&0x3) + 1
+	}
+
+	if num > size {
+		return size
+	}
+
+	return num
+}
+
+func backwardVarint(data []byte) int {
+	var result, shift int
+	for i := len(data) - 1; i >= 0; i-- {
+		v := data[i]
+		result |= int(v&0x7F) << shift
+		shift += 7
+		if v&0x80 != 0 || shift >= 28 {
+			break
+		}
+	}
+
+	return result
+}
+
+func palmDocDecompress(data []byte) []byte {
+	out := make([]byte, 0, len(data)*2)
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		i++
+
+		switch {
+		case c >= 1 && c <= 8:
+			end := min(i+int(c), len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case c < 0x80:
+			out = append(out, c)
+		case c >= 0xC0:
+			out = append(out, ' ', c^0x80)
+		default:
+			if i >= len(data) {
+				return out
+			}
+			pair := int(c)<<8 | int(data[i])
+			i++
+
+			distance := (pair >> 3) & 0x7FF
+			length := pair&0x7 + 3
+			if distance == 0 || distance > len(out) {
+				continue
+			}
+
+			start := len(out) - distance
+			for k := 0; k < length; k++ {
+				out = append(out, out[start+k])
+			}
+		}
+	}
+
+	return out
+}
+
+type huffCode struct {
+	codeLen int
+	term    bool
+	maxCode uint64
+}
+
+type huffEntry struct {
+	data     []byte
+	unpacked bool
+	busy     bool
+}
+
+type huffDecoder struct {
+	dict1      [256]huffCode
+	minCode    [33]uint64
+	maxCode    [33]uint64
+	dictionary []huffEntry
+	// maxSize bounds what a record or a dictionary entry unpacks to, since
+	// the entries expand into each other
+	maxSize int
+}
+
+func (h *huffDecoder) loadHuff(rec []byte) error {
+	if len(rec) < 24 || string(rec[0:4]) != "HUFF" {
+		return fmt.Errorf("invalid huff record")
+	}
+
+	off1 := int(binary.BigEndian.Uint32(rec[8:]))
+	off2 := int(binary.BigEndian.Uint32(rec[12:]))
+	if off1+256*4 > len(rec) || off2+64*4 > len(rec) {
+		return fmt.Errorf("invalid huff record")
+	}
+
+	for i := 0; i < 256; i++ {
+		v := binary.BigEndian.Uint32(rec[off1+i*4:])
+		code := huffCode{
+			codeLen: int(v & 0x1F),
+			term:    v&0x80 != 0,
+		}
+		if code.codeLen == 0 {
+			return fmt.Errorf("invalid huff code length")
+		}
+		code.maxCode = ((uint64(v>>8) + 1) << uint(32-code.codeLen)) - 1
+		h.dict1[i] = code
+	}
+
+	h.maxCode[0] = (1 << 32) - 1
+	for i := 1; i <= 32; i++ {
+		minCode := uint64(binary.BigEndian.Uint32(rec[off2+(i-1)*8:]))
+		maxCode := uint64(binary.BigEndian.Uint32(rec[off2+(i-1)*8+4:]))
+		h.minCode[i] = minCode << uint(32-i)
+		h.maxCode[i] = ((maxCode + 1) << uint(32-i)) - 1
+	}
+
+	return nil
+}
+
+func (h *huffDecoder) loadCdic(rec []byte) error {
+	if len(rec) < 16 || string(rec[0:4]) != "CDIC" {
+		return fmt.Errorf("invalid cdic record")
+	}
+
+	phrases := int(binary.BigEndian.Uint32(rec[8:]))
+	bits := binary.BigEndian.Uint32(rec[12:])
+	if bits > 31 {
+		return fmt.Errorf("invalid cdic record")
+	}
+
+	n := min(1<<bits, phrases-len(h.dictionary))
+	for i := 0; i < n; i++ {
+		if 16+i*2+2 > len(rec) {
+			return fmt.Errorf("invalid cdic record")
+		}
+		off := int(binary.BigEndian.Uint16(rec[16+i*2:]))
+		if 18+off > len(rec) {
+			return fmt.Errorf("invalid cdic record")
+		}
+
+		blen := binary.BigEndian.Uint16(rec[16+off:])
+		end := 18 + off + int(blen&0x7FFF)
+		if end > len(rec) {
+			return fmt.Errorf("invalid cdic record")
+		}
+
+		h.dictionary = append(h.dictionary, huffEntry{
+			data:     rec[18+off : end],
+			unpacked: blen&0x8000 != 0,
+		})
+	}
+
+	return nil
+}
+
+func (h *huffDecoder) unpack(data []byte, depth int) ([]byte, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("huff dictionary is too deep")
+	}
+
+	buf := make([]byte, len(data)+8)
+	copy(buf, data)
+
+	bitsLeft := len(data) * 8
+	pos := 0
+	x := binary.BigEndian.Uint64(buf[pos:])
+	n := 32
+
+	var out []byte
+	for {
+		if n <= 0 {
+			pos += 4
+			if pos+8 > len(buf) {
+				break
+			}
+			x = binary.BigEndian.Uint64(buf[pos:])
+			n += 32
+		}
+
+		code := (x >> uint(n)) & 0xFFFFFFFF
+		entry := h.dict1[code>>24]
+		codeLen, maxCode := entry.codeLen, entry.maxCode
+		if !entry.term {
+			for codeLen < 32 && code < h.minCode[codeLen] {
+				codeLen++
+			}
+			maxCode = h.maxCode[codeLen]
+		}
+
+		n -= codeLen
+		bitsLeft -= codeLen
+		if bitsLeft < 0 {
+			break
+		}
+
+		r := int((maxCode - code) >> uint(32-codeLen))
+		if r < 0 || r >= len(h.dictionary) {
+			return nil, fmt.Errorf("invalid huff dictionary index: %d", r)
+		}
+
+		slice := &h.dictionary[r]
+		if !slice.unpacked {
+			if slice.busy {
+				return nil, fmt.Errorf("recursive huff dictionary entry")
+			}
+			slice.busy = true
+			unpacked, err := h.unpack(slice.data, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			slice.data, slice.unpacked, slice.busy = unpacked, true, false
+		}
+
+		if len(out)+len(slice.data) > h.maxSize {
+			return nil, fmt.Errorf("huff record unpacks to more than %d bytes", h.maxSize)
+		}
+		out = append(out, slice.data...)
+	}
+
+	return out, nil
+}
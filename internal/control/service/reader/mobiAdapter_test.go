@@ -0,0 +1,38 @@
+package reader
+
+import "testing"
+
+// TestHuffUnpackLimit checks that a record which unpacks to more than the
+// record size is refused. Every byte of the test data is a code of eight
+// bits, which stands for the first dictionary entry unless set otherwise.
+func TestHuffUnpackLimit(t *testing.T) {
+	newDecoder := func(maxSize int) *huffDecoder {
+		h := &huffDecoder{maxSize: maxSize}
+		for b := range h.dict1 {
+			h.dict1[b] = huffCode{codeLen: 8, term: true, maxCode: uint64(b+1)<<24 - 1}
+		}
+		h.dictionary = []huffEntry{{data: []byte("word"), unpacked: true}}
+		return h
+	}
+
+	text, err := newDecoder(8).unpack([]byte{0, 0}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "wordword" {
+		t.Errorf("unpack = %q, want %q", text, "wordword")
+	}
+
+	if _, err := newDecoder(8).unpack([]byte{0, 0, 0}, 0); err == nil {
+		t.Error("unpack of three entries into eight bytes succeeded")
+	}
+
+	// a packed entry that expands past the limit while it is unpacked is
+	// refused as well
+	h := newDecoder(16)
+	h.dictionary = append(h.dictionary, huffEntry{data: make([]byte, 5)})
+	h.dict1[1].maxCode = uint64(3)<<24 - 1
+	if _, err := h.unpack([]byte{1}, 0); err == nil {
+		t.Error("unpack of an entry expanding to twenty bytes succeeded")
+	}
+}
@@ -0,0 +1,546 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var pageIndexMagic = []byte("PIDX")
+
+// PageIndex holds where every page of a text starts, as a byte offset for
+// slicing the text and as a rune offset, which chapter offsets are given in.
+type PageIndex struct {
+	PageSize  uint
+	Bytes     []uint
+	Runes     []uint
+	Size      uint
+	RuneCount uint
+}
+
+// Kinds of places a page can end at, from the least to the most preferred.
+const (
+	breakWord = iota
+	breakSentence
+	breakLine
+	breakParagraph
+)
+
+type pageBreak struct {
+	pos   uint
+	runes uint
+	kind  int
+}
+
+// NewPageIndex splits text into the pages of a profile, see PageBuilder.
+// Chapters are given by the rune offsets of their starts.
+func NewPageIndex(text string, chapters []uint, profile Profile) *PageIndex {
+	offsets := append([]uint(nil), chapters...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	b := NewPageBuilder(profile)
+	var pos, runes uint
+	for _, offset := range offsets {
+		start := pos
+		for runes < offset && pos < uint(len(text)) {
+			_, w := utf8.DecodeRuneInString(text[pos:])
+			pos, runes = pos+uint(w), runes+1
+		}
+		b.WriteString(text[start:pos])
+
+		if pos >= uint(len(text)) {
+			break
+		}
+		b.Chapter()
+	}
+	b.WriteString(text[pos:])
+
+	return b.Index()
+}
+
+// States of the heading that follows a chapter start.
+const (
+	headingNone = iota
+	headingStart
+	headingLine
+	headingEnd
+)
+
+// PageBuilder builds the page index of a profile from text that is written
+// to it piece by piece, holding no more than about two pages of it at a time.
+// A page ends at the paragraph break closest to the page size, or at a
+// sentence end when no paragraph ends near it. Every chapter begins a new
+// page, and a chapter heading stays on the page of the paragraph that follows
+// it; a chapter that starts right after the heading of the previous one, like
+// a part title followed by its first chapter, shares the page with it.
+type PageBuilder struct {
+	p         paginator
+	idx       *PageIndex
+	baseRunes uint
+	// runes counts the runes of the buffered text, lastWord the ones up to
+	// the last non-space rune
+	runes    uint
+	lastWord uint
+	heading  int
+	// nextHeading is set when a chapter started after the text of the
+	// current heading line, which makes the next line a heading as well
+	nextHeading bool
+}
+
+func NewPageBuilder(profile Profile) *PageBuilder {
+	return &PageBuilder{
+		p:   paginator{size: profile.PageSize, keep: map[uint]bool{}},
+		idx: &PageIndex{PageSize: profile.PageSize},
+	}
+}
+
+// WriteString adds text to the end of the book.
+func (b *PageBuilder) WriteString(text string) {
+	pos := b.p.base + uint(len(b.p.text))
+	for _, r := range text {
+		space := unicode.IsSpace(r)
+		switch b.heading {
+		case headingStart:
+			if !space {
+				b.heading = headingLine
+			}
+		case headingLine:
+			if r == '\n' {
+				b.heading = headingEnd
+			} else if !space {
+				b.nextHeading = false
+			}
+		case headingEnd:
+			if !space {
+				b.p.keep[pos] = true
+				b.heading = headingNone
+				if b.nextHeading {
+					b.heading = headingLine
+				}
+				b.nextHeading = false
+			}
+		}
+
+		b.runes++
+		if !space {
+			b.lastWord = b.runes
+		}
+		pos += uint(utf8.RuneLen(r))
+	}
+
+	b.p.text = append(b.p.text, text...)
+	b.flush(false)
+}
+
+// Chapter starts a new chapter at the end of the text written so far.
+// A chapter that starts before the heading of the previous one is over shares
+// the page with it, its heading starts at the next non-space rune.
+func (b *PageBuilder) Chapter() {
+	switch b.heading {
+	case headingNone:
+		b.flush(true)
+		b.heading = headingStart
+	case headingLine, headingEnd:
+		b.nextHeading = true
+	}
+}
+
+// Index finishes the last page and returns the index.
+func (b *PageBuilder) Index() *PageIndex {
+	b.flush(true)
+	b.idx.Size, b.idx.RuneCount = b.p.base, b.baseRunes
+
+	return b.idx
+}
+
+// flush cuts the buffered text into pages. Unless the text is final, a page
+// is only cut when enough text follows to be sure where it ends.
+func (b *PageBuilder) flush(final bool) {
+	for len(b.p.text) > 0 {
+		if !final && b.lastWord <= 2*b.p.size+1 {
+			return
+		}
+
+		end, n := b.p.pageEnd(0, uint(len(b.p.text)))
+		if !final && end >= uint(len(b.p.text)) {
+			return
+		}
+
+		b.idx.Bytes = append(b.idx.Bytes, b.p.base)
+		b.idx.Runes = append(b.idx.Runes, b.baseRunes)
+
+		b.p.text = append(b.p.text[:0], b.p.text[end:]...)
+		b.p.base, b.baseRunes = b.p.base+end, b.baseRunes+n
+		b.runes -= n
+		b.lastWord -= min(b.lastWord, n)
+	}
+}
+
+type paginator struct {
+	// text is the part of the book from base on that is not paginated yet
+	text []byte
+	base uint
+	size uint
+	// keep holds the byte offsets of paragraphs that follow a heading, which
+	// must not start a page
+	keep map[uint]bool
+	// breaks is kept between pages so that looking for one does not allocate
+	breaks []pageBreak
+}
+
+// pageEnd returns where the page starting at pos ends, which is where the
+// next page starts, and the number of runes in the page. The page does not
+// go past limit.
+func (p *paginator) pageEnd(pos, limit uint) (uint, uint) {
+	breaks := p.breaks[:0]
+	defer func() { p.breaks = breaks[:0] }()
+
+	var n uint
+	var sentence bool
+
+	i := pos
+	for i < limit && n <= 2*p.size {
+		r, w := utf8.DecodeRune(p.text[i:])
+		if !unicode.IsSpace(r) {
+			i, n = i+uint(w), n+1
+			if isSentenceEnd(r) {
+				sentence = true
+			} else if !isClosingPunct(r) {
+				sentence = false
+			}
+			continue
+		}
+
+		var newlines int
+		for i < limit {
+			r, w := utf8.DecodeRune(p.text[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			if r == '\n' {
+				newlines++
+			}
+			i, n = i+uint(w), n+1
+		}
+
+		if i >= limit {
+			break
+		}
+
+		kind := breakWord
+		switch {
+		case newlines > 1:
+			kind = breakParagraph
+		case newlines == 1:
+			kind = breakLine
+		case sentence:
+			kind = breakSentence
+		}
+
+		if !p.keep[p.base+i] {
+			breaks = append(breaks, pageBreak{pos: i, runes: n, kind: kind})
+		}
+		sentence = false
+	}
+
+	target := p.size
+	if i >= limit {
+		if n <= p.size+p.size/4 {
+			return limit, n
+		}
+		// the rest of the chapter is less than two pages, split it evenly
+		target = n / 2
+	}
+
+	best := -1
+	for j, b := range breaks {
+		if b.runes < target-target/4 || b.runes > target+target/4 {
+			continue
+		}
+
+		if best < 0 || b.kind > breaks[best].kind ||
+			(b.kind == breaks[best].kind && distance(b.runes, target) < distance(breaks[best].runes, target)) {
+			best = j
+		}
+	}
+
+	if best >= 0 {
+		return breaks[best].pos, breaks[best].runes
+	}
+
+	// nothing to break at near the target, take the first break past it
+	for _, b := range breaks {
+		if b.runes >= target {
+			return b.pos, b.runes
+		}
+	}
+
+	if len(breaks) > 0 {
+		last := breaks[len(breaks)-1]
+		return last.pos, last.runes
+	}
+
+	if i >= limit {
+		return limit, n
+	}
+
+	// a word longer than two pages ends the page wherever it ends
+	for i < limit {
+		r, w := utf8.DecodeRune(p.text[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i, n = i+uint(w), n+1
+	}
+
+	return i, n
+}
+
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '!', '?', '…', '。', '！', '？':
+		return true
+	}
+
+	return false
+}
+
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '»', '”', '’':
+		return true
+	}
+
+	return false
+}
+
+func distance(a, b uint) uint {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
+
+func (p *PageIndex) Count() uint {
+	return uint(len(p.Bytes))
+}
+
+// Page returns the text of the page with the given number, starting from 1,
+// reading it from the text the index was built for.
+func (p *PageIndex) Page(r io.ReaderAt, page uint) (string, error) {
+	if p.Count() == 0 {
+		return "", nil
+	}
+
+	page = max(page, 1)
+	if page > p.Count() {
+		return "", fmt.Errorf("start out of bounds")
+	}
+
+	end := p.Size
+	if page < p.Count() {
+		end = p.Bytes[page]
+	}
+
+	data, err := readRange(r, p.Bytes[page-1], end)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Text returns the text between two rune offsets, reading only the pages
+// that hold it from the text the index was built for.
+func (p *PageIndex) Text(r io.ReaderAt, from, to uint) (string, error) {
+	to = min(to, p.RuneCount)
+	if from >= to {
+		return "", nil
+	}
+
+	first := p.PageForOffset(from) - 1
+	last := p.PageForOffset(to - 1)
+	end := p.Size
+	if last < p.Count() {
+		end = p.Bytes[last]
+	}
+
+	data, err := readRange(r, p.Bytes[first], end)
+	if err != nil {
+		return "", err
+	}
+
+	skip, n := from-p.Runes[first], to-from
+	var start, pos int
+	for i := uint(0); pos < len(data) && i < skip+n; i++ {
+		if i == skip {
+			start = pos
+		}
+		_, w := utf8.DecodeRune(data[pos:])
+		pos += w
+	}
+
+	return string(data[start:pos]), nil
+}
+
+func readRange(r io.ReaderAt, start, end uint) ([]byte, error) {
+	data := make([]byte, end-start)
+	if n, err := r.ReadAt(data, int64(start)); n < len(data) {
+		return nil, fmt.Errorf("failed to read text: %v", err)
+	}
+
+	return data, nil
+}
+
+// PageForOffset returns the number of the page that holds the rune at offset.
+func (p *PageIndex) PageForOffset(offset uint) uint {
+	page := sort.Search(len(p.Runes), func(i int) bool {
+		return p.Runes[i] > offset
+	})
+
+	return uint(max(page, 1))
+}
+
+// PageEnd returns the rune offset where the page with the given number ends.
+func (p *PageIndex) PageEnd(page uint) uint {
+	if page >= p.Count() {
+		return p.RuneCount
+	}
+
+	return p.Runes[page]
+}
+
+// legacyPageSize is the page size of the fixed pagination books had before
+// profiles, where a page was extended up to the next whitespace.
+const legacyPageSize uint = 1500
+
+// LegacyPageOffset returns the rune offset where a page of the fixed pagination
+// started, to migrate positions that were saved as page numbers.
+func LegacyPageOffset(text string, page uint) uint {
+	var pos, runes uint
+	for n := uint(1); n < page && pos < uint(len(text)); n++ {
+		for i := uint(0); i < legacyPageSize && pos < uint(len(text)); i++ {
+			_, w := utf8.DecodeRuneInString(text[pos:])
+			pos, runes = pos+uint(w), runes+1
+		}
+
+		for pos < uint(len(text)) {
+			r, w := utf8.DecodeRuneInString(text[pos:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			pos, runes = pos+uint(w), runes+1
+		}
+	}
+
+	return runes
+}
+
+// WritePageIndex stores the index in a file. Offsets are written as varint
+// deltas, which keeps the index of a novel within a few kilobytes.
+func WritePageIndex(path string, idx *PageIndex) error {
+	var buf bytes.Buffer
+	buf.Write(pageIndexMagic)
+
+	put := func(v uint) {
+		buf.Write(binary.AppendUvarint(nil, uint64(v)))
+	}
+	put(idx.PageSize)
+	put(idx.Size)
+	put(idx.RuneCount)
+	put(idx.Count())
+
+	var prevBytes, prevRunes uint
+	for i := range idx.Bytes {
+		put(idx.Bytes[i] - prevBytes)
+		put(idx.Runes[i] - prevRunes)
+		prevBytes, prevRunes = idx.Bytes[i], idx.Runes[i]
+	}
+
+	// the index is replaced at once so readers never see a partial file
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write page index: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write page index: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write page index: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write page index: %v", err)
+	}
+
+	return nil
+}
+
+// ReadPageIndex loads an index written by WritePageIndex. An index made with
+// another page size than the profile has is reported as an error so that it
+// gets rebuilt.
+func ReadPageIndex(path string, profile Profile) (*PageIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(pageIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, pageIndexMagic) {
+		return nil, fmt.Errorf("invalid page index")
+	}
+
+	var header [4]uint
+	for i := range header {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page index: %v", err)
+		}
+		header[i] = uint(v)
+	}
+
+	if header[0] != profile.PageSize {
+		return nil, fmt.Errorf("page index was built for another page size")
+	}
+
+	idx := &PageIndex{
+		PageSize:  header[0],
+		Size:      header[1],
+		RuneCount: header[2],
+		Bytes:     make([]uint, 0, header[3]),
+		Runes:     make([]uint, 0, header[3]),
+	}
+
+	var pos, runes uint
+	for i := uint(0); i < header[3]; i++ {
+		db, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page index: %v", err)
+		}
+		dr, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page index: %v", err)
+		}
+
+		pos, runes = pos+uint(db), runes+uint(dr)
+		idx.Bytes = append(idx.Bytes, pos)
+		idx.Runes = append(idx.Runes, runes)
+	}
+
+	return idx, nil
+}
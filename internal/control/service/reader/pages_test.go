@@ -0,0 +1,74 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"strings"
+	"testing"
+)
+
+// sampleText returns the text of the sample books with the rune offsets of
+// their chapters.
+func sampleText() (string, []uint) {
+	var sb strings.Builder
+	var chapters []uint
+	var runes uint
+	for c := 1; c <= benchChapters; c++ {
+		chapters = append(chapters, runes)
+		for p := 1; p <= benchParagraphs; p++ {
+			paragraph := benchParagraph(c, p) + "\n\n"
+			sb.WriteString(paragraph)
+			runes += uint(len([]rune(paragraph)))
+		}
+	}
+
+	return sb.String(), chapters
+}
+
+func BenchmarkNewPageIndex(b *testing.B) {
+	text, chapters := sampleText()
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		NewPageIndex(text, chapters, DefaultProfiles[0])
+	}
+}
+
+// BenchmarkPageBuilder feeds the text a paragraph at a time, the way
+// ingestion streams it.
+func BenchmarkPageBuilder(b *testing.B) {
+	text, _ := sampleText()
+	paragraphs := strings.SplitAfter(text, "\n\n")
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		builder := NewPageBuilder(DefaultProfiles[0])
+		for j, p := range paragraphs {
+			if j%benchParagraphs == 0 {
+				builder.Chapter()
+			}
+			builder.WriteString(p)
+		}
+		builder.Index()
+	}
+}
+
+func BenchmarkPageBlocks(b *testing.B) {
+	text, _ := sampleText()
+	var blocks []*model.Block
+	for _, p := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		blocks = append(blocks, textBlock(model.BlockParagraph, p))
+	}
+	index := BlockPages(blocks, DefaultProfiles[0])
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, ok := PageBlocks(blocks, index, index.Count()/2); !ok {
+			b.Fatal("page out of bounds")
+		}
+	}
+}
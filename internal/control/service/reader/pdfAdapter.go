@@ -0,0 +1,443 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+type PdfReaderAdapter struct {
+	// maxStreamSize bounds what a stream of the file may decode to
+	maxStreamSize int64
+}
+
+func (t *PdfReaderAdapter) open(path string) (*pdfDocument, error) {
+	return openPdf(path, t.maxStreamSize)
+}
+
+func (t *PdfReaderAdapter) Parse(path string) (string, error) {
+	doc, err := t.open(path)
+	if err != nil {
+		return "", err
+	}
+
+	pages, _ := t.pages(doc)
+	text, _ := t.text(doc, pages)
+
+	return text, nil
+}
+
+func (t *PdfReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	text, err := t.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*model.Block
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			blocks = append(blocks, textBlock(model.BlockParagraph, p))
+		}
+	}
+
+	return blocks, nil
+}
+
+func (t *PdfReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	doc, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	outlines := doc.dict(doc.catalog()["Outlines"])
+	if outlines == nil {
+		return nil, nil
+	}
+
+	pages, numbers := t.pages(doc)
+	text, starts := t.text(doc, pages)
+
+	var chapters []*model.Chapter
+	visited := map[int]bool{}
+
+	var walk func(first any, level int)
+	walk = func(first any, level int) {
+		if level > 16 {
+			return
+		}
+
+		for _, item := range t.outlineItems(doc, first) {
+			if ref, ok := item["First"].(pdfRef); ok && visited[ref.num] {
+				continue
+			}
+
+			title := ""
+			if s, ok := doc.resolve(item["Title"]).(pdfString); ok {
+				title = strings.Join(strings.Fields(pdfTextString(s)), " ")
+			}
+
+			if page, ok := t.destPage(doc, item, numbers); ok && title != "" && page < len(starts) {
+				chapters = append(chapters, &model.Chapter{
+					Title:  title,
+					Level:  level,
+					Offset: uint(starts[page]),
+				})
+			}
+
+			if ref, ok := item["First"].(pdfRef); ok {
+				visited[ref.num] = true
+			}
+			walk(item["First"], level+1)
+		}
+	}
+	walk(outlines["First"], 1)
+
+	toRuneOffsets(text, chapters)
+
+	return chapters, nil
+}
+
+// text joins the text of non-empty pages and returns the byte offset where
+// each page starts in the result.
+func (t *PdfReaderAdapter) text(doc *pdfDocument, pages []pdfDict) (string, []int) {
+	var content strings.Builder
+	starts := make([]int, 0, len(pages))
+	fontCache := map[int]*pdfFont{}
+
+	for _, page := range pages {
+		text := doc.pageText(page, fontCache)
+		if strings.TrimSpace(text) == "" {
+			starts = append(starts, content.Len())
+			continue
+		}
+
+		if content.Len() > 0 {
+			content.WriteString("\n\n")
+		}
+		starts = append(starts, content.Len())
+		content.WriteString(text)
+	}
+
+	return content.String(), starts
+}
+
+// destPage returns the index of the page an outline item points to. The
+// destination may be given directly, by name or through a GoTo action.
+func (t *PdfReaderAdapter) destPage(doc *pdfDocument, item pdfDict, numbers map[int]int) (int, bool) {
+	dest := doc.resolve(item["Dest"])
+	if dest == nil {
+		if action := doc.dict(item["A"]); action != nil && action["S"] == pdfName("GoTo") {
+			dest = doc.resolve(action["D"])
+		}
+	}
+
+	switch d := dest.(type) {
+	case pdfName:
+		dest = t.namedDest(doc, string(d))
+	case pdfString:
+		dest = t.namedDest(doc, string(d))
+	}
+
+	if dict := doc.dict(dest); dict != nil {
+		dest = doc.resolve(dict["D"])
+	}
+
+	arr, ok := dest.(pdfArray)
+	if !ok || len(arr) == 0 {
+		return 0, false
+	}
+
+	switch page := arr[0].(type) {
+	case pdfRef:
+		idx, ok := numbers[page.num]
+		return idx, ok
+	case int64:
+		return int(page), page >= 0
+	}
+
+	return 0, false
+}
+
+func (t *PdfReaderAdapter) namedDest(doc *pdfDocument, name string) any {
+	catalog := doc.catalog()
+	if dests := doc.dict(catalog["Dests"]); dests != nil {
+		if dest, ok := dests[pdfName(name)]; ok {
+			return doc.resolve(dest)
+		}
+	}
+
+	names := doc.dict(catalog["Names"])
+	if names == nil {
+		return nil
+	}
+
+	visited := map[int]bool{}
+	var lookup func(node any, depth int) any
+	lookup = func(node any, depth int) any {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return nil
+			}
+			visited[ref.num] = true
+		}
+
+		dict := doc.dict(node)
+		if dict == nil || depth > 32 {
+			return nil
+		}
+
+		if pairs, ok := doc.resolve(dict["Names"]).(pdfArray); ok {
+			for i := 0; i+1 < len(pairs); i += 2 {
+				if key, ok := doc.resolve(pairs[i]).(pdfString); ok && string(key) == name {
+					return doc.resolve(pairs[i+1])
+				}
+			}
+		}
+
+		if kids, ok := doc.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				if dest := lookup(kid, depth+1); dest != nil {
+					return dest
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return lookup(names["Dests"], 0)
+}
+
+func (t *PdfReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	doc, err := t.open(path)
+	if err != nil {
+		return 0, err
+	}
+
+	outlines := doc.dict(doc.catalog()["Outlines"])
+	if outlines == nil {
+		return 0, nil
+	}
+
+	items := t.outlineItems(doc, outlines["First"])
+	if len(items) == 1 {
+		if children := t.outlineItems(doc, items[0]["First"]); len(children) > 0 {
+			items = children
+		}
+	}
+
+	return uint(len(items)), nil
+}
+
+func (t *PdfReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	return nil, nil
+}
+
+func (t *PdfReaderAdapter) GetCover(path string) (*model.Image, error) {
+	return nil, nil
+}
+
+func (t *PdfReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	return nil, errImageNotFound
+}
+
+func (t *PdfReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	doc, err := t.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bookInfo := &model.BookInfo{}
+	if info := doc.dict(doc.trailer["Info"]); info != nil {
+		text := func(key pdfName) string {
+			if s, ok := doc.resolve(info[key]).(pdfString); ok {
+				return strings.TrimSpace(pdfTextString(s))
+			}
+			return ""
+		}
+
+		bookInfo.Title = text("Title")
+		setAuthors(bookInfo, authorsOf(splitNames(text("Author"))))
+		bookInfo.Annotation = text("Subject")
+	}
+
+	// the XMP metadata is the only place for most fields and fills in those
+	// the document information lacks
+	if stream, ok := doc.resolve(doc.catalog()["Metadata"]).(*pdfStream); ok {
+		if data, err := doc.decodeStream(stream); err == nil {
+			xmp := t.readXmp(data)
+			if bookInfo.Title == "" {
+				bookInfo.Title = xmp.Title
+			}
+			if bookInfo.Author == "" {
+				setAuthors(bookInfo, xmp.Authors)
+			}
+			if bookInfo.Annotation == "" {
+				bookInfo.Annotation = xmp.Annotation
+			}
+			bookInfo.Genres = xmp.Genres
+			bookInfo.Language = xmp.Language
+			bookInfo.Publisher = xmp.Publisher
+			bookInfo.PublishDate = xmp.PublishDate
+			bookInfo.Identifiers = xmp.Identifiers
+		}
+	}
+
+	return bookInfo, nil
+}
+
+// pages returns the pages in reading order and the index of every page by
+// its object number, which is how outline destinations refer to pages.
+func (t *PdfReaderAdapter) pages(doc *pdfDocument) ([]pdfDict, map[int]int) {
+	var pages []pdfDict
+	numbers := map[int]int{}
+	visited := map[int]bool{}
+
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+
+		dict := doc.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+
+		if res, ok := dict["Resources"]; ok {
+			resources = res
+		}
+
+		kids, ok := doc.resolve(dict["Kids"]).(pdfArray)
+		if !ok || dict["Type"] == pdfName("Page") {
+			page := pdfDict{}
+			for k, v := range dict {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			if ref, ok := node.(pdfRef); ok {
+				numbers[ref.num] = len(pages)
+			}
+			pages = append(pages, page)
+			return
+		}
+
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	walk(doc.catalog()["Pages"], nil, 0)
+
+	return pages, numbers
+}
+
+func (t *PdfReaderAdapter) outlineItems(doc *pdfDocument, first any) []pdfDict {
+	var items []pdfDict
+	visited := map[int]bool{}
+
+	for node := first; node != nil; {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				break
+			}
+			visited[ref.num] = true
+		}
+
+		item := doc.dict(node)
+		if item == nil {
+			break
+		}
+
+		items = append(items, item)
+		node = item["Next"]
+	}
+
+	return items
+}
+
+// readXmp reads the Dublin Core properties of XMP metadata, which hold their
+// values in rdf:li items, and the identifiers, which are plain values.
+func (t *PdfReaderAdapter) readXmp(data []byte) model.BookInfo {
+	var info model.BookInfo
+	var field string
+	var inItem bool
+	var authors []string
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch elem := tok.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "title", "creator", "description", "subject", "language", "publisher", "date", "identifier", "isbn":
+				field = elem.Name.Local
+			case "li":
+				inItem = field != ""
+			}
+		case xml.EndElement:
+			switch elem.Name.Local {
+			case "title", "creator", "description", "subject", "language", "publisher", "date", "identifier", "isbn":
+				field = ""
+			case "li":
+				inItem = false
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(elem))
+			if text == "" {
+				continue
+			}
+
+			switch field {
+			case "identifier":
+				info.Identifiers = addIdentifier(info.Identifiers, "", text)
+				continue
+			case "isbn":
+				info.Identifiers = addIdentifier(info.Identifiers, "ISBN", text)
+				continue
+			}
+
+			if !inItem {
+				continue
+			}
+
+			switch field {
+			case "title":
+				if info.Title == "" {
+					info.Title = text
+				}
+			case "creator":
+				authors = append(authors, text)
+			case "description":
+				if info.Annotation == "" {
+					info.Annotation = text
+				}
+			case "subject":
+				info.Genres = addUnique(info.Genres, text)
+			case "language":
+				if info.Language == "" {
+					info.Language = text
+				}
+			case "publisher":
+				if info.Publisher == "" {
+					info.Publisher = text
+				}
+			case "date":
+				if info.PublishDate == "" {
+					info.PublishDate = text
+				}
+			}
+		}
+	}
+
+	setAuthors(&info, authorsOf(authors))
+
+	return info
+}
@@ -0,0 +1,901 @@
+package reader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+type pdfName string
+
+type pdfKeyword string
+
+type pdfString []byte
+
+type pdfArray []any
+
+type pdfDict map[pdfName]any
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfXrefEntry struct {
+	offset     int64
+	stream     int
+	index      int
+	compressed bool
+}
+
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]pdfXrefEntry
+	trailer pdfDict
+	objects map[int]any
+	loading map[int]bool
+	// maxStreamSize bounds what a stream may decode to
+	maxStreamSize int64
+}
+
+var errPdfEOF = errors.New("unexpected end of pdf data")
+
+var errPdfStreamTooLarge = errors.New("pdf stream is too large")
+
+var pdfObjHeader = regexp.MustCompile(`(?m)(\d+)\s+(\d+)\s+obj\b`)
+
+// openPdf reads the pdf file. No stream of it is decoded to more than
+// maxStreamSize bytes, which is all a few bytes of a deflated stream can
+// otherwise take.
+func openPdf(path string, maxStreamSize int64) (*pdfDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a pdf file")
+	}
+
+	doc := &pdfDocument{
+		data:    data,
+		xref:    map[int]pdfXrefEntry{},
+		objects: map[int]any{},
+		loading: map[int]bool{},
+
+		maxStreamSize: maxStreamSize,
+	}
+
+	if err := doc.loadXref(); err != nil || doc.trailer["Root"] == nil {
+		doc.xref = map[int]pdfXrefEntry{}
+		doc.objects = map[int]any{}
+		if err := doc.rebuildXref(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, fmt.Errorf("encrypted pdf files are not supported")
+	}
+
+	return doc, nil
+}
+
+func (d *pdfDocument) loadXref() error {
+	idx := bytes.LastIndex(d.data, []byte("startxref"))
+	if idx < 0 {
+		return fmt.Errorf("startxref not found")
+	}
+
+	l := &pdfLexer{data: d.data, pos: idx + len("startxref")}
+	tok, err := l.readToken()
+	if err != nil {
+		return err
+	}
+	offset, ok := tok.(int64)
+	if !ok {
+		return fmt.Errorf("invalid startxref")
+	}
+
+	visited := map[int64]bool{}
+	for offset > 0 && !visited[offset] {
+		visited[offset] = true
+		if offset >= int64(len(d.data)) {
+			return fmt.Errorf("xref offset out of range")
+		}
+
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+
+		if stm, ok := trailer["XRefStm"].(int64); ok && !visited[stm] {
+			visited[stm] = true
+			if _, err := d.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+
+		prev, _ := trailer["Prev"].(int64)
+		offset = prev
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) readXrefSection(offset int64) (pdfDict, error) {
+	l := &pdfLexer{data: d.data, pos: int(offset)}
+	l.skipSpace()
+	if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		return d.readXrefTable(l)
+	}
+
+	_, obj, err := d.readIndirect(l)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := obj.(*pdfStream)
+	if !ok {
+		return nil, fmt.Errorf("invalid xref stream")
+	}
+
+	return stream.dict, d.readXrefStream(stream)
+}
+
+func (d *pdfDocument) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		tok, err := l.readToken()
+		if err != nil {
+			return nil, err
+		}
+
+		if kw, ok := tok.(pdfKeyword); ok && kw == "trailer" {
+			obj, err := l.readObject()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("invalid trailer")
+			}
+			return trailer, nil
+		}
+
+		start, ok := tok.(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid xref subsection")
+		}
+		tok, err = l.readToken()
+		if err != nil {
+			return nil, err
+		}
+		count, ok := tok.(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid xref subsection")
+		}
+
+		for i := int64(0); i < count; i++ {
+			offTok, _ := l.readToken()
+			l.readToken()
+			kindTok, err := l.readToken()
+			if err != nil {
+				return nil, err
+			}
+
+			off, _ := offTok.(int64)
+			num := int(start + i)
+			if kind, _ := kindTok.(pdfKeyword); kind == "n" {
+				if _, exists := d.xref[num]; !exists {
+					d.xref[num] = pdfXrefEntry{offset: off}
+				}
+			}
+		}
+	}
+}
+
+func (d *pdfDocument) readXrefStream(stream *pdfStream) error {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return err
+	}
+
+	widths, _ := stream.dict["W"].(pdfArray)
+	if len(widths) != 3 {
+		return fmt.Errorf("invalid xref stream widths")
+	}
+	var w [3]int
+	for i := range w {
+		v, _ := widths[i].(int64)
+		w[i] = int(v)
+	}
+
+	size, _ := stream.dict["Size"].(int64)
+	index := pdfArray{int64(0), size}
+	if idx, ok := stream.dict["Index"].(pdfArray); ok {
+		index = idx
+	}
+
+	rowLen := w[0] + w[1] + w[2]
+	if rowLen == 0 {
+		return fmt.Errorf("invalid xref stream widths")
+	}
+
+	field := func(row []byte, from, width int, def int64) int64 {
+		if width == 0 {
+			return def
+		}
+		var v int64
+		for _, b := range row[from : from+width] {
+			v = v<<8 | int64(b)
+		}
+		return v
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for j := int64(0); j < count && pos+rowLen <= len(data); j++ {
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+
+			num := int(start + j)
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+
+			switch field(row, 0, w[0], 1) {
+			case 1:
+				d.xref[num] = pdfXrefEntry{offset: field(row, w[0], w[1], 0)}
+			case 2:
+				d.xref[num] = pdfXrefEntry{
+					stream:     int(field(row, w[0], w[1], 0)),
+					index:      int(field(row, w[0]+w[1], w[2], 0)),
+					compressed: true,
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// rebuildXref scans the whole file for object headers. It is used when the
+// cross-reference data is missing or damaged, which is common for PDFs
+// produced by careless generators.
+func (d *pdfDocument) rebuildXref() error {
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, err := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		d.xref[num] = pdfXrefEntry{offset: int64(m[0])}
+	}
+
+	if d.trailer == nil {
+		d.trailer = pdfDict{}
+	}
+
+	if idx := bytes.LastIndex(d.data, []byte("trailer")); idx >= 0 {
+		l := &pdfLexer{data: d.data, pos: idx + len("trailer")}
+		if obj, err := l.readObject(); err == nil {
+			if trailer, ok := obj.(pdfDict); ok {
+				for k, v := range trailer {
+					d.trailer[k] = v
+				}
+			}
+		}
+	}
+
+	if d.trailer["Root"] != nil {
+		return nil
+	}
+
+	for num := range d.xref {
+		if dict, ok := d.get(num).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			d.trailer["Root"] = pdfRef{num: num}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pdf catalog not found")
+}
+
+func (d *pdfDocument) readIndirect(l *pdfLexer) (int, any, error) {
+	numTok, err := l.readToken()
+	if err != nil {
+		return 0, nil, err
+	}
+	l.readToken()
+	kw, err := l.readToken()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	num, ok := numTok.(int64)
+	if !ok || kw != pdfKeyword("obj") {
+		return 0, nil, fmt.Errorf("invalid object header")
+	}
+
+	obj, err := l.readObject()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return int(num), obj, nil
+	}
+
+	save := l.pos
+	tok, err := l.readToken()
+	if err != nil || tok != pdfKeyword("stream") {
+		l.pos = save
+		return int(num), obj, nil
+	}
+
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	start := l.pos
+	end := -1
+	if length, ok := d.resolve(dict["Length"]).(int64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		rest := bytes.TrimLeft(l.data[start+int(length):min(len(l.data), start+int(length)+32)], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = start + int(length)
+		}
+	}
+	if end < 0 {
+		idx := bytes.Index(l.data[start:], []byte("endstream"))
+		if idx < 0 {
+			return 0, nil, fmt.Errorf("unterminated stream")
+		}
+		end = start + idx
+	}
+
+	l.pos = end
+	return int(num), &pdfStream{dict: dict, raw: l.data[start:end]}, nil
+}
+
+func (d *pdfDocument) get(num int) any {
+	if obj, ok := d.objects[num]; ok {
+		return obj
+	}
+
+	entry, ok := d.xref[num]
+	if !ok || d.loading[num] {
+		return nil
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	var obj any
+	if entry.compressed {
+		obj = d.getCompressed(entry)
+	} else if entry.offset >= 0 && entry.offset < int64(len(d.data)) {
+		l := &pdfLexer{data: d.data, pos: int(entry.offset)}
+		if _, val, err := d.readIndirect(l); err == nil {
+			obj = val
+		}
+	}
+
+	d.objects[num] = obj
+	return obj
+}
+
+func (d *pdfDocument) getCompressed(entry pdfXrefEntry) any {
+	stream, ok := d.get(entry.stream).(*pdfStream)
+	if !ok {
+		return nil
+	}
+
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+
+	n, _ := d.resolve(stream.dict["N"]).(int64)
+	first, _ := d.resolve(stream.dict["First"]).(int64)
+	if entry.index >= int(n) {
+		return nil
+	}
+
+	l := &pdfLexer{data: data}
+	var offset int64
+	for i := 0; i <= entry.index; i++ {
+		l.readToken()
+		tok, err := l.readToken()
+		if err != nil {
+			return nil
+		}
+		offset, _ = tok.(int64)
+	}
+
+	if int(first+offset) >= len(data) {
+		return nil
+	}
+
+	l.pos = int(first + offset)
+	obj, err := l.readObject()
+	if err != nil {
+		return nil
+	}
+
+	return obj
+}
+
+func (d *pdfDocument) resolve(v any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.get(ref.num)
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) dict(v any) pdfDict {
+	switch val := d.resolve(v).(type) {
+	case pdfDict:
+		return val
+	case *pdfStream:
+		return val.dict
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) catalog() pdfDict {
+	return d.dict(d.trailer["Root"])
+}
+
+func (d *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	data := stream.raw
+
+	var filters []pdfName
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []pdfName{f}
+	case pdfArray:
+		for _, v := range f {
+			if name, ok := d.resolve(v).(pdfName); ok {
+				filters = append(filters, name)
+			}
+		}
+	}
+
+	var params []pdfDict
+	switch p := d.resolve(stream.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = []pdfDict{p}
+	case pdfArray:
+		for _, v := range p {
+			params = append(params, d.dict(v))
+		}
+	}
+
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = params[i]
+		}
+
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = pdfInflate(data, d.maxStreamSize)
+			if err == nil {
+				data, err = pdfPredict(data, param)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = pdfHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = pdfASCII85Decode(data)
+		default:
+			return nil, fmt.Errorf("unsupported pdf filter: %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// pdfInflate inflates the data to at most limit bytes. Data that goes on
+// past that is an error rather than cut short.
+func pdfInflate(data []byte, limit int64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(out)) > limit {
+		return nil, errPdfStreamTooLarge
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func pdfPredict(data []byte, param pdfDict) ([]byte, error) {
+	predictor, _ := param["Predictor"].(int64)
+	if predictor < 10 {
+		return data, nil
+	}
+
+	colors, columns, bpc := int64(1), int64(1), int64(8)
+	if v, ok := param["Colors"].(int64); ok {
+		colors = v
+	}
+	if v, ok := param["Columns"].(int64); ok {
+		columns = v
+	}
+	if v, ok := param["BitsPerComponent"].(int64); ok {
+		bpc = v
+	}
+
+	bpp := int(max(1, colors*bpc/8))
+	rowLen := int((colors*bpc*columns + 7) / 8)
+	if rowLen <= 0 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	var out []byte
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		kind := data[pos]
+		row := append([]byte{}, data[pos+1:pos+1+rowLen]...)
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func pdfHexDecode(data []byte) ([]byte, error) {
+	var clean []byte
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if isHexDigit(b) {
+			clean = append(clean, b)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+
+	return hex.DecodeString(string(clean))
+}
+
+func pdfASCII85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+
+	out := make([]byte, len(data)*4/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[:n], nil
+}
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPdfSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\f' || b == 0
+}
+
+func isPdfDelimiter(b byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isPdfSpace(b) {
+			l.pos++
+			continue
+		}
+		if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *pdfLexer) readToken() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPdfEOF
+	}
+
+	b := l.data[l.pos]
+	switch {
+	case b == '(':
+		l.pos++
+		return l.readLiteralString(), nil
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] != '>' {
+			l.pos++
+		}
+		raw := l.data[start:l.pos]
+		l.pos++
+		decoded, _ := pdfHexDecode(raw)
+		return pdfString(decoded), nil
+	case b == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return pdfKeyword(">"), nil
+	case b == '[' || b == ']' || b == '{' || b == '}':
+		l.pos++
+		return pdfKeyword(string(b)), nil
+	case b == '/':
+		l.pos++
+		return l.readName(), nil
+	case b == ')':
+		l.pos++
+		return pdfKeyword(")"), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if c := word[0]; c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) readName() pdfName {
+	var name []byte
+	for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+		b := l.data[l.pos]
+		if b == '#' && l.pos+2 < len(l.data) && isHexDigit(l.data[l.pos+1]) && isHexDigit(l.data[l.pos+2]) {
+			v, _ := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			name = append(name, byte(v))
+			l.pos += 3
+			continue
+		}
+		name = append(name, b)
+		l.pos++
+	}
+
+	return pdfName(name)
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	var out []byte
+	depth := 1
+
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
+
+func (l *pdfLexer) readObject() (any, error) {
+	tok, err := l.readToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.buildObject(tok)
+}
+
+func (l *pdfLexer) buildObject(tok any) (any, error) {
+	switch v := tok.(type) {
+	case pdfKeyword:
+		switch v {
+		case "[":
+			var arr pdfArray
+			for {
+				next, err := l.readToken()
+				if err != nil {
+					return nil, err
+				}
+				if next == pdfKeyword("]") {
+					return arr, nil
+				}
+				obj, err := l.buildObject(next)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, obj)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				next, err := l.readToken()
+				if err != nil {
+					return nil, err
+				}
+				if next == pdfKeyword(">>") {
+					return dict, nil
+				}
+				key, ok := next.(pdfName)
+				if !ok {
+					continue
+				}
+				obj, err := l.readObject()
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = obj
+			}
+		}
+		return v, nil
+	case int64:
+		save := l.pos
+		gen, err := l.readToken()
+		if g, ok := gen.(int64); err == nil && ok {
+			kw, err := l.readToken()
+			if err == nil && kw == pdfKeyword("R") {
+				return pdfRef{num: int(v), gen: int(g)}, nil
+			}
+		}
+		l.pos = save
+		return v, nil
+	}
+
+	return tok, nil
+}
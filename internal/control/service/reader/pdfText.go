@@ -0,0 +1,537 @@
+package reader
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/charmap"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var pdfGlyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_',
+	"grave": '`', "braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"quotesinglbase": '‚', "quotedblbase": '„', "endash": '–', "emdash": '—',
+	"bullet": '•', "ellipsis": '…', "dotlessi": 'ı', "copyright": '©', "registered": '®',
+	"trademark": '™', "degree": '°', "section": '§', "paragraph": '¶',
+	"guillemotleft": '«', "guillemotright": '»', "nbspace": ' ', "minus": '−',
+}
+
+var pdfLigatures = map[string]string{
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+}
+
+type pdfFont struct {
+	cmap     map[string]string
+	codeLens []int
+	twoByte  bool
+	encoding map[byte]string
+	decoder  *charmap.Charmap
+}
+
+func (f *pdfFont) decode(s []byte) string {
+	if f == nil {
+		return string(s)
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range f.codeLens {
+			if i+n > len(s) {
+				continue
+			}
+			if dst, ok := f.cmap[string(s[i:i+n])]; ok {
+				out.WriteString(dst)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		if f.twoByte {
+			i += 2
+			continue
+		}
+
+		b := s[i]
+		i++
+		if dst, ok := f.encoding[b]; ok {
+			out.WriteString(dst)
+			continue
+		}
+		if f.decoder != nil {
+			out.WriteRune(f.decoder.DecodeByte(b))
+			continue
+		}
+		out.WriteByte(b)
+	}
+
+	return out.String()
+}
+
+func (d *pdfDocument) loadFont(v any) *pdfFont {
+	dict := d.dict(v)
+	if dict == nil {
+		return nil
+	}
+
+	font := &pdfFont{
+		cmap:     map[string]string{},
+		encoding: map[byte]string{},
+		decoder:  charmap.Windows1252,
+		twoByte:  dict["Subtype"] == pdfName("Type0"),
+	}
+
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			font.parseCMap(data)
+		}
+	}
+
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		font.setBaseEncoding(enc)
+	case pdfDict:
+		if base, ok := enc["BaseEncoding"].(pdfName); ok {
+			font.setBaseEncoding(base)
+		}
+		if diffs, ok := d.resolve(enc["Differences"]).(pdfArray); ok {
+			code := 0
+			for _, item := range diffs {
+				switch val := item.(type) {
+				case int64:
+					code = int(val)
+				case pdfName:
+					if code >= 0 && code < 256 {
+						if r, ok := pdfGlyphToString(string(val)); ok {
+							font.encoding[byte(code)] = r
+						}
+					}
+					code++
+				}
+			}
+		}
+	}
+
+	if len(font.codeLens) == 0 {
+		if font.twoByte {
+			font.codeLens = []int{2}
+		} else {
+			font.codeLens = []int{1}
+		}
+	}
+
+	return font
+}
+
+func (f *pdfFont) setBaseEncoding(name pdfName) {
+	switch name {
+	case "MacRomanEncoding":
+		f.decoder = charmap.Macintosh
+	case "WinAnsiEncoding", "StandardEncoding", "PDFDocEncoding":
+		f.decoder = charmap.Windows1252
+	}
+}
+
+func pdfGlyphToString(name string) (string, bool) {
+	if r, ok := pdfGlyphNames[name]; ok {
+		return string(r), true
+	}
+	if s, ok := pdfLigatures[name]; ok {
+		return s, true
+	}
+	if len(name) == 1 {
+		return name, true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+
+	return "", false
+}
+
+func (f *pdfFont) parseCMap(data []byte) {
+	l := &pdfLexer{data: data}
+	lens := map[int]bool{}
+
+	readString := func() (pdfString, bool) {
+		tok, err := l.readToken()
+		if err != nil {
+			return nil, false
+		}
+		s, ok := tok.(pdfString)
+		return s, ok
+	}
+
+	for {
+		tok, err := l.readToken()
+		if err != nil {
+			break
+		}
+
+		switch tok {
+		case pdfKeyword("begincodespacerange"):
+			for {
+				lo, ok := readString()
+				if !ok {
+					break
+				}
+				readString()
+				lens[len(lo)] = true
+			}
+		case pdfKeyword("beginbfchar"):
+			for {
+				src, ok := readString()
+				if !ok {
+					break
+				}
+				dstTok, err := l.readToken()
+				if err != nil {
+					break
+				}
+				switch dst := dstTok.(type) {
+				case pdfString:
+					f.cmap[string(src)] = pdfUTF16(dst)
+				case pdfName:
+					if s, ok := pdfGlyphToString(string(dst)); ok {
+						f.cmap[string(src)] = s
+					}
+				}
+				lens[len(src)] = true
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				lo, ok := readString()
+				if !ok {
+					break
+				}
+				hi, ok := readString()
+				if !ok || len(hi) != len(lo) {
+					break
+				}
+				obj, err := l.readObject()
+				if err != nil {
+					break
+				}
+				lens[len(lo)] = true
+
+				start, end := pdfCode(lo), pdfCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+
+				for code := start; code <= end; code++ {
+					key := pdfCodeBytes(code, len(lo))
+					switch dst := obj.(type) {
+					case pdfString:
+						units := pdfUTF16Units(dst)
+						if len(units) == 0 {
+							continue
+						}
+						units[len(units)-1] += uint16(code - start)
+						f.cmap[key] = string(utf16.Decode(units))
+					case pdfArray:
+						if i := int(code - start); i < len(dst) {
+							if s, ok := dst[i].(pdfString); ok {
+								f.cmap[key] = pdfUTF16(s)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for n := range lens {
+		f.codeLens = append(f.codeLens, n)
+	}
+	sort.Ints(f.codeLens)
+}
+
+func pdfCode(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func pdfCodeBytes(code uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(code)
+		code >>= 8
+	}
+	return string(b)
+}
+
+func pdfUTF16Units(s []byte) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	if len(s)%2 == 1 {
+		units = append(units, uint16(s[len(s)-1]))
+	}
+	return units
+}
+
+func pdfUTF16(s []byte) string {
+	return string(utf16.Decode(pdfUTF16Units(s)))
+}
+
+// pdfTextString decodes a PDF text string, which is either UTF-16BE with a
+// byte order mark, UTF-8 with a byte order mark or PDFDocEncoding.
+func pdfTextString(s []byte) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF:
+		return pdfUTF16(s[2:])
+	case len(s) >= 3 && s[0] == 0xEF && s[1] == 0xBB && s[2] == 0xBF:
+		return string(s[3:])
+	}
+
+	var out strings.Builder
+	for _, b := range s {
+		out.WriteRune(charmap.Windows1252.DecodeByte(b))
+	}
+	return out.String()
+}
+
+type pdfTextWriter struct {
+	out       strings.Builder
+	line      strings.Builder
+	y         float64
+	hasY      bool
+	fontCache map[int]*pdfFont
+}
+
+func (w *pdfTextWriter) write(s string) {
+	w.line.WriteString(s)
+}
+
+func (w *pdfTextWriter) space() {
+	line := w.line.String()
+	if line != "" && !strings.HasSuffix(line, " ") {
+		w.line.WriteByte(' ')
+	}
+}
+
+func (w *pdfTextWriter) newline() {
+	line := strings.Join(strings.Fields(w.line.String()), " ")
+	w.line.Reset()
+	if line == "" {
+		return
+	}
+	if w.out.Len() > 0 {
+		w.out.WriteByte('\n')
+	}
+	w.out.WriteString(line)
+}
+
+func (w *pdfTextWriter) moveTo(y float64) {
+	if w.hasY && math.Abs(y-w.y) > 1 {
+		w.newline()
+	} else {
+		w.space()
+	}
+	w.y, w.hasY = y, true
+}
+
+func (d *pdfDocument) pageText(page pdfDict, fontCache map[int]*pdfFont) string {
+	var content []byte
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = d.decodeStream(c)
+	case pdfArray:
+		// the parts together are bound by the limit of a single stream
+		for _, part := range c {
+			if stream, ok := d.resolve(part).(*pdfStream); ok {
+				if data, err := d.decodeStream(stream); err == nil {
+					if int64(len(content)+len(data)) > d.maxStreamSize {
+						break
+					}
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	}
+
+	w := &pdfTextWriter{fontCache: fontCache}
+	d.extractText(content, d.dict(page["Resources"]), w, 0)
+	w.newline()
+
+	return w.out.String()
+}
+
+func (d *pdfDocument) extractText(content []byte, resources pdfDict, w *pdfTextWriter, depth int) {
+	if depth > 8 {
+		return
+	}
+
+	fonts := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+
+	var font *pdfFont
+	var operands []any
+
+	l := &pdfLexer{data: content}
+	for {
+		tok, err := l.readToken()
+		if err != nil {
+			return
+		}
+
+		kw, ok := tok.(pdfKeyword)
+		if !ok || kw == "[" || kw == "<<" {
+			obj, err := l.buildObject(tok)
+			if err != nil {
+				return
+			}
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "BT":
+			w.hasY = false
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = d.fontFor(fonts[name], w.fontCache)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				ty := pdfNumber(operands[len(operands)-1])
+				if ty != 0 {
+					w.newline()
+					w.y += ty
+				} else {
+					w.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				w.moveTo(pdfNumber(operands[5]))
+			}
+		case "T*":
+			w.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					w.write(font.decode(s))
+				}
+			}
+		case "'", "\"":
+			w.newline()
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					w.write(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if arr, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, item := range arr {
+						switch v := item.(type) {
+						case pdfString:
+							w.write(font.decode(v))
+						case int64, float64:
+							if pdfNumber(v) < -150 {
+								w.space()
+							}
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					if stream, ok := d.resolve(xobjects[name]).(*pdfStream); ok && stream.dict["Subtype"] == pdfName("Form") {
+						if data, err := d.decodeStream(stream); err == nil {
+							res := d.dict(stream.dict["Resources"])
+							if res == nil {
+								res = resources
+							}
+							d.extractText(data, res, w, depth+1)
+						}
+					}
+				}
+			}
+		case "BI":
+			l.skipInlineImage()
+		}
+
+		operands = operands[:0]
+	}
+}
+
+func (d *pdfDocument) fontFor(v any, cache map[int]*pdfFont) *pdfFont {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return d.loadFont(v)
+	}
+
+	if font, ok := cache[ref.num]; ok {
+		return font
+	}
+
+	font := d.loadFont(ref)
+	cache[ref.num] = font
+	return font
+}
+
+func (l *pdfLexer) skipInlineImage() {
+	for {
+		tok, err := l.readToken()
+		if err != nil {
+			return
+		}
+		if tok == pdfKeyword("ID") {
+			break
+		}
+	}
+
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += idx + 2
+		if idx > 0 && isPdfSpace(l.data[l.pos-3]) && (l.pos >= len(l.data) || isPdfSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func pdfNumber(v any) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
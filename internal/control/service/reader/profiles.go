@@ -0,0 +1,77 @@
+package reader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minPageSize keeps misconfigured profiles from producing a page per word.
+const minPageSize uint = 200
+
+// Profile is a named pagination setting. Pages of a profile aim at PageSize
+// runes and may be up to a quarter shorter or longer to end on a paragraph or
+// sentence boundary.
+type Profile struct {
+	Name     string
+	PageSize uint
+}
+
+// DefaultProfiles are used when no profiles are configured. The first profile
+// is used when a request does not name one, tablet keeps the page size books
+// were paginated with before profiles.
+var DefaultProfiles = []Profile{
+	{Name: "tablet", PageSize: 1500},
+	{Name: "phone", PageSize: 800},
+	{Name: "desktop", PageSize: 2500},
+}
+
+// ParseProfiles reads profiles from a comma separated list of name:size pairs,
+// e.g. "phone:800,desktop:2500". An empty list gives DefaultProfiles.
+func ParseProfiles(s string) ([]Profile, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultProfiles, nil
+	}
+
+	var profiles []Profile
+	seen := map[string]bool{}
+	for _, item := range strings.Split(s, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || !validProfileName(name) {
+			return nil, fmt.Errorf("invalid profile %q", item)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate profile %s", name)
+		}
+		seen[name] = true
+
+		n, err := strconv.ParseUint(strings.TrimSpace(size), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page size of profile %s: %v", name, err)
+		}
+
+		if uint(n) < minPageSize {
+			return nil, fmt.Errorf("page size of profile %s is less than %d", name, minPageSize)
+		}
+
+		profiles = append(profiles, Profile{Name: name, PageSize: uint(n)})
+	}
+
+	return profiles, nil
+}
+
+// validProfileName accepts names that are safe to use in file names.
+func validProfileName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
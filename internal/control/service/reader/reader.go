@@ -3,33 +3,44 @@ package reader
 import (
 	"BookStore/internal/control/model"
 	"BookStore/internal/control/service/cache"
+	"BookStore/internal/control/service/storage"
 	"fmt"
-	"path/filepath"
-	"strings"
-	"unicode"
 )
 
-const PageSize uint = 1500
-
+// ReaderService reads books by their storage keys. Without a storage the
+// keys are paths of local files.
 type ReaderService struct {
 	adapters map[string]BookReader
 	cache    cache.MemoryCacheService
+	storage  storage.Storage
+	limits   Limits
 }
 
 type Option func(*ReaderService)
 
 func NewService(opts ...Option) *ReaderService {
-	s := &ReaderService{
-		adapters: map[string]BookReader{
-			"fb2":  &Fb2ReaderAdapter{},
-			"epub": &EpubReaderAdapter{},
-		},
-	}
+	s := &ReaderService{limits: DefaultLimits}
 
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	// the formats that compress their content within the file unpack no
+	// more than uploads may
+	s.adapters = map[string]BookReader{
+		"fb2":      &Fb2ReaderAdapter{},
+		"epub":     &EpubReaderAdapter{maxEntrySize: s.limits.MaxUncompressedSize},
+		"mobi":     &MobiReaderAdapter{},
+		"azw":      &MobiReaderAdapter{},
+		"azw3":     &MobiReaderAdapter{},
+		"pdf":      &PdfReaderAdapter{maxStreamSize: s.limits.MaxUncompressedSize},
+		"txt":      &TxtReaderAdapter{},
+		"md":       &MarkdownReaderAdapter{},
+		"markdown": &MarkdownReaderAdapter{},
+		"html":     &HtmlReaderAdapter{},
+		"htm":      &HtmlReaderAdapter{},
+	}
+
 	return s
 }
 
@@ -39,14 +50,42 @@ func WithCache(cache cache.MemoryCacheService) Option {
 	}
 }
 
-func (s *ReaderService) getAdapter(path string) (BookReader, error) {
-	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
-	adapter, ok := s.adapters[ext]
+func WithStorage(storage storage.Storage) Option {
+	return func(r *ReaderService) {
+		r.storage = storage
+	}
+}
+
+// WithLimits sets the limits of uploads, which bound what is unpacked from
+// a book. DefaultLimits are used without it.
+func WithLimits(limits Limits) Option {
+	return func(r *ReaderService) {
+		r.limits = limits
+	}
+}
+
+// getAdapter returns the adapter for the book with the given key along with
+// the local file the adapter reads.
+func (s *ReaderService) getAdapter(key string) (BookReader, string, error) {
+	path := key
+	if s.storage != nil {
+		var err error
+		if path, err = s.storage.Fetch(key); err != nil {
+			return nil, "", fmt.Errorf("failed to fetch book: %v", err)
+		}
+	}
+
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	adapter, ok := s.adapters[format]
 	if !ok {
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
+		return nil, "", fmt.Errorf("unsupported file type: %s", format)
 	}
 
-	return adapter, nil
+	return adapter, path, nil
 }
 
 func (s *ReaderService) GetChaptersCount(path string) (uint, error) {
@@ -55,12 +94,12 @@ func (s *ReaderService) GetChaptersCount(path string) (uint, error) {
 		return val.(uint), nil
 	}
 
-	adapter, err := s.getAdapter(path)
+	adapter, file, err := s.getAdapter(path)
 	if err != nil {
 		return 0, err
 	}
 
-	count, err := adapter.GetChaptersCount(path)
+	count, err := adapter.GetChaptersCount(file)
 	if err != nil {
 		return 0, err
 	}
@@ -76,12 +115,12 @@ func (s *ReaderService) Parse(path string) (string, error) {
 		return val.(string), nil
 	}
 
-	adapter, err := s.getAdapter(path)
+	adapter, file, err := s.getAdapter(path)
 	if err != nil {
 		return "", err
 	}
 
-	data, err := adapter.Parse(path)
+	data, err := adapter.Parse(file)
 	if err != nil {
 		return "", err
 	}
@@ -97,12 +136,12 @@ func (s *ReaderService) GetBookInfo(path string) (*model.BookInfo, error) {
 		return val.(*model.BookInfo), nil
 	}
 
-	adapter, err := s.getAdapter(path)
+	adapter, file, err := s.getAdapter(path)
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := adapter.GetBookInfo(path)
+	info, err := adapter.GetBookInfo(file)
 	if err != nil {
 		return nil, err
 	}
@@ -112,26 +151,85 @@ func (s *ReaderService) GetBookInfo(path string) (*model.BookInfo, error) {
 	return info, nil
 }
 
-func CountPages(runes []rune) uint {
-	if len(runes) == 0 {
-		return 0
+func (s *ReaderService) GetToc(path string) ([]*model.Chapter, error) {
+	key := fmt.Sprintf("bookToc:%s", path)
+	if val, ok := s.cache.Get(key); ok {
+		return val.([]*model.Chapter), nil
 	}
 
-	var count uint
-	var pos uint
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
+	}
 
-	for pos < uint(len(runes)) {
-		end := pos + PageSize
-		if end > uint(len(runes)) {
-			end = uint(len(runes))
-		} else {
-			for end < uint(len(runes)) && !unicode.IsSpace(runes[end]) {
-				end++
-			}
-		}
-		pos = end
-		count++
+	chapters, err := adapter.GetToc(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, chapters)
+
+	return chapters, nil
+}
+
+func (s *ReaderService) ParseBlocks(path string) ([]*model.Block, error) {
+	key := fmt.Sprintf("bookBlocks:%s", path)
+	if val, ok := s.cache.Get(key); ok {
+		return val.([]*model.Block), nil
+	}
+
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := adapter.ParseBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, blocks)
+
+	return blocks, nil
+}
+
+func (s *ReaderService) GetNotes(path string) ([]*model.Note, error) {
+	key := fmt.Sprintf("bookNotes:%s", path)
+	if val, ok := s.cache.Get(key); ok {
+		return val.([]*model.Note), nil
+	}
+
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := adapter.GetNotes(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, notes)
+
+	return notes, nil
+}
+
+// GetCover returns the cover image of a book or nil when it has none.
+// Images are not cached as they are only read when thumbnails are made.
+func (s *ReaderService) GetCover(path string) (*model.Image, error) {
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter.GetCover(file)
+}
+
+func (s *ReaderService) GetImage(path string, name string) (*model.Image, error) {
+	adapter, file, err := s.getAdapter(path)
+	if err != nil {
+		return nil, err
 	}
 
-	return count
+	return adapter.GetImage(file, name)
 }
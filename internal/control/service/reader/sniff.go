@@ -0,0 +1,137 @@
+package reader
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const FormatZip = "zip"
+
+var (
+	fb2RootPattern  = regexp.MustCompile(`<([\w-]+:)?FictionBook[\s>]`)
+	htmlRootPattern = regexp.MustCompile(`(?i)<(!doctype\s+html|html|head|body)[\s>]`)
+)
+
+var textFormats = map[string]bool{
+	"txt":      true,
+	"md":       true,
+	"markdown": true,
+}
+
+// DetectFormat identifies a book by its content. The file extension is only
+// used as a hint to choose between formats that can not be told apart by
+// content, such as plain text and Markdown or MOBI and AZW3.
+func DetectFormat(path string) (string, error) {
+	hint := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "pdf", nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return detectZip(path)
+	case len(head) >= 68 && (string(head[60:68]) == "BOOKMOBI" || string(head[60:68]) == "TEXtREAd"):
+		if hint == "azw" || hint == "azw3" {
+			return hint, nil
+		}
+		return "mobi", nil
+	}
+
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte{0xEF, 0xBB, 0xBF}), " \t\r\n")
+	if fb2RootPattern.Match(text) {
+		return "fb2", nil
+	}
+
+	if !isText(head) {
+		return "", fmt.Errorf("unsupported file format")
+	}
+
+	if htmlRootPattern.Match(text) {
+		return "html", nil
+	}
+
+	if textFormats[hint] {
+		return hint, nil
+	}
+
+	return "txt", nil
+}
+
+func detectZip(path string) (string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open zip: %v", err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		switch f.Name {
+		case "mimetype":
+			rc, err := f.Open()
+			if err != nil {
+				continue
+			}
+			data, _ := io.ReadAll(io.LimitReader(rc, 64))
+			rc.Close()
+
+			if strings.TrimSpace(string(data)) == "application/epub+zip" {
+				return "epub", nil
+			}
+		case "META-INF/container.xml":
+			return "epub", nil
+		}
+	}
+
+	return FormatZip, nil
+}
+
+// minPrintable is the share of printable characters text must have, which
+// allows for a few stray control characters but no binary content.
+const minPrintable = 0.95
+
+// isText reports whether data looks like text rather than binary content:
+// it must decode as UTF-8, UTF-16 with a byte order mark or a legacy encoding
+// the books are read with, and be almost all printable once decoded.
+func isText(data []byte) bool {
+	utf16 := bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF})
+	if !utf16 && bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+
+	// the head of a file may end in the middle of a character
+	if !utf16 {
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+
+	var printable, total int
+	for _, r := range decodeText(data, sniffCharset(data)) {
+		total++
+		if r != utf8.RuneError && (unicode.IsPrint(r) || unicode.IsSpace(r)) {
+			printable++
+		}
+	}
+
+	return total == 0 || float64(printable) >= minPrintable*float64(total)
+}
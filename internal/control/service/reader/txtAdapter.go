@@ -0,0 +1,214 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	chapterPattern = regexp.MustCompile(`(?i)^(chapter|book|part|letter|глава|часть|книга)\s+([0-9]+|[ivxlcdm]+|one|two|three|four|five|six|seven|eight|nine|ten|first|second|third|last|первая|вторая|третья|последняя)([\s.:].*)?$`)
+	romanPattern   = regexp.MustCompile(`^[IVXLCDM]+\.?$`)
+	headerPattern  = regexp.MustCompile(`^(Title|Author|Автор|Название):\s*(.+)$`)
+)
+
+// txtStartMarker ends the header of books converted to TXT.
+const txtStartMarker = "*** START OF THE BOOK ***"
+
+type TxtReaderAdapter struct{}
+
+func (t *TxtReaderAdapter) Parse(path string) (string, error) {
+	paragraphs, _, err := t.read(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+func (t *TxtReaderAdapter) GetChaptersCount(path string) (uint, error) {
+	paragraphs, _, err := t.read(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	for _, p := range paragraphs {
+		if isChapterHeading(p) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (t *TxtReaderAdapter) GetToc(path string) ([]*model.Chapter, error) {
+	paragraphs, _, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []*model.Chapter
+	var offset int
+	for i, p := range paragraphs {
+		if i > 0 {
+			offset += 2
+		}
+		if isChapterHeading(p) {
+			chapters = append(chapters, &model.Chapter{
+				Title:  p,
+				Level:  1,
+				Offset: uint(offset),
+			})
+		}
+		offset += len(p)
+	}
+	toRuneOffsets(strings.Join(paragraphs, "\n\n"), chapters)
+
+	return chapters, nil
+}
+
+func (t *TxtReaderAdapter) ParseBlocks(path string) ([]*model.Block, error) {
+	paragraphs, _, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*model.Block, 0, len(paragraphs))
+	for _, p := range paragraphs {
+		if isChapterHeading(p) {
+			block := textBlock(model.BlockHeading, p)
+			block.Level = 1
+			blocks = append(blocks, block)
+			continue
+		}
+		blocks = append(blocks, textBlock(model.BlockParagraph, p))
+	}
+
+	return blocks, nil
+}
+
+func (t *TxtReaderAdapter) GetNotes(path string) ([]*model.Note, error) {
+	return nil, nil
+}
+
+func (t *TxtReaderAdapter) GetCover(path string) (*model.Image, error) {
+	return nil, nil
+}
+
+func (t *TxtReaderAdapter) GetImage(path string, name string) (*model.Image, error) {
+	return nil, errImageNotFound
+}
+
+func (t *TxtReaderAdapter) GetBookInfo(path string) (*model.BookInfo, error) {
+	paragraphs, header, err := t.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bookInfo := &model.BookInfo{}
+	for _, line := range header {
+		m := headerPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		switch m[1] {
+		case "Title", "Название":
+			if bookInfo.Title == "" {
+				bookInfo.Title = m[2]
+			}
+		case "Author", "Автор":
+			if bookInfo.Author == "" {
+				setAuthors(bookInfo, authorsOf(splitNames(m[2])))
+			}
+		}
+	}
+
+	if bookInfo.Title == "" {
+		for _, p := range paragraphs {
+			if utf8.RuneCountInString(p) <= 120 && !isChapterHeading(p) {
+				bookInfo.Title = p
+				break
+			}
+		}
+	}
+
+	return bookInfo, nil
+}
+
+// read returns the paragraphs of a text file together with the lines that
+// precede a Project Gutenberg "*** START OF" marker, which hold the metadata.
+func (t *TxtReaderAdapter) read(path string) ([]string, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	text := decodeText(data, "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+
+	header := lines[:min(len(lines), 100)]
+	for i, line := range lines {
+		if strings.HasPrefix(line, "*** START OF") {
+			header = lines[:i]
+			lines = lines[i+1:]
+			break
+		}
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, "*** END OF") {
+			lines = lines[:i]
+			break
+		}
+	}
+
+	var blank int
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			blank++
+		}
+	}
+	lineParagraphs := blank < len(lines)/10
+
+	var paragraphs []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, " "))
+			current = nil
+		}
+	}
+
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		switch {
+		case line == "":
+			flush()
+		case isChapterHeading(line):
+			flush()
+			current = append(current, line)
+			flush()
+		default:
+			current = append(current, line)
+			if lineParagraphs {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return paragraphs, header, nil
+}
+
+func isChapterHeading(line string) bool {
+	if utf8.RuneCountInString(line) > 80 {
+		return false
+	}
+
+	return chapterPattern.MatchString(line) || romanPattern.MatchString(line)
+}
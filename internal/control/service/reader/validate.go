@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Validation error codes.
+const (
+	CodeFileTooLarge    = "file_too_large"
+	CodeEmptyFile       = "empty_file"
+	CodeInvalidArchive  = "invalid_archive"
+	CodeTooManyEntries  = "too_many_entries"
+	CodeArchiveTooLarge = "archive_too_large"
+	CodeUnsafeEntryName = "unsafe_entry_name"
+	CodeInvalidUrl      = "invalid_url"
+)
+
+// Limits bound what an upload may contain. Sizes are in bytes.
+type Limits struct {
+	MaxFileSize         int64
+	MaxUncompressedSize int64
+	MaxEntries          int
+}
+
+var DefaultLimits = Limits{
+	MaxFileSize:         100 << 20,
+	MaxUncompressedSize: 512 << 20,
+	MaxEntries:          10000,
+}
+
+// ValidationError tells why an upload was turned down. Entry is the archive
+// entry at fault, if any.
+type ValidationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Entry   string `json:"entry,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Entry != "" {
+		return fmt.Sprintf("%s: %s", e.Message, e.Entry)
+	}
+	return e.Message
+}
+
+// ValidateUpload checks an uploaded file against the limits before anything
+// reads it. Zip archives, EPUB included, are checked by their directory:
+// the number of entries, their names and the size they unpack to, which
+// the zip reader does not let an entry exceed.
+func ValidateUpload(path string, limits Limits) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		return &ValidationError{Code: CodeEmptyFile, Message: "file is empty"}
+	}
+
+	if info.Size() > limits.MaxFileSize {
+		return &ValidationError{
+			Code:    CodeFileTooLarge,
+			Message: fmt.Sprintf("file is larger than %d bytes", limits.MaxFileSize),
+		}
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(f, head); err != nil || !bytes.Equal(head, []byte("PK\x03\x04")) {
+		return nil
+	}
+
+	r, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return &ValidationError{Code: CodeInvalidArchive, Message: fmt.Sprintf("invalid zip archive: %v", err)}
+	}
+
+	return validateArchive(r, limits)
+}
+
+func validateArchive(r *zip.Reader, limits Limits) error {
+	if len(r.File) > limits.MaxEntries {
+		return &ValidationError{
+			Code:    CodeTooManyEntries,
+			Message: fmt.Sprintf("archive has more than %d entries", limits.MaxEntries),
+		}
+	}
+
+	var size uint64
+	for _, f := range r.File {
+		if !safeEntryName(f.Name) {
+			return &ValidationError{Code: CodeUnsafeEntryName, Message: "unsafe archive entry name", Entry: f.Name}
+		}
+
+		size += f.UncompressedSize64
+		if size > uint64(limits.MaxUncompressedSize) {
+			return &ValidationError{
+				Code:    CodeArchiveTooLarge,
+				Message: fmt.Sprintf("archive unpacks to more than %d bytes", limits.MaxUncompressedSize),
+				Entry:   f.Name,
+			}
+		}
+	}
+
+	return nil
+}
+
+// safeEntryName rejects names that would leave the directory the archive
+// is unpacked to.
+func safeEntryName(name string) bool {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return false
+	}
+
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return false
+	}
+
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		if part == ".." {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,247 @@
+package reader
+
+import (
+	"BookStore/internal/control/model"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// MetadataWriter is implemented by the adapters of formats whose metadata
+// can be written back into the file.
+type MetadataWriter interface {
+	WriteMetadata(path string, w io.Writer, info *model.BookInfo, cover *model.Image) error
+}
+
+// WritesMetadata reports whether the metadata of books of the format can be
+// written back into their files.
+func (s *ReaderService) WritesMetadata(format string) bool {
+	_, ok := s.adapters[format].(MetadataWriter)
+	return ok
+}
+
+// Export writes the book with the given key to w with the metadata in info,
+// adding the cover if the book has none. The file itself is not changed, and
+// books of formats the metadata can not be written to are copied as they are.
+func (s *ReaderService) Export(key string, w io.Writer, info *model.BookInfo, cover *model.Image) error {
+	adapter, file, err := s.getAdapter(key)
+	if err != nil {
+		return err
+	}
+
+	if writer, ok := adapter.(MetadataWriter); ok {
+		return writer.WriteMetadata(file, w, info, cover)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// xmlElement is an element of a document with the offsets of its markup,
+// from the start of its start tag to the end of its end tag, and its text.
+type xmlElement struct {
+	xml.StartElement
+	start, end int
+	text       string
+}
+
+func (e *xmlElement) attr(name string) string {
+	for _, attr := range e.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+func (e *xmlElement) markup(doc []byte) string {
+	return string(doc[e.start:e.end])
+}
+
+// rawName returns the name of the element as the document writes it, with
+// its prefix.
+func (e *xmlElement) rawName(doc []byte) string {
+	tag := doc[e.start+1 : e.end]
+	if end := bytes.IndexAny(tag, " \t\r\n/>"); end >= 0 {
+		tag = tag[:end]
+	}
+
+	return string(tag)
+}
+
+// xmlParent is an element with the offsets of its content, which runs from
+// open to close, and its child elements.
+type xmlParent struct {
+	xmlElement
+	open, close int
+	children    []*xmlElement
+}
+
+// findXmlElement finds the first element at the path of local names from the
+// root of a UTF-8 document.
+func findXmlElement(doc []byte, path ...string) (*xmlParent, error) {
+	var stack []string
+	var parent *xmlParent
+	var child *xmlElement
+	var text strings.Builder
+
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch elem := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, elem.Name.Local)
+			switch {
+			case parent == nil && slices.Equal(stack, path):
+				parent = &xmlParent{
+					xmlElement: xmlElement{StartElement: elem.Copy(), start: offset},
+					open:       int(dec.InputOffset()),
+				}
+			case parent != nil && child == nil && len(stack) == len(path)+1:
+				child = &xmlElement{StartElement: elem.Copy(), start: offset}
+				text.Reset()
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			switch {
+			case parent == nil:
+			case len(stack) == len(path):
+				child.end, child.text = int(dec.InputOffset()), text.String()
+				parent.children = append(parent.children, child)
+				child = nil
+			case len(stack) == len(path)-1:
+				parent.close, parent.end = offset, int(dec.InputOffset())
+				return parent, nil
+			}
+		case xml.CharData:
+			if child != nil {
+				text.Write(elem)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("element %s not found", strings.Join(path, "/"))
+}
+
+// replaceContent returns the document with the content of parent replaced by
+// the elements, each on a line of its own indented like the children it had.
+// The namespace declarations in decl are added to the start tag of parent.
+func replaceContent(doc []byte, parent *xmlParent, elements []string, decl string) []byte {
+	// without children to go by, the end tag is indented like the start tag
+	indent, trailing := "\n", "\n"
+	line := doc[bytes.LastIndexByte(doc[:parent.start], '\n')+1 : parent.start]
+	if len(bytes.TrimSpace(line)) == 0 {
+		trailing = "\n" + string(line)
+	}
+
+	if len(parent.children) > 0 {
+		if gap := doc[parent.open:parent.children[0].start]; len(bytes.TrimSpace(gap)) == 0 {
+			indent = string(gap)
+			if i := strings.LastIndexByte(indent, '\n'); i >= 0 {
+				indent = "\n" + indent[i+1:]
+			}
+		}
+		if gap := doc[parent.children[len(parent.children)-1].end:parent.close]; len(bytes.TrimSpace(gap)) == 0 {
+			trailing = string(gap)
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(doc[:parent.start])
+
+	tag := string(doc[parent.start:parent.open])
+	empty := strings.HasSuffix(tag, "/>")
+	tag = strings.TrimSuffix(strings.TrimSuffix(tag, ">"), "/")
+	out.WriteString(tag + decl + ">")
+
+	for _, element := range elements {
+		out.WriteString(indent + element)
+	}
+	out.WriteString(trailing)
+
+	if empty {
+		out.WriteString("</" + parent.rawName(doc) + ">")
+		out.Write(doc[parent.open:])
+	} else {
+		out.Write(doc[parent.close:])
+	}
+
+	return out.Bytes()
+}
+
+// xmlPrefix returns the prefix the markup binds to the namespace, or an
+// empty string if it binds none.
+func xmlPrefix(markup []byte, space string) string {
+	pattern := regexp.MustCompile(`xmlns:([\w.-]+)\s*=\s*["']` + regexp.QuoteMeta(space) + `["']`)
+	if m := pattern.FindSubmatch(markup); m != nil {
+		return string(m[1])
+	}
+
+	return ""
+}
+
+// xmlTag returns an element with the text and the attributes, given as
+// pairs of names and values. Attributes with empty values are left out.
+func xmlTag(name, text string, attrs ...string) string {
+	return xmlMarkup(name, escapeXml(text), attrs...)
+}
+
+// xmlMarkup is xmlTag with content that is markup already.
+func xmlMarkup(name, content string, attrs ...string) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			b.WriteString(" " + attrs[i] + `="` + escapeXml(attrs[i+1]) + `"`)
+		}
+	}
+
+	if content == "" {
+		b.WriteString("/>")
+	} else {
+		b.WriteString(">" + content + "</" + name + ">")
+	}
+
+	return b.String()
+}
+
+// escapeXml escapes text for content and attribute values, leaving line
+// breaks as they are.
+func escapeXml(s string) string {
+	return xmlEscaper.Replace(s)
+}
+
+// utf8Xml converts an XML document to UTF-8 and declares it so, which lets
+// its markup be edited at the offsets the decoder reports.
+func utf8Xml(data []byte) []byte {
+	doc := decodeText(data, sniffCharset(data))
+	if strings.HasPrefix(doc, "<?xml") {
+		if end := strings.Index(doc, "?>"); end >= 0 {
+			doc = xmlEncodingPattern.ReplaceAllString(doc[:end], `encoding="utf-8`) + doc[end:]
+		}
+	}
+
+	return []byte(doc)
+}
@@ -5,13 +5,15 @@ import (
 	"BookStore/internal/control/service/books"
 	"BookStore/internal/control/service/cache"
 	"BookStore/internal/control/service/reader"
+	"BookStore/internal/control/service/storage"
 	"BookStore/internal/control/service/users"
 )
 
 type Services struct {
-	Books  books.BookService
-	Auth   auth.AuthService
-	User   users.UserService
-	Reader reader.BookReader
-	Cache  cache.MemoryCacheService
+	Books   books.BookService
+	Auth    auth.AuthService
+	User    users.UserService
+	Reader  reader.BookIngester
+	Cache   cache.MemoryCacheService
+	Storage storage.Storage
 }
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps the files in a directory of the local file system.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage root: %v", err)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage root: %v", err)
+	}
+
+	return &Local{root: root}, nil
+}
+
+func (l *Local) Store(path string) (string, error) {
+	key, err := Key(path)
+	if err != nil {
+		return "", err
+	}
+
+	dest := l.Path(key)
+	if _, err := os.Stat(dest); err == nil {
+		// the same file is stored already
+		os.Remove(path)
+		return key, nil
+	}
+
+	if err := moveFile(path, dest); err != nil {
+		return "", fmt.Errorf("failed to store file: %v", err)
+	}
+
+	return key, nil
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	path, err := l.Fetch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+func (l *Local) Fetch(key string) (string, error) {
+	if legacy(key) {
+		return key, nil
+	}
+
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+
+	return l.Path(key), nil
+}
+
+func (l *Local) Path(key string) string {
+	if legacy(key) {
+		return key
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+func (l *Local) Delete(key string) error {
+	path, err := l.Fetch(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
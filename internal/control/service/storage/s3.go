@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyHash is the SHA-256 of an empty payload.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Timeout bounds a request to the service, which is long enough to upload
+// the largest books over a slow link.
+const s3Timeout = 10 * time.Minute
+
+type S3Config struct {
+	// Endpoint is the base url of the service, such as https://s3.amazonaws.com
+	// or http://localhost:9000 for MinIO. Buckets are addressed by path.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 keeps the files in a bucket of an S3 compatible service. Books are read
+// from local copies kept in the cache directory, which is only a cache and
+// can be lost.
+type S3 struct {
+	cfg    S3Config
+	cache  *Local
+	client *http.Client
+}
+
+func NewS3(cfg S3Config, cacheDir string) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	cache, err := NewLocal(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{cfg: cfg, cache: cache, client: &http.Client{Timeout: s3Timeout}}, nil
+}
+
+func (s *S3) Store(path string) (string, error) {
+	hash, err := Hash(path)
+	if err != nil {
+		return "", err
+	}
+	key := keyOf(hash, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := s.request(http.MethodPut, key, f, hash)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+
+	resp, err := s.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to store file: %v", err)
+	}
+	resp.Body.Close()
+
+	// the uploaded file is the local copy from now on
+	f.Close()
+	if err := moveFile(path, s.cache.Path(key)); err != nil {
+		return "", fmt.Errorf("failed to cache file: %v", err)
+	}
+
+	return key, nil
+}
+
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	if legacy(key) {
+		return os.Open(key)
+	}
+
+	if f, err := os.Open(s.cache.Path(key)); err == nil {
+		return f, nil
+	}
+
+	return s.get(key)
+}
+
+func (s *S3) Fetch(key string) (string, error) {
+	if legacy(key) {
+		return key, nil
+	}
+
+	path := s.cache.Path(key)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	body, err := s.get(key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	if err := writeFile(path, body); err != nil {
+		return "", fmt.Errorf("failed to fetch file: %v", err)
+	}
+
+	return path, nil
+}
+
+func (s *S3) Path(key string) string {
+	return s.cache.Path(key)
+}
+
+func (s *S3) Delete(key string) error {
+	if legacy(key) {
+		return s.cache.Delete(key)
+	}
+
+	req, err := s.request(http.MethodDelete, key, nil, emptyHash)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	resp.Body.Close()
+
+	return s.cache.Delete(key)
+}
+
+func (s *S3) get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil, emptyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3) request(method, key string, body io.Reader, payloadHash string) (*http.Request, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(s.cfg.Endpoint + "/" + s.cfg.Bucket + "/" + key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object url: %v", err)
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	return req, nil
+}
+
+// do signs and sends the request, turning error responses into errors.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	sign(req, s.cfg, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", os.ErrNotExist, req.URL.Path)
+		}
+		return nil, errors.New(resp.Status + ": " + strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization to the request. The
+// request must have its x-amz-content-sha256 header set.
+func sign(req *http.Request, cfg S3Config, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSha256([]byte("AWS4"+cfg.SecretKey), date)
+	key = hmacSha256(key, cfg.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// escape encodes everything but the unreserved characters of RFC 3986.
+func escape(s string) string {
+	return strings.NewReplacer("+", "%20", "%7E", "~").Replace(url.QueryEscape(s))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps book files under keys made from their content, so the same
+// file always gets the same key and no two files collide. Keys are relative
+// and stay valid when the storage moves to another host or root.
+//
+// Books stored before keys were introduced have their absolute path as the
+// key, which every storage reads from the local file system until the
+// library is reprocessed and moves them into the storage.
+type Storage interface {
+	// Store moves the file at path into the storage and returns its key.
+	Store(path string) (string, error)
+	// Open reads the file of key.
+	Open(key string) (io.ReadCloser, error)
+	// Fetch returns a local file with the content of key, which is Path(key).
+	Fetch(key string) (string, error)
+	// Path is where the local copy of key is. Files made from a book, like
+	// its content and page indexes, are kept next to it.
+	Path(key string) string
+	// Delete removes the file of key.
+	Delete(key string) error
+}
+
+// Key returns the key of the file at path: the SHA-256 of its content with
+// the extension of the file, which the format detection takes as a hint.
+func Key(path string) (string, error) {
+	hash, err := Hash(path)
+	if err != nil {
+		return "", err
+	}
+
+	return keyOf(hash, path), nil
+}
+
+func keyOf(hash, path string) string {
+	// the first byte of the hash spreads the files over directories
+	return hash[:2] + "/" + hash + strings.ToLower(filepath.Ext(path))
+}
+
+// Hash returns the hex encoded SHA-256 of the file at path.
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func legacy(key string) bool {
+	return filepath.IsAbs(key)
+}
+
+// validKey rejects keys that would point outside the storage.
+func validKey(key string) error {
+	if key == "" || strings.Contains(key, "..") || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid storage key: %q", key)
+	}
+
+	return nil
+}
+
+// moveFile renames src to dest, copying it when they are on different file
+// systems.
+func moveFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := writeFile(dest, in); err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
+
+// writeFile writes r to dest through a temporary file, so dest never holds
+// a partial file.
+func writeFile(dest string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %v", err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	return os.Rename(out.Name(), dest)
+}
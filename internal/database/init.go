@@ -2,13 +2,16 @@ package database
 
 import (
 	"BookStore/internal/database/model"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	"os"
+	"strings"
 )
 
 var db *gorm.DB
@@ -34,13 +37,206 @@ func GetDB() *gorm.DB {
 }
 
 func migrate() {
-	if err := db.AutoMigrate(&model.Book{}, &model.User{}, &model.Role{}, &model.ReadingProgress{}); err != nil {
+	if err := db.AutoMigrate(&model.Book{}, &model.User{}, &model.Role{}, &model.ReadingProgress{}, &model.Chapter{}, &model.ImportJob{}, &model.Author{}, &model.Series{}, &model.Genre{}, &model.BookAuthor{}, &model.BookSeries{}, &model.BookEdit{}); err != nil {
 		log.Fatalf("migration failed: %v", err)
 	}
+	if err := migratePages(); err != nil {
+		log.Fatalf("migration of pages failed: %v", err)
+	}
+	if err := migrateCatalogs(); err != nil {
+		log.Fatalf("migration of catalogs failed: %v", err)
+	}
 	initRoles()
 	initAdmin()
 }
 
+// legacyProfile is the default profile, whose page size is the one books
+// were paginated with before profiles.
+const legacyProfile = "tablet"
+
+// migratePages keeps the page counts of books paginated before profiles as
+// the counts of the default profile, and drops the columns of the pages that
+// the page indexes have replaced. The counts of other profiles are made when
+// the books are read.
+func migratePages() error {
+	if !db.Migrator().HasColumn(&model.Book{}, "pages") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE books SET profile_pages = '{"` + legacyProfile + `":' || pages || '}'
+			WHERE pages > 0 AND (profile_pages IS NULL OR profile_pages IN ('', 'null', '{}'))`).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().DropColumn(&model.Book{}, "pages"); err != nil {
+			return err
+		}
+
+		if tx.Migrator().HasColumn(&model.Chapter{}, "page") {
+			return tx.Migrator().DropColumn(&model.Chapter{}, "page")
+		}
+
+		return nil
+	})
+}
+
+// legacyCatalogs are the authors, series and genres of a book as they were
+// kept in columns of the book before the catalogs.
+type legacyCatalogs struct {
+	ID          int
+	Authors     string
+	Series      string
+	SeriesIndex float64
+	Genres      string
+}
+
+// migrateCatalogs links the books to the catalog entries of the authors,
+// series and genres they kept in columns of their own, and drops the
+// columns. Books linked already, by an edit or by being processed again,
+// keep their links.
+func migrateCatalogs() error {
+	if !db.Migrator().HasColumn(&model.Book{}, "series_index") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var books []*legacyCatalogs
+		err := tx.Raw(`SELECT id, coalesce(authors, '') AS authors, coalesce(series, '') AS series,
+			coalesce(series_index, 0) AS series_index, coalesce(genres, '') AS genres FROM books`).Scan(&books).Error
+		if err != nil {
+			return err
+		}
+
+		for _, book := range books {
+			if err := linkLegacyCatalogs(tx, book); err != nil {
+				return fmt.Errorf("book %d: %v", book.ID, err)
+			}
+		}
+
+		for _, column := range []string{"authors", "series", "series_index", "genres"} {
+			if err := tx.Migrator().DropColumn(&model.Book{}, column); err != nil {
+				return err
+			}
+		}
+		log.Printf("catalogs of %d books migrated", len(books))
+
+		return nil
+	})
+}
+
+// linkLegacyCatalogs links the book to its entries, which are added if
+// missing. Names are keyed the way they are when books are added.
+func linkLegacyCatalogs(tx *gorm.DB, book *legacyCatalogs) error {
+	var authors []struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if book.Authors != "" {
+		if err := json.Unmarshal([]byte(book.Authors), &authors); err != nil {
+			return fmt.Errorf("invalid authors: %v", err)
+		}
+	}
+
+	var genres []string
+	if book.Genres != "" {
+		if err := json.Unmarshal([]byte(book.Genres), &genres); err != nil {
+			return fmt.Errorf("invalid genres: %v", err)
+		}
+	}
+
+	var series []string
+	if book.Series != "" {
+		series = []string{book.Series}
+	}
+
+	if linked, err := hasLinks(tx, "book_authors", book.ID); err != nil {
+		return err
+	} else if linked {
+		authors = nil
+	}
+
+	for i, author := range authors {
+		id, ok, err := catalogEntry(tx, model.CatalogAuthors, author.Name)
+		if err != nil || !ok {
+			return err
+		}
+
+		if author.Role == "" {
+			author.Role = model.RoleAuthor
+		}
+		link := &model.BookAuthor{BookID: book.ID, AuthorID: id, Role: author.Role, Position: i}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(link).Error; err != nil {
+			return err
+		}
+	}
+
+	if linked, err := hasLinks(tx, "book_series", book.ID); err != nil {
+		return err
+	} else if linked {
+		series = nil
+	}
+
+	for _, name := range series {
+		id, ok, err := catalogEntry(tx, model.CatalogSeries, name)
+		if err != nil || !ok {
+			return err
+		}
+
+		link := &model.BookSeries{BookID: book.ID, SeriesID: id, Number: book.SeriesIndex}
+		if err := tx.Omit(clause.Associations).Create(link).Error; err != nil {
+			return err
+		}
+	}
+
+	if linked, err := hasLinks(tx, "book_genres", book.ID); err != nil {
+		return err
+	} else if linked {
+		genres = nil
+	}
+
+	for _, name := range genres {
+		id, ok, err := catalogEntry(tx, model.CatalogGenres, name)
+		if err != nil || !ok {
+			return err
+		}
+
+		if err := tx.Exec("INSERT INTO book_genres (book_id, genre_id) VALUES (?, ?) ON CONFLICT DO NOTHING", book.ID, id).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasLinks(tx *gorm.DB, table string, bookId int) (bool, error) {
+	var count int64
+	err := tx.Table(table).Where("book_id = ?", bookId).Count(&count).Error
+	return count > 0, err
+}
+
+// catalogEntry returns the id of the entry of the catalog with the key of
+// the name, adding the entry if there is none. Names with no key have no
+// entry.
+func catalogEntry(tx *gorm.DB, kind, name string) (int, bool, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	key := model.CatalogKey(kind, name)
+	if key == "" {
+		return 0, false, nil
+	}
+
+	// the catalog kinds are the names of their tables
+	err := tx.Exec(fmt.Sprintf("INSERT INTO %s (name, name_key) VALUES (?, ?) ON CONFLICT (name_key) DO NOTHING", kind), name, key).Error
+	if err != nil {
+		return 0, false, err
+	}
+
+	var id int
+	err = tx.Raw(fmt.Sprintf("SELECT id FROM %s WHERE name_key = ?", kind), key).Scan(&id).Error
+	return id, err == nil, err
+}
+
 func initRoles() {
 	roles := []string{"admin", "super", "user"}
 
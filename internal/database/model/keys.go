@@ -0,0 +1,46 @@
+package model
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// NormalizeWords lowercases s and keeps only its letters and digits, with
+// the words separated by single spaces. Accents are dropped, so ё is read
+// as е.
+func NormalizeWords(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// the marks decomposed accented letters leave
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			space = false
+			sb.WriteRune(unicode.ToLower(r))
+		default:
+			space = true
+		}
+	}
+
+	return sb.String()
+}
+
+// CatalogKey normalizes a name of a catalog entry. The words of the name of
+// an author may come in any order, "Tolstoy Leo" is "Leo Tolstoy".
+func CatalogKey(kind, name string) string {
+	key := NormalizeWords(name)
+	if kind == CatalogAuthors {
+		words := strings.Fields(key)
+		sort.Strings(words)
+		key = strings.Join(words, " ")
+	}
+
+	return key
+}
@@ -1,16 +1,132 @@
 package model
 
+import "strings"
+
+// Book is a stored book. Hash is the SHA-256 of the book file, which is the
+// same for every upload of the file; books added before it was kept have it
+// empty until they are processed again. Author is the names of the authors
+// joined for display, Authors links every contributor with their role.
 type Book struct {
-	ID         int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
-	Title      string `json:"title"`
-	Format     string `json:"format"`
-	Annotation string `json:"annotation"`
-	Author     string `json:"author"`
-	Filepath   string `json:"filepath"`
-	Chapters   uint   `json:"chapters"`
-	Pages      uint   `json:"pages"`
-	CreatedAt  int64  `json:"created_at"`
-	UserId     int    `json:"user_id"`
+	ID          int             `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Title       string          `json:"title"`
+	Format      string          `json:"format"`
+	Annotation  string          `json:"annotation"`
+	Author      string          `json:"author"`
+	Authors     []BookAuthor    `json:"authors" gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE"`
+	Translators []string        `json:"translators" gorm:"type:text;serializer:json"`
+	Series      []BookSeries    `json:"series" gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE"`
+	Genres      []Genre         `json:"genres" gorm:"many2many:book_genres;constraint:OnDelete:CASCADE"`
+	Language    string          `json:"language"`
+	Publisher   string          `json:"publisher"`
+	PublishDate string          `json:"publish_date"`
+	Identifiers []Identifier    `json:"identifiers" gorm:"type:text;serializer:json"`
+	Filepath    string          `json:"filepath"`
+	Hash        string          `json:"hash" gorm:"index:idx_books_hash,unique,where:hash <> ''"`
+	Cover       string          `json:"-"`
+	Chapters    uint            `json:"chapters"`
+	Pages       map[string]uint `json:"pages" gorm:"column:profile_pages;type:text;serializer:json"`
+	CreatedAt   int64           `json:"created_at"`
+	UserId      int             `json:"user_id"`
+}
+
+type Identifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+const (
+	CatalogAuthors = "authors"
+	CatalogSeries  = "series"
+	CatalogGenres  = "genres"
+)
+
+// Author, Series and Genre are what books are browsed by. Key is the name
+// normalized, which is the same for every spelling of the name, so books
+// that spell it differently share the entry. Name is the spelling of the
+// first book, until an admin renames it.
+type Author struct {
+	ID   int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name string `json:"name"`
+	Key  string `json:"-" gorm:"column:name_key;uniqueIndex;not null"`
+}
+
+type Series struct {
+	ID   int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name string `json:"name"`
+	Key  string `json:"-" gorm:"column:name_key;uniqueIndex;not null"`
+}
+
+type Genre struct {
+	ID   int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name string `json:"name"`
+	Key  string `json:"-" gorm:"column:name_key;uniqueIndex;not null"`
+}
+
+// BookAuthor links a book to a person with the role they had in it.
+// Position keeps the order the book names them in.
+type BookAuthor struct {
+	BookID   int    `json:"-" gorm:"primaryKey"`
+	AuthorID int    `json:"-" gorm:"primaryKey"`
+	Role     string `json:"role" gorm:"primaryKey"`
+	Position int    `json:"-"`
+	Author   Author `json:"author" gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+}
+
+// RoleAuthor is the role of the people a book is written by.
+const RoleAuthor = "author"
+
+// AuthorNames joins the names of the authors of a book for display, given how
+// to get the name and role of each of its contributors. A book that names no
+// one as author is shown by its other contributors.
+func AuthorNames[T any](contributors []T, nameRole func(T) (string, string)) string {
+	var names, others []string
+	for _, c := range contributors {
+		name, role := nameRole(c)
+		if role == RoleAuthor {
+			names = append(names, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+
+	if len(names) == 0 {
+		names = others
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// BookSeries links a book to a series it is the book Number of, 0 if the
+// book gives no number.
+type BookSeries struct {
+	BookID   int     `json:"-" gorm:"primaryKey"`
+	SeriesID int     `json:"-" gorm:"primaryKey"`
+	Number   float64 `json:"number"`
+	Series   Series  `json:"series" gorm:"foreignKey:SeriesID;constraint:OnDelete:CASCADE"`
+}
+
+// BookEdit is a change of the metadata of a book made by a user. Changes
+// holds the old and new value of every field that changed.
+type BookEdit struct {
+	ID        int           `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	BookID    int           `json:"book_id" gorm:"not null;index"`
+	UserID    int           `json:"user_id"`
+	Changes   []FieldChange `json:"changes" gorm:"type:text;serializer:json"`
+	CreatedAt int64         `json:"created_at"`
+	Book      Book          `json:"-" gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// CatalogEntry is an author, series or genre with the number of its books.
+type CatalogEntry struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Books int    `json:"books"`
 }
 
 type User struct {
@@ -26,12 +142,71 @@ type Role struct {
 	ID       int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
 	RoleName string `json:"role_name" gorm:"unique"`
 }
+
+// ReadingProgress stores the position as a chapter number and an offset from
+// the chapter start, which survive repagination. CurrentPage is the page of
+// that position in the profile the progress is read with. Rows saved before
+// positions were stored hold the page of the old fixed size pagination and
+// have no chapter until they are converted at startup.
 type ReadingProgress struct {
 	ID          int   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
 	UserID      int   `json:"user_id" gorm:"not null"`
 	BookID      int   `json:"book_id" gorm:"not null"`
 	CurrentPage int   `json:"current_page" gorm:"default:1"`
+	Chapter     *int  `json:"chapter"`
+	Offset      uint  `json:"offset"`
 	LastReadAt  int64 `json:"last_read_at"`
 	User        User  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user"`
 	Book        Book  `gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE" json:"book"`
 }
+
+type Chapter struct {
+	ID     int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	BookID int    `json:"book_id" gorm:"not null;index"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Level  int    `json:"level"`
+	Offset uint   `json:"offset"`
+	Page   uint   `json:"page" gorm:"-"`
+	Book   Book   `gorm:"foreignKey:BookID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+const (
+	ImportQueued     = "queued"
+	ImportProcessing = "processing"
+	ImportDone       = "done"
+	ImportFailed     = "failed"
+)
+
+// JobReprocess is the kind of the jobs that reprocess the library. Jobs of
+// no kind import an upload.
+const JobReprocess = "reprocess"
+
+// ImportJob is an upload waiting for or going through ingestion. Path is the
+// file the book is read from, for url imports it is where the download goes.
+// Hash and FileKey are set once the file is moved to the storage and BookID
+// once the job is done. A job that uploaded a file some book already has is
+// done with that book and marked as duplicate. ErrorCode is the code of the
+// validation error a job failed with. Jobs of the reprocess kind process
+// every book of the library again instead, Processed counts the books done
+// and Error tells those that failed.
+type ImportJob struct {
+	ID        int    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	UserID    int    `json:"user_id" gorm:"not null;index"`
+	Kind      string `json:"kind,omitempty"`
+	Url       string `json:"url"`
+	Path      string `json:"-"`
+	FileKey   string `json:"-"`
+	Hash      string `json:"-"`
+	FileName  string `json:"file_name"`
+	Status    string `json:"status" gorm:"index"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"error_code,omitempty"`
+	BookID    *int   `json:"book_id"`
+	Duplicate bool   `json:"duplicate"`
+	Attempts  int    `json:"attempts"`
+	Processed int    `json:"processed,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
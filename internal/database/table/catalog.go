@@ -0,0 +1,382 @@
+package table
+
+import (
+	"BookStore/internal/database"
+	"BookStore/internal/database/model"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// catalog describes how the entries of a catalog are linked to books: the
+// table linking them, its column of entry ids and the other columns that
+// tell one link of a book from another.
+type catalog struct {
+	table  string
+	links  string
+	column string
+	keys   []string
+}
+
+var catalogs = map[string]catalog{
+	model.CatalogAuthors: {table: "authors", links: "book_authors", column: "author_id", keys: []string{"book_id", "role"}},
+	model.CatalogSeries:  {table: "series", links: "book_series", column: "series_id", keys: []string{"book_id"}},
+	model.CatalogGenres:  {table: "genres", links: "book_genres", column: "genre_id", keys: []string{"book_id"}},
+}
+
+func getCatalog(kind string) (catalog, error) {
+	c, ok := catalogs[kind]
+	if !ok {
+		return catalog{}, fmt.Errorf("unknown catalog %q", kind)
+	}
+
+	return c, nil
+}
+
+// withLinks loads the authors, series and genres of books.
+func withLinks(db *gorm.DB) *gorm.DB {
+	return db.Preload("Authors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Authors.Author").Preload("Series.Series").Preload("Genres")
+}
+
+// AddBook saves a new book with its authors, series and genres, adding the
+// entries it is the first book of.
+func AddBook(book *model.Book) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := findEntries(tx, book); err != nil {
+			return err
+		}
+
+		if err := tx.Omit(clause.Associations).Create(book).Error; err != nil {
+			return err
+		}
+
+		return linkBook(tx, book)
+	})
+}
+
+// UpdateBookMetadata saves the metadata of the book and replaces its links.
+func UpdateBookMetadata(book *model.Book) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return updateMetadata(tx, book)
+	})
+}
+
+// UpdateBook saves the title, annotation and metadata of the book edited by
+// a user, replaces its links and adds the edit to its history.
+func UpdateBook(book *model.Book, edit *model.BookEdit) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := updateMetadata(tx, book, "Title", "Annotation"); err != nil {
+			return err
+		}
+
+		return tx.Omit(clause.Associations).Create(edit).Error
+	})
+}
+
+func updateMetadata(tx *gorm.DB, book *model.Book, fields ...any) error {
+	if err := findEntries(tx, book); err != nil {
+		return err
+	}
+
+	fields = append(fields, "Translators", "Language", "Publisher", "PublishDate", "Identifiers")
+	if err := tx.Model(&model.Book{ID: book.ID}).Select("Author", fields...).Updates(book).Error; err != nil {
+		return err
+	}
+
+	return linkBook(tx, book)
+}
+
+// findEntries sets the entries of the links of the book to those with the
+// same keys, which are added if missing, and the author of the book to the
+// names of these entries.
+func findEntries(tx *gorm.DB, book *model.Book) error {
+	for i := range book.Authors {
+		if err := findEntry(tx, &book.Authors[i].Author, book.Authors[i].Author.Key); err != nil {
+			return err
+		}
+		book.Authors[i].AuthorID = book.Authors[i].Author.ID
+	}
+
+	for i := range book.Series {
+		if err := findEntry(tx, &book.Series[i].Series, book.Series[i].Series.Key); err != nil {
+			return err
+		}
+		book.Series[i].SeriesID = book.Series[i].Series.ID
+	}
+
+	for i := range book.Genres {
+		if err := findEntry(tx, &book.Genres[i], book.Genres[i].Key); err != nil {
+			return err
+		}
+	}
+
+	book.Author = authorNames(book.Authors)
+
+	return nil
+}
+
+// findEntry loads the entry with the key into entry, adding entry if there
+// is none. An entry added by another transaction at the same time is found
+// instead of failing on the unique key.
+func findEntry(tx *gorm.DB, entry any, key string) error {
+	err := tx.Where("name_key = ?", key).First(entry).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("name_key = ?", key).First(entry).Error
+}
+
+func linkBook(tx *gorm.DB, book *model.Book) error {
+	if err := tx.Where("book_id = ?", book.ID).Delete(&model.BookAuthor{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("book_id = ?", book.ID).Delete(&model.BookSeries{}).Error; err != nil {
+		return err
+	}
+
+	// names that differ only in spelling have one entry
+	seen := map[string]bool{}
+	var authors []model.BookAuthor
+	for _, link := range book.Authors {
+		key := fmt.Sprintf("%d:%s", link.AuthorID, link.Role)
+		if !seen[key] {
+			seen[key] = true
+			link.BookID = book.ID
+			authors = append(authors, link)
+		}
+	}
+	book.Authors = authors
+
+	var series []model.BookSeries
+	for _, link := range book.Series {
+		key := fmt.Sprintf("series:%d", link.SeriesID)
+		if !seen[key] {
+			seen[key] = true
+			link.BookID = book.ID
+			series = append(series, link)
+		}
+	}
+	book.Series = series
+
+	var genres []model.Genre
+	for _, genre := range book.Genres {
+		key := fmt.Sprintf("genre:%d", genre.ID)
+		if !seen[key] {
+			seen[key] = true
+			genres = append(genres, genre)
+		}
+	}
+	book.Genres = genres
+
+	if len(authors) > 0 {
+		if err := tx.Omit(clause.Associations).Create(&authors).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(series) > 0 {
+		if err := tx.Omit(clause.Associations).Create(&series).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(book).Omit("Genres.*").Association("Genres").Replace(book.Genres)
+}
+
+func authorNames(links []model.BookAuthor) string {
+	return model.AuthorNames(links, func(link model.BookAuthor) (string, string) {
+		return link.Author.Name, link.Role
+	})
+}
+
+// refreshAuthors sets the author of the books again from the names of the
+// entries they are linked to.
+func refreshAuthors(tx *gorm.DB, bookIds []int) error {
+	for _, id := range bookIds {
+		var links []model.BookAuthor
+		if err := tx.Where("book_id = ?", id).Order("position").Preload("Author").Find(&links).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.Book{ID: id}).Update("author", authorNames(links)).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCatalog returns the entries of a catalog that have books, by name.
+func GetCatalog(kind string) ([]*model.CatalogEntry, error) {
+	c, err := getCatalog(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*model.CatalogEntry
+	err = database.GetDB().Table(c.table + " e").
+		Select("e.id, e.name, count(distinct l.book_id) as books").
+		Joins("join " + c.links + " l on l." + c.column + " = e.id").
+		Group("e.id, e.name").Order("e.name").Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetCatalogEntry returns the entry of a catalog with the id.
+func GetCatalogEntry(kind string, id int) (*model.CatalogEntry, error) {
+	c, err := getCatalog(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *model.CatalogEntry
+	err = database.GetDB().Table(c.table+" e").
+		Select("e.id, e.name, (select count(distinct l.book_id) from "+c.links+" l where l."+c.column+" = e.id) as books").
+		Where("e.id = ?", id).Take(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetCatalogBooks returns the books of the entry id, the books of a series
+// in their order in it.
+func GetCatalogBooks(kind string, id int) ([]*model.Book, error) {
+	c, err := getCatalog(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	db := withLinks(database.GetDB().Model(&model.Book{}))
+	if kind == model.CatalogSeries {
+		db = db.Joins("join book_series s on s.book_id = books.id and s.series_id = ?", id).Order("s.number, books.id")
+	} else {
+		db = db.Where("books.id in (?)", database.GetDB().Table(c.links).Select("book_id").Where(c.column+" = ?", id)).Order("books.id")
+	}
+
+	var books []*model.Book
+	if err := db.Find(&books).Error; err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// RenameCatalogEntry changes the name of the entry id and its key, which no
+// other entry may have. It returns the books of the entry.
+func RenameCatalogEntry(kind string, id int, name, key string) ([]int, error) {
+	c, err := getCatalog(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var bookIds []int
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(c.table).Where("name_key = ? and id <> ?", key, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%s already has an entry named %q, merge them instead", kind, name)
+		}
+
+		res := tx.Table(c.table).Where("id = ?", id).Updates(map[string]any{"name": name, "name_key": key})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Table(c.links).Distinct("book_id").Where(c.column+" = ?", id).Pluck("book_id", &bookIds).Error; err != nil {
+			return err
+		}
+
+		if kind == model.CatalogAuthors {
+			return refreshAuthors(tx, bookIds)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bookIds, nil
+}
+
+// MergeCatalogEntries moves the books of the entries ids to the entry into
+// and deletes them. A book linked to several of them keeps one link, the
+// link to into if it has one. It returns the books that were moved.
+func MergeCatalogEntries(kind string, into int, ids []int) ([]int, error) {
+	c, err := getCatalog(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var bookIds []int
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(c.links).Distinct("book_id").Where(c.column+" in ?", ids).Pluck("book_id", &bookIds).Error; err != nil {
+			return err
+		}
+
+		var links []map[string]any
+		if err := tx.Table(c.links).Where(c.column+" in ?", ids).Find(&links).Error; err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			cond := []string{c.column + " = ?"}
+			args := []any{link[c.column]}
+			for _, key := range c.keys {
+				cond = append(cond, key+" = ?")
+				args = append(args, link[key])
+			}
+			where := strings.Join(cond, " and ")
+
+			var count int64
+			err := tx.Table(c.links).Where(where, append([]any{into}, args[1:]...)...).Count(&count).Error
+			if err != nil {
+				return err
+			}
+
+			if count > 0 {
+				err = tx.Exec("delete from "+c.links+" where "+where, args...).Error
+			} else {
+				err = tx.Exec("update "+c.links+" set "+c.column+" = ? where "+where, append([]any{into}, args...)...).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("delete from "+c.table+" where id in ?", ids).Error; err != nil {
+			return err
+		}
+
+		if kind == model.CatalogAuthors {
+			return refreshAuthors(tx, bookIds)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bookIds, nil
+}
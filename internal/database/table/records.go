@@ -3,6 +3,8 @@ package table
 import (
 	"BookStore/internal/database"
 	"BookStore/internal/database/model"
+	"gorm.io/gorm"
+	"sort"
 	"time"
 )
 
@@ -83,7 +85,7 @@ func UpdateRole(username string, roleId int) error {
 
 func GetBook(id int) (*model.Book, error) {
 	var book *model.Book
-	err := database.GetDB().Model(&model.Book{}).Where("id = ?", id).First(&book).Error
+	err := withLinks(database.GetDB().Model(&model.Book{})).Where("id = ?", id).First(&book).Error
 	if err != nil {
 		return nil, err
 	}
@@ -92,13 +94,21 @@ func GetBook(id int) (*model.Book, error) {
 
 func GetBooks() ([]*model.Book, error) {
 	var books []*model.Book
-	err := database.GetDB().Model(&model.Book{}).Find(&books).Error
+	err := withLinks(database.GetDB().Model(&model.Book{})).Find(&books).Error
 	if err != nil {
 		return nil, err
 	}
 	return books, err
 }
 
+func UpdateBookPages(id int, pages map[string]uint) error {
+	return database.GetDB().Model(&model.Book{ID: id}).Select("Pages").Updates(&model.Book{Pages: pages}).Error
+}
+
+func UpdateBookContent(id int, chapters uint, pages map[string]uint) error {
+	return database.GetDB().Model(&model.Book{ID: id}).Select("Chapters", "Pages").Updates(&model.Book{Chapters: chapters, Pages: pages}).Error
+}
+
 func DeleteBook(id int) error {
 	if err := database.GetDB().Delete(&model.Book{}, id).Error; err != nil {
 		return err
@@ -125,9 +135,193 @@ func GetProgress(userId, bookId int) (*model.ReadingProgress, error) {
 	return progress, err
 }
 
-func UpdateProgress(progress *model.ReadingProgress, page int) error {
+func UpdateProgress(progress *model.ReadingProgress, page int, chapter int, offset uint) error {
 	return database.GetDB().Model(&progress).Updates(map[string]interface{}{
 		"current_page": page,
+		"chapter":      chapter,
+		"offset":       offset,
 		"last_read_at": time.Now().Unix(),
 	}).Error
 }
+
+// GetPageProgress returns the progress saved as a page number, before
+// positions were stored.
+func GetPageProgress() ([]*model.ReadingProgress, error) {
+	var progress []*model.ReadingProgress
+	err := database.GetDB().Model(&model.ReadingProgress{}).Where("chapter is null").Order("book_id").Find(&progress).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+func SetProgressLocator(progress *model.ReadingProgress, chapter int, offset uint) error {
+	return database.GetDB().Model(&progress).Updates(map[string]interface{}{
+		"chapter": chapter,
+		"offset":  offset,
+	}).Error
+}
+
+func SaveChapters(bookId int, chapters []*model.Chapter) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", bookId).Delete(&model.Chapter{}).Error; err != nil {
+			return err
+		}
+
+		if len(chapters) == 0 {
+			return nil
+		}
+
+		return tx.Create(&chapters).Error
+	})
+}
+
+func GetChapters(bookId int) ([]*model.Chapter, error) {
+	var chapters []*model.Chapter
+	err := database.GetDB().Model(&model.Chapter{}).Where("book_id = ?", bookId).Order("number").Find(&chapters).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return chapters, err
+}
+
+func GetImportJob(id int) (*model.ImportJob, error) {
+	var job *model.ImportJob
+	err := database.GetDB().Model(&model.ImportJob{}).Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return job, err
+}
+
+func GetUnfinishedImportJobs() ([]*model.ImportJob, error) {
+	var jobs []*model.ImportJob
+	err := database.GetDB().Model(&model.ImportJob{}).Where("status in ?", []string{model.ImportQueued, model.ImportProcessing}).Order("id").Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, err
+}
+
+func CountBooksWithFile(filepath string) (int64, error) {
+	var count int64
+	err := database.GetDB().Model(&model.Book{}).Where("filepath = ?", filepath).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SetBooksFilepath points the books with the file at old to the file at new.
+func SetBooksFilepath(old, new string) error {
+	return database.GetDB().Model(&model.Book{}).Where("filepath = ?", old).Update("filepath", new).Error
+}
+
+func GetBookByHash(hash string) (*model.Book, error) {
+	var book *model.Book
+	err := database.GetDB().Model(&model.Book{}).Where("hash = ?", hash).First(&book).Error
+	if err != nil {
+		return nil, err
+	}
+	return book, err
+}
+
+func SetBookHash(id int, hash string) error {
+	return database.GetDB().Model(&model.Book{ID: id}).Update("hash", hash).Error
+}
+
+// MergeBooks moves the reading progress and import jobs of the books ids to
+// the book into and deletes them. A position holds only in a book with the
+// same file, so progress moved from another file starts over. A user who has
+// progress in several of the books keeps the one read last, preferring one
+// whose position holds.
+func MergeBooks(into int, ids []int) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var books []*model.Book
+		err := tx.Model(&model.Book{}).Select("id", "filepath").Where("id = ? or id in ?", into, ids).Find(&books).Error
+		if err != nil {
+			return err
+		}
+
+		files := map[int]string{}
+		for _, book := range books {
+			files[book.ID] = book.Filepath
+		}
+		holds := func(p *model.ReadingProgress) bool {
+			return files[p.BookID] == files[into]
+		}
+
+		var progress []*model.ReadingProgress
+		err = tx.Model(&model.ReadingProgress{}).Where("book_id = ? or book_id in ?", into, ids).Order("last_read_at desc").Find(&progress).Error
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(progress, func(i, j int) bool {
+			return holds(progress[i]) && !holds(progress[j])
+		})
+
+		seen := map[int]bool{}
+		for _, p := range progress {
+			if seen[p.UserID] {
+				if err := tx.Delete(p).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			seen[p.UserID] = true
+
+			if p.BookID == into {
+				continue
+			}
+
+			updates := map[string]interface{}{"book_id": into}
+			if !holds(p) {
+				updates["current_page"] = 1
+				updates["chapter"] = 0
+				updates["offset"] = 0
+			}
+			if err := tx.Model(p).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&model.ImportJob{}).Where("book_id in ?", ids).Update("book_id", into).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id in ?", ids).Delete(&model.Book{}).Error
+	})
+}
+
+// LinkBook adds the book to the books of the user with a reading position
+// at its start, unless the user has one already.
+func LinkBook(userId, bookId int) error {
+	chapter := 0
+	progress := &model.ReadingProgress{UserID: userId, BookID: bookId, CurrentPage: 1, Chapter: &chapter}
+	return database.GetDB().Where("user_id = ? and book_id = ?", userId, bookId).FirstOrCreate(progress).Error
+}
+
+func GetBookEdits(bookId int) ([]*model.BookEdit, error) {
+	var edits []*model.BookEdit
+	err := database.GetDB().Model(&model.BookEdit{}).Where("book_id = ?", bookId).Order("id desc").Find(&edits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return edits, nil
+}
+
+func HasBookEdits(bookId int) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(&model.BookEdit{}).Where("book_id = ?", bookId).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}